@@ -1,12 +1,15 @@
 package boltprojection
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"fmt"
+	"time"
 
 	"github.com/dogmatiq/dogma"
 	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
 	"github.com/dogmatiq/projectionkit/internal/identity"
 	"go.etcd.io/bbolt"
 	"go.etcd.io/bbolt/errors"
@@ -23,6 +26,8 @@ type adaptor struct {
 
 // New returns a new [dogma.ProjectionMessageHandler] that binds a
 // BoltDB-specific [MessageHandler] to a BoltDB database.
+//
+// The returned handler also implements [projectionkit.CheckpointLister].
 func New(
 	db *bbolt.DB,
 	handler MessageHandler,
@@ -53,11 +58,13 @@ func (a *adaptor) HandleEvent(
 			return err
 		}
 
-		cp, err = getCheckpointOffset(b, id)
+		c, err := getCheckpoint(b, id)
 		if err != nil {
 			return err
 		}
 
+		cp = c.Offset
+
 		if s.CheckpointOffset() != cp {
 			return nil
 		}
@@ -68,24 +75,96 @@ func (a *adaptor) HandleEvent(
 
 		cp = s.Offset() + 1
 
-		return b.Put(
-			id[:],
-			binary.BigEndian.AppendUint64(nil, cp),
+		return putCheckpoint(
+			b,
+			id,
+			projectionkit.Checkpoint{
+				Offset:          cp,
+				UpdatedAt:       time.Now(),
+				EventRecordedAt: s.RecordedAt(),
+			},
 		)
 	})
 }
 
-func (a *adaptor) CheckpointOffset(_ context.Context, id string) (uint64, error) {
-	var cp uint64
+func (a *adaptor) CheckpointOffset(ctx context.Context, id string) (uint64, error) {
+	cp, err := a.ReadCheckpoint(ctx, id)
+	return cp.Offset, err
+}
 
-	return cp, a.DB.View(func(tx *bbolt.Tx) (err error) {
-		if b := bucketForHandler(tx, a.handlerKey); b != nil {
-			cp, err = getCheckpointOffset(b, uuidpb.MustParseAsByteArray(id))
+func (a *adaptor) ReadCheckpoint(_ context.Context, id string) (projectionkit.Checkpoint, error) {
+	cp := projectionkit.Checkpoint{
+		StreamID: id,
+	}
+
+	return cp, a.DB.View(func(tx *bbolt.Tx) error {
+		b := bucketForHandler(tx, a.handlerKey)
+		if b == nil {
+			return nil
 		}
+
+		c, err := getCheckpoint(b, uuidpb.MustParseAsByteArray(id))
+		cp.Offset = c.Offset
+		cp.UpdatedAt = c.UpdatedAt
+		cp.EventRecordedAt = c.EventRecordedAt
+
 		return err
 	})
 }
 
+func (a *adaptor) ListCheckpoints(
+	_ context.Context,
+	after string,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	if limit <= 0 {
+		panic("limit must be positive")
+	}
+
+	var checkpoints []projectionkit.Checkpoint
+
+	return checkpoints, a.DB.View(func(tx *bbolt.Tx) error {
+		b := bucketForHandler(tx, a.handlerKey)
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		k, v := c.First()
+
+		if after != "" {
+			id := uuidpb.MustParseAsBytes(after)
+			k, v = c.Seek(id)
+			if bytes.Equal(k, id) {
+				k, v = c.Next()
+			}
+		}
+
+		for ; k != nil && len(checkpoints) < limit; k, v = c.Next() {
+			cp, err := unmarshalCheckpoint(v)
+			if err != nil {
+				return err
+			}
+
+			cp.StreamID = uuidpb.FromByteArray([16]byte(k)).AsString()
+			checkpoints = append(checkpoints, cp)
+		}
+
+		return nil
+	})
+}
+
+func (a *adaptor) CountCheckpoints(context.Context) (uint64, error) {
+	var n uint64
+
+	return n, a.DB.View(func(tx *bbolt.Tx) error {
+		if b := bucketForHandler(tx, a.handlerKey); b != nil {
+			n = uint64(b.Stats().KeyN)
+		}
+		return nil
+	})
+}
+
 func (a *adaptor) Compact(ctx context.Context, s dogma.ProjectionCompactScope) error {
 	return a.Handler.Compact(ctx, a.DB, s)
 }
@@ -151,17 +230,69 @@ func deleteBucketForHandler(tx *bbolt.Tx, hk [16]byte) error {
 	return err
 }
 
-// getCheckpointOffset retrieves the checkpoint offset for a specific stream ID.
+// getCheckpoint retrieves the checkpoint for a specific stream ID.
 //
 // b is a handler-specific bucket returned by [makeBucketForHandler] or
-// [bucketForHandler].
-func getCheckpointOffset(b *bbolt.Bucket, id [16]byte) (uint64, error) {
-	switch data := b.Get(id[:]); len(data) {
+// [bucketForHandler]. The StreamID field of the returned checkpoint is not
+// populated.
+func getCheckpoint(b *bbolt.Bucket, id [16]byte) (projectionkit.Checkpoint, error) {
+	return unmarshalCheckpoint(b.Get(id[:]))
+}
+
+// unmarshalCheckpoint returns the checkpoint represented by data.
+//
+// A checkpoint is stored as the offset, followed by the time at which it was
+// updated and the time at which the last applied event was recorded, each as a
+// big-endian 64-bit integer. The timestamps are the number of nanoseconds since
+// the Unix epoch, or zero if unknown. Checkpoints written by earlier versions
+// contain only the offset.
+func unmarshalCheckpoint(data []byte) (projectionkit.Checkpoint, error) {
+	var cp projectionkit.Checkpoint
+
+	switch len(data) {
 	case 0:
-		return 0, nil
 	case 8:
-		return binary.BigEndian.Uint64(data), nil
+		cp.Offset = binary.BigEndian.Uint64(data)
+	case 24:
+		cp.Offset = binary.BigEndian.Uint64(data)
+		cp.UpdatedAt = unmarshalTime(data[8:])
+		cp.EventRecordedAt = unmarshalTime(data[16:])
 	default:
-		return 0, fmt.Errorf("malformed checkpoint: expected 8 bytes, got %d", len(data))
+		return cp, fmt.Errorf("malformed checkpoint: expected 8 or 24 bytes, got %d", len(data))
 	}
+
+	return cp, nil
+}
+
+// putCheckpoint stores the checkpoint for a specific stream ID.
+//
+// b is a handler-specific bucket returned by [makeBucketForHandler]. The
+// StreamID field of cp is ignored.
+func putCheckpoint(b *bbolt.Bucket, id [16]byte, cp projectionkit.Checkpoint) error {
+	data := make([]byte, 0, 24)
+	data = binary.BigEndian.AppendUint64(data, cp.Offset)
+	data = marshalTime(data, cp.UpdatedAt)
+	data = marshalTime(data, cp.EventRecordedAt)
+
+	return b.Put(id[:], data)
+}
+
+// marshalTime appends the binary representation of t to data.
+func marshalTime(data []byte, t time.Time) []byte {
+	var n int64
+	if !t.IsZero() {
+		n = t.UnixNano()
+	}
+
+	return binary.BigEndian.AppendUint64(data, uint64(n))
+}
+
+// unmarshalTime returns the time represented by the first 8 bytes of data.
+func unmarshalTime(data []byte) time.Time {
+	n := int64(binary.BigEndian.Uint64(data))
+	if n == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, n)
 }
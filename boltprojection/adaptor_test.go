@@ -2,15 +2,18 @@ package boltprojection_test
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"os"
 	"testing"
 
 	"github.com/dogmatiq/dogma"
 	. "github.com/dogmatiq/enginekit/enginetest/stubs"
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
 	. "github.com/dogmatiq/projectionkit/boltprojection"
 	"github.com/dogmatiq/projectionkit/boltprojection/internal/fixtures" // can't dot-import due to conflict
-	"github.com/dogmatiq/projectionkit/internal/handlertest"
+	"github.com/dogmatiq/projectionkit/projectiontest"
 	"go.etcd.io/bbolt"
 )
 
@@ -42,7 +45,7 @@ func TestAdaptor(t *testing.T) {
 
 		deps.Handler = &fixtures.MessageHandler{
 			ConfigureFunc: func(c dogma.ProjectionConfigurer) {
-				c.Identity("<projection>", handlertest.IdentityKey)
+				c.Identity("<projection>", projectiontest.IdentityKey)
 			},
 		}
 
@@ -51,10 +54,29 @@ func TestAdaptor(t *testing.T) {
 		return deps
 	}
 
-	handlertest.Run(
+	projectiontest.Run(
 		t,
-		func(t *testing.T) dogma.ProjectionMessageHandler {
-			return setup(t).Adaptor
+		func(t *testing.T, h *projectiontest.Hooks) dogma.ProjectionMessageHandler {
+			deps := setup(t)
+
+			deps.Handler.HandleEventFunc = func(
+				_ context.Context,
+				_ *bbolt.Tx,
+				s dogma.ProjectionEventScope,
+				m dogma.Event,
+			) error {
+				return h.HandleEvent(s, m)
+			}
+
+			deps.Handler.ResetFunc = func(
+				_ context.Context,
+				_ *bbolt.Tx,
+				s dogma.ProjectionResetScope,
+			) error {
+				return h.Reset(s)
+			}
+
+			return deps.Adaptor
 		},
 	)
 
@@ -84,6 +106,51 @@ func TestAdaptor(t *testing.T) {
 		})
 	})
 
+	t.Run("func ReadCheckpoint()", func(t *testing.T) {
+		t.Run("it reads checkpoints that do not contain timestamps", func(t *testing.T) {
+			deps := setup(t)
+			scope := &ProjectionEventScopeStub{}
+
+			// Checkpoints written by earlier versions contain only the
+			// checkpoint offset.
+			if err := deps.DB.Update(func(tx *bbolt.Tx) error {
+				b, err := tx.CreateBucketIfNotExists([]byte("projection_checkpoint"))
+				if err != nil {
+					return err
+				}
+
+				b, err = b.CreateBucketIfNotExists(uuidpb.MustParseAsBytes(projectiontest.IdentityKey))
+				if err != nil {
+					return err
+				}
+
+				return b.Put(
+					uuidpb.MustParseAsBytes(scope.StreamID()),
+					binary.BigEndian.AppendUint64(nil, 123),
+				)
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := deps.Adaptor.(projectionkit.CheckpointReader).ReadCheckpoint(
+				t.Context(),
+				scope.StreamID(),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := projectionkit.Checkpoint{
+				StreamID: scope.StreamID(),
+				Offset:   123,
+			}
+
+			if got != want {
+				t.Fatalf("unexpected checkpoint: got %+v, want %+v", got, want)
+			}
+		})
+	})
+
 	t.Run("func Compact()", func(t *testing.T) {
 		t.Run("it forwards to the handler", func(t *testing.T) {
 			deps := setup(t)
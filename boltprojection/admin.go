@@ -0,0 +1,231 @@
+package boltprojection
+
+import (
+	"io"
+	"time"
+
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
+	"go.etcd.io/bbolt"
+	"go.etcd.io/bbolt/errors"
+)
+
+// The functions in this file are intended for inspecting and repairing the
+// checkpoints stored in a database by hand. Those that modify checkpoints must
+// not be used while the affected handlers are running.
+
+// HandlerKeys returns the identity keys of the handlers that have checkpoints
+// stored in db, in sorted order.
+func HandlerKeys(db *bbolt.DB) ([]string, error) {
+	var keys []string
+
+	return keys, db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(checkpointBucket)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEachBucket(func(k []byte) error {
+			id, err := uuidpb.FromBytes(k)
+			if err != nil {
+				return err
+			}
+
+			keys = append(keys, id.AsString())
+			return nil
+		})
+	})
+}
+
+// Checkpoints returns all checkpoints stored in db for the handler with the
+// given identity key, ordered by stream ID.
+func Checkpoints(db *bbolt.DB, key string) ([]projectionkit.Checkpoint, error) {
+	hk, err := uuidpb.ParseAsByteArray(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoints []projectionkit.Checkpoint
+
+	return checkpoints, db.View(func(tx *bbolt.Tx) error {
+		b := bucketForHandler(tx, hk)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			cp, err := unmarshalCheckpoint(v)
+			if err != nil {
+				return err
+			}
+
+			cp.StreamID = uuidpb.FromByteArray([16]byte(k)).AsString()
+			checkpoints = append(checkpoints, cp)
+
+			return nil
+		})
+	})
+}
+
+// SetCheckpointOffset sets the checkpoint offset of a specific event stream
+// for the handler with the given identity key, regardless of its current
+// value. If offset is zero, the checkpoint is deleted.
+func SetCheckpointOffset(db *bbolt.DB, key, id string, offset uint64) error {
+	hk, err := uuidpb.ParseAsByteArray(key)
+	if err != nil {
+		return err
+	}
+
+	streamID, err := uuidpb.ParseAsByteArray(id)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		if offset == 0 {
+			if b := bucketForHandler(tx, hk); b != nil {
+				return b.Delete(streamID[:])
+			}
+			return nil
+		}
+
+		b, err := makeBucketForHandler(tx, hk)
+		if err != nil {
+			return err
+		}
+
+		return putCheckpoint(
+			b,
+			streamID,
+			projectionkit.Checkpoint{
+				Offset:    offset,
+				UpdatedAt: time.Now(),
+			},
+		)
+	})
+}
+
+// DeleteCheckpoints deletes all checkpoints stored in db for the handler with
+// the given identity key.
+//
+// Unlike resetting the handler, it does not affect the projection's data.
+func DeleteCheckpoints(db *bbolt.DB, key string) error {
+	hk, err := uuidpb.ParseAsByteArray(key)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		return deleteBucketForHandler(tx, hk)
+	})
+}
+
+// ExportCheckpoints writes the checkpoint offsets of all handlers stored in db
+// to w, in the format written by [projectionkit.CheckpointEncoder].
+func ExportCheckpoints(db *bbolt.DB, w io.Writer) error {
+	enc := projectionkit.NewCheckpointEncoder(w)
+
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(checkpointBucket)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEachBucket(func(hk []byte) error {
+			key, err := uuidpb.FromBytes(hk)
+			if err != nil {
+				return err
+			}
+
+			return b.Bucket(hk).ForEach(func(k, v []byte) error {
+				cp, err := unmarshalCheckpoint(v)
+				if err != nil {
+					return err
+				}
+
+				return enc.Encode(projectionkit.ExportedCheckpoint{
+					HandlerKey: key.AsString(),
+					StreamID:   uuidpb.FromByteArray([16]byte(k)).AsString(),
+					Offset:     cp.Offset,
+				})
+			})
+		})
+	})
+}
+
+// ImportCheckpoints reads checkpoint offsets from r, in the format written by
+// [projectionkit.CheckpointEncoder], and stores them in db, replacing any
+// existing checkpoint offsets for the same handlers and streams.
+//
+// The checkpoints are imported within a single transaction. Checkpoints with
+// an offset of zero are deleted. Checkpoints that are not present in r are left
+// unchanged.
+func ImportCheckpoints(db *bbolt.DB, r io.Reader) error {
+	dec := projectionkit.NewCheckpointDecoder(r)
+	now := time.Now()
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		for {
+			cp, err := dec.Decode()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			hk := uuidpb.MustParseAsByteArray(cp.HandlerKey)
+			streamID := uuidpb.MustParseAsByteArray(cp.StreamID)
+
+			if cp.Offset == 0 {
+				if b := bucketForHandler(tx, hk); b != nil {
+					if err := b.Delete(streamID[:]); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			b, err := makeBucketForHandler(tx, hk)
+			if err != nil {
+				return err
+			}
+
+			if err := putCheckpoint(
+				b,
+				streamID,
+				projectionkit.Checkpoint{
+					Offset:    cp.Offset,
+					UpdatedAt: now,
+				},
+			); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// CreateSchema creates the bucket that contains the checkpoints in db.
+//
+// It's not necessary to call CreateSchema before using the handler, as the
+// bucket is created on demand.
+func CreateSchema(db *bbolt.DB) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(checkpointBucket)
+		return err
+	})
+}
+
+// DropSchema deletes the bucket that contains the checkpoints in db, including
+// the checkpoints of all handlers.
+func DropSchema(db *bbolt.DB) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		err := tx.DeleteBucket(checkpointBucket)
+
+		if err == errors.ErrBucketNotFound {
+			return nil
+		}
+
+		return err
+	})
+}
@@ -0,0 +1,276 @@
+package boltprojection_test
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	. "github.com/dogmatiq/projectionkit/boltprojection"
+	"go.etcd.io/bbolt"
+)
+
+func TestAdmin(t *testing.T) {
+	const (
+		handlerA = "1b0d6c2a-9f7e-4c5d-8b3a-2e1f0d9c8b7a"
+		handlerB = "9e8d7c6b-5a4f-4e3d-a2c1-b0a9f8e7d6c5"
+		streamA  = "2a3b4c5d-6e7f-4a8b-9c0d-1e2f3a4b5c6d"
+		streamB  = "7d6c5b4a-3f2e-4d1c-8b0a-9f8e7d6c5b4a"
+	)
+
+	setup := func(t *testing.T) *bbolt.DB {
+		t.Helper()
+
+		tmp, err := os.CreateTemp("", "*.boltdb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmp.Close()
+
+		t.Cleanup(func() {
+			os.Remove(tmp.Name())
+		})
+
+		db, err := bbolt.Open(tmp.Name(), 0600, bbolt.DefaultOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		return db
+	}
+
+	t.Run("func HandlerKeys()", func(t *testing.T) {
+		t.Run("it returns the keys of handlers with checkpoints", func(t *testing.T) {
+			db := setup(t)
+
+			for _, key := range []string{handlerB, handlerA} {
+				if err := SetCheckpointOffset(db, key, streamA, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := HandlerKeys(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{handlerA, handlerB}
+			if !slices.Equal(got, want) {
+				t.Fatalf("unexpected handler keys: got %v, want %v", got, want)
+			}
+		})
+
+		t.Run("it returns nothing if there are no checkpoints", func(t *testing.T) {
+			db := setup(t)
+
+			got, err := HandlerKeys(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 0 {
+				t.Fatalf("unexpected handler keys: got %v, want none", got)
+			}
+		})
+	})
+
+	t.Run("func SetCheckpointOffset()", func(t *testing.T) {
+		t.Run("it replaces the existing checkpoint offset", func(t *testing.T) {
+			db := setup(t)
+
+			for _, offset := range []uint64{10, 5} {
+				if err := SetCheckpointOffset(db, handlerA, streamA, offset); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := Checkpoints(db, handlerA)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 1 || got[0].StreamID != streamA || got[0].Offset != 5 {
+				t.Fatalf("unexpected checkpoints: got %+v, want %s@5", got, streamA)
+			}
+		})
+
+		t.Run("it returns an error if the handler key is invalid", func(t *testing.T) {
+			db := setup(t)
+
+			if err := SetCheckpointOffset(db, "<invalid>", streamA, 1); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	})
+
+	t.Run("func DeleteCheckpoints()", func(t *testing.T) {
+		t.Run("it only deletes the checkpoints of the given handler", func(t *testing.T) {
+			db := setup(t)
+
+			for _, key := range []string{handlerA, handlerB} {
+				for _, id := range []string{streamA, streamB} {
+					if err := SetCheckpointOffset(db, key, id, 1); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if err := DeleteCheckpoints(db, handlerA); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := HandlerKeys(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := []string{handlerB}; !slices.Equal(got, want) {
+				t.Fatalf("unexpected handler keys: got %v, want %v", got, want)
+			}
+		})
+	})
+
+	t.Run("func ExportCheckpoints()", func(t *testing.T) {
+		t.Run("it exports the checkpoints of all handlers", func(t *testing.T) {
+			db := setup(t)
+
+			for _, key := range []string{handlerB, handlerA} {
+				if err := SetCheckpointOffset(db, key, streamA, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := SetCheckpointOffset(db, handlerA, streamB, 2); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := ExportCheckpoints(db, &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			want := `{"handler":"` + handlerA + `","stream":"` + streamA + `","offset":1}` + "\n" +
+				`{"handler":"` + handlerA + `","stream":"` + streamB + `","offset":2}` + "\n" +
+				`{"handler":"` + handlerB + `","stream":"` + streamA + `","offset":1}` + "\n"
+
+			if got := buf.String(); got != want {
+				t.Fatalf("unexpected export:\ngot:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	})
+
+	t.Run("func ImportCheckpoints()", func(t *testing.T) {
+		t.Run("it imports checkpoints that were exported from another database", func(t *testing.T) {
+			src := setup(t)
+			dst := setup(t)
+
+			if err := SetCheckpointOffset(src, handlerA, streamA, 10); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := SetCheckpointOffset(dst, handlerA, streamA, 5); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := SetCheckpointOffset(dst, handlerA, streamB, 3); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := ExportCheckpoints(src, &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ImportCheckpoints(dst, &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Checkpoints(dst, handlerA)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 2 || got[0].Offset != 10 || got[1].Offset != 3 {
+				t.Fatalf("unexpected checkpoints: got %+v, want %s@10 and %s@3", got, streamA, streamB)
+			}
+		})
+
+		t.Run("it deletes the checkpoints of streams with an offset of zero", func(t *testing.T) {
+			db := setup(t)
+
+			if err := SetCheckpointOffset(db, handlerA, streamA, 10); err != nil {
+				t.Fatal(err)
+			}
+
+			input := `{"handler":"` + handlerA + `","stream":"` + streamA + `","offset":0}` + "\n"
+
+			if err := ImportCheckpoints(db, strings.NewReader(input)); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Checkpoints(db, handlerA)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 0 {
+				t.Fatalf("unexpected checkpoints: got %+v, want none", got)
+			}
+		})
+
+		t.Run("it does not import any checkpoints if the input is invalid", func(t *testing.T) {
+			db := setup(t)
+
+			input := `{"handler":"` + handlerA + `","stream":"` + streamA + `","offset":1}` + "\n" +
+				`{"handler":"<invalid>","stream":"` + streamA + `","offset":1}` + "\n"
+
+			if err := ImportCheckpoints(db, strings.NewReader(input)); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			got, err := HandlerKeys(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 0 {
+				t.Fatalf("unexpected handler keys: got %v, want none", got)
+			}
+		})
+	})
+
+	t.Run("func DropSchema()", func(t *testing.T) {
+		t.Run("it deletes the checkpoints of all handlers", func(t *testing.T) {
+			db := setup(t)
+
+			if err := SetCheckpointOffset(db, handlerA, streamA, 1); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := DropSchema(db); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := HandlerKeys(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 0 {
+				t.Fatalf("unexpected handler keys: got %v, want none", got)
+			}
+		})
+
+		t.Run("it can be called when the schema does not exist", func(t *testing.T) {
+			db := setup(t)
+
+			if err := DropSchema(db); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+}
@@ -0,0 +1,68 @@
+package projectionkit
+
+import (
+	"context"
+	"time"
+
+	"github.com/dogmatiq/dogma"
+)
+
+// Checkpoint describes a projection's progress through a single event stream.
+type Checkpoint struct {
+	// StreamID is the RFC 9562 UUID that identifies the event stream.
+	StreamID string
+
+	// Offset is the offset at which the projection expects to resume handling
+	// events from the stream.
+	Offset uint64
+
+	// UpdatedAt is the time at which the checkpoint offset was last updated.
+	//
+	// It's the zero value if no events from the stream have been applied, or
+	// if the checkpoint offset was last updated by a version of projectionkit
+	// that did not record this information.
+	UpdatedAt time.Time
+
+	// EventRecordedAt is the time at which the last event applied from the
+	// stream was recorded, as per [dogma.ProjectionEventScope].RecordedAt.
+	//
+	// The difference between this time and the current time is an
+	// approximation of the projection's lag behind the stream.
+	//
+	// It's the zero value under the same conditions as UpdatedAt.
+	EventRecordedAt time.Time
+}
+
+// CheckpointReader is a [dogma.ProjectionMessageHandler] that provides
+// information about its checkpoints.
+type CheckpointReader interface {
+	dogma.ProjectionMessageHandler
+
+	// ReadCheckpoint returns the checkpoint for a specific event stream.
+	//
+	// id is an RFC 9562 UUID that identifies the event stream. If no events
+	// from the stream have been applied, the returned checkpoint has an offset
+	// of zero.
+	ReadCheckpoint(ctx context.Context, id string) (Checkpoint, error)
+}
+
+// CheckpointLister is a [dogma.ProjectionMessageHandler] that can enumerate
+// the event streams for which it has stored checkpoints.
+type CheckpointLister interface {
+	CheckpointReader
+
+	// ListCheckpoints returns up to limit checkpoints, ordered by stream ID.
+	//
+	// Only checkpoints for streams with IDs that sort after the given stream ID
+	// are returned, such that the ID of the last stream in one page may be
+	// used to request the next. If after is empty, checkpoints are returned
+	// from the beginning.
+	//
+	// It panics if limit is not positive. A result with fewer than limit
+	// checkpoints indicates that there are no more checkpoints.
+	ListCheckpoints(ctx context.Context, after string, limit int) ([]Checkpoint, error)
+
+	// CountCheckpoints returns the number of event streams for which there is a
+	// stored checkpoint.
+	CountCheckpoints(ctx context.Context) (uint64, error)
+}
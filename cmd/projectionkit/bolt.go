@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/dogmatiq/projectionkit"
+	"github.com/dogmatiq/projectionkit/boltprojection"
+	"go.etcd.io/bbolt"
+)
+
+// boltStore is a [store] for BoltDB databases.
+type boltStore struct {
+	DB *bbolt.DB
+}
+
+func openBoltStore(cfg config) (store, error) {
+	if cfg.DSN == "" {
+		return nil, errors.New("the -dsn flag is required for the \"bolt\" backend")
+	}
+
+	db, err := bbolt.Open(cfg.DSN, 0600, bbolt.DefaultOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltStore{db}, nil
+}
+
+func (s *boltStore) CreateSchema(context.Context) error {
+	return boltprojection.CreateSchema(s.DB)
+}
+
+func (s *boltStore) DropSchema(context.Context) error {
+	return boltprojection.DropSchema(s.DB)
+}
+
+func (s *boltStore) HandlerKeys(context.Context) ([]string, error) {
+	return boltprojection.HandlerKeys(s.DB)
+}
+
+func (s *boltStore) Checkpoints(_ context.Context, key string) ([]projectionkit.Checkpoint, error) {
+	return boltprojection.Checkpoints(s.DB, key)
+}
+
+func (s *boltStore) SetCheckpointOffset(_ context.Context, key, id string, offset uint64) error {
+	return boltprojection.SetCheckpointOffset(s.DB, key, id, offset)
+}
+
+func (s *boltStore) DeleteCheckpoints(_ context.Context, key string) error {
+	return boltprojection.DeleteCheckpoints(s.DB, key)
+}
+
+func (s *boltStore) ExportCheckpoints(_ context.Context, w io.Writer) error {
+	return boltprojection.ExportCheckpoints(s.DB, w)
+}
+
+func (s *boltStore) ImportCheckpoints(_ context.Context, r io.Reader) error {
+	return boltprojection.ImportCheckpoints(s.DB, r)
+}
+
+func (s *boltStore) Close() error {
+	return s.DB.Close()
+}
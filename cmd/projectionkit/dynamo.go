@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/dogmatiq/projectionkit"
+	"github.com/dogmatiq/projectionkit/dynamoprojection"
+)
+
+// dynamoStore is a [store] for DynamoDB tables.
+type dynamoStore struct {
+	Client *dynamodb.Client
+	Table  string
+}
+
+func openDynamoStore(ctx context.Context, cfg config) (store, error) {
+	if cfg.Table == "" {
+		return nil, errors.New("the -table flag is required for the \"dynamodb\" backend")
+	}
+
+	var options []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		options = append(options, awsconfig.WithRegion(cfg.Region))
+	}
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := dynamodb.NewFromConfig(
+		awsConfig,
+		func(opts *dynamodb.Options) {
+			if cfg.Endpoint != "" {
+				opts.BaseEndpoint = aws.String(cfg.Endpoint)
+			}
+		},
+	)
+
+	return &dynamoStore{client, cfg.Table}, nil
+}
+
+func (s *dynamoStore) CreateSchema(ctx context.Context) error {
+	return dynamoprojection.CreateTable(ctx, s.Client, s.Table)
+}
+
+func (s *dynamoStore) DropSchema(ctx context.Context) error {
+	return dynamoprojection.DeleteTable(ctx, s.Client, s.Table)
+}
+
+func (s *dynamoStore) HandlerKeys(ctx context.Context) ([]string, error) {
+	return dynamoprojection.HandlerKeys(ctx, s.Client, s.Table)
+}
+
+func (s *dynamoStore) Checkpoints(ctx context.Context, key string) ([]projectionkit.Checkpoint, error) {
+	return dynamoprojection.Checkpoints(ctx, s.Client, s.Table, key)
+}
+
+func (s *dynamoStore) SetCheckpointOffset(ctx context.Context, key, id string, offset uint64) error {
+	return dynamoprojection.SetCheckpointOffset(ctx, s.Client, s.Table, key, id, offset)
+}
+
+func (s *dynamoStore) DeleteCheckpoints(ctx context.Context, key string) error {
+	return dynamoprojection.DeleteCheckpoints(ctx, s.Client, s.Table, key)
+}
+
+func (s *dynamoStore) ExportCheckpoints(ctx context.Context, w io.Writer) error {
+	return dynamoprojection.ExportCheckpoints(ctx, s.Client, s.Table, w)
+}
+
+func (s *dynamoStore) ImportCheckpoints(ctx context.Context, r io.Reader) error {
+	return dynamoprojection.ImportCheckpoints(ctx, s.Client, s.Table, r)
+}
+
+func (s *dynamoStore) Close() error {
+	return nil
+}
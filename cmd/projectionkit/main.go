@@ -0,0 +1,221 @@
+// Command projectionkit inspects and repairs the checkpoints stored by
+// projectionkit's adaptors.
+//
+// Usage:
+//
+//	projectionkit -backend <backend> [flags] <command> [arguments]
+//
+// The supported backends are "sqlite", "postgres", "cockroach", "mysql",
+// "mssql", "bolt" and "dynamodb". The commands are:
+//
+//	create-schema                             create the schema used to store checkpoints
+//	drop-schema                               drop the schema used to store checkpoints
+//	handlers                                  list the handlers that have checkpoints
+//	checkpoints <handler-key>                 list a handler's checkpoints
+//	set-offset <handler-key> <stream> <n>     set the checkpoint offset of a stream
+//	delete <handler-key>                      delete all of a handler's checkpoints
+//	export                                    write all checkpoints to stdout
+//	import <file>                             read checkpoints from a file written by export
+//
+// The export format consists of one JSON object per line, and is the same for
+// all backends, such that checkpoints can be moved from one backend to another.
+//
+// Setting a stream's checkpoint offset to 0 deletes its checkpoint, such that
+// the stream is handled from the beginning.
+//
+// Commands that modify checkpoints must not be used while the affected
+// handlers are running.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "projectionkit:", err)
+		}
+		os.Exit(2)
+	}
+}
+
+// run executes the command described by args.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var cfg config
+
+	flags := flag.NewFlagSet("projectionkit", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&cfg.Backend, "backend", "", `the storage backend: "sqlite", "postgres", "cockroach", "mysql", "mssql", "bolt" or "dynamodb"`)
+	flags.StringVar(&cfg.DSN, "dsn", "", "the data source name of an SQL database, or the path to a Bolt database file")
+	flags.StringVar(&cfg.Table, "table", "", "the name of the checkpoint table (required for DynamoDB)")
+	flags.StringVar(&cfg.Schema, "schema", "", "the name of the PostgreSQL or CockroachDB schema that contains the checkpoint table")
+	flags.StringVar(&cfg.Endpoint, "endpoint", "", "the DynamoDB endpoint URL, for use with local stand-ins")
+	flags.StringVar(&cfg.Region, "region", "", "the AWS region (defaults to the standard AWS configuration)")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no command specified")
+	}
+
+	cmd, args := flags.Arg(0), flags.Args()[1:]
+
+	fn, arity, ok := commands(cmd)
+	if !ok {
+		return fmt.Errorf("unrecognized command: %q", cmd)
+	}
+
+	if len(args) != arity {
+		return fmt.Errorf("%s: expected %d argument(s), got %d", cmd, arity, len(args))
+	}
+
+	s, err := openStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return fn(ctx, s, args, stdout)
+}
+
+const usage = `Usage: projectionkit -backend <backend> [flags] <command> [arguments]
+
+Commands:
+  create-schema                             create the schema used to store checkpoints
+  drop-schema                               drop the schema used to store checkpoints
+  handlers                                  list the handlers that have checkpoints
+  checkpoints <handler-key>                 list a handler's checkpoints
+  set-offset <handler-key> <stream> <n>     set the checkpoint offset of a stream
+  delete <handler-key>                      delete all of a handler's checkpoints
+  export                                    write all checkpoints to stdout
+  import <file>                             read checkpoints from a file written by export
+
+Flags:
+`
+
+// command is a function that implements a command.
+type command func(ctx context.Context, s store, args []string, w io.Writer) error
+
+// commands returns the function that implements the named command, along with
+// the number of arguments it expects.
+func commands(name string) (command, int, bool) {
+	switch name {
+	case "create-schema":
+		return createSchema, 0, true
+	case "drop-schema":
+		return dropSchema, 0, true
+	case "handlers":
+		return listHandlers, 0, true
+	case "checkpoints":
+		return listCheckpoints, 1, true
+	case "set-offset":
+		return setOffset, 3, true
+	case "delete":
+		return deleteCheckpoints, 1, true
+	case "export":
+		return exportCheckpoints, 0, true
+	case "import":
+		return importCheckpoints, 1, true
+	default:
+		return nil, 0, false
+	}
+}
+
+func createSchema(ctx context.Context, s store, _ []string, _ io.Writer) error {
+	return s.CreateSchema(ctx)
+}
+
+func dropSchema(ctx context.Context, s store, _ []string, _ io.Writer) error {
+	return s.DropSchema(ctx)
+}
+
+func listHandlers(ctx context.Context, s store, _ []string, w io.Writer) error {
+	keys, err := s.HandlerKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		fmt.Fprintln(w, k)
+	}
+
+	return nil
+}
+
+func listCheckpoints(ctx context.Context, s store, args []string, w io.Writer) error {
+	checkpoints, err := s.Checkpoints(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STREAM\tOFFSET\tUPDATED AT\tEVENT RECORDED AT")
+
+	for _, cp := range checkpoints {
+		fmt.Fprintf(
+			tw,
+			"%s\t%d\t%s\t%s\n",
+			cp.StreamID,
+			cp.Offset,
+			formatTime(cp.UpdatedAt),
+			formatTime(cp.EventRecordedAt),
+		)
+	}
+
+	return tw.Flush()
+}
+
+func setOffset(ctx context.Context, s store, args []string, _ io.Writer) error {
+	offset, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid offset: %w", err)
+	}
+
+	return s.SetCheckpointOffset(ctx, args[0], args[1], offset)
+}
+
+func deleteCheckpoints(ctx context.Context, s store, args []string, _ io.Writer) error {
+	return s.DeleteCheckpoints(ctx, args[0])
+}
+
+func exportCheckpoints(ctx context.Context, s store, _ []string, w io.Writer) error {
+	return s.ExportCheckpoints(ctx, w)
+}
+
+func importCheckpoints(ctx context.Context, s store, args []string, _ io.Writer) error {
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return s.ImportCheckpoints(ctx, f)
+}
+
+// formatTime returns a human-readable representation of t.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
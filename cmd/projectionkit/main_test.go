@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	const (
+		handlerKey = "26902c80-a1b8-43d1-99ae-ea5651656e63"
+		streamID   = "6d1e805f-1760-409f-b1eb-e14983ec3f68"
+	)
+
+	cases := []struct {
+		Name  string
+		Flags func(dir string) []string
+	}{
+		{
+			"sqlite",
+			func(dir string) []string {
+				return []string{"-backend", "sqlite", "-dsn", "file:" + filepath.Join(dir, "db.sqlite") + "?mode=rwc"}
+			},
+		},
+		{
+			"bolt",
+			func(dir string) []string {
+				return []string{"-backend", "bolt", "-dsn", filepath.Join(dir, "db.boltdb")}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			flags := c.Flags(t.TempDir())
+
+			exec := func(t *testing.T, args ...string) string {
+				t.Helper()
+
+				var stdout, stderr bytes.Buffer
+				if err := run(t.Context(), append(flags, args...), &stdout, &stderr); err != nil {
+					t.Fatalf("%s: %s\n%s", strings.Join(args, " "), err, stderr.String())
+				}
+
+				return stdout.String()
+			}
+
+			exec(t, "create-schema")
+			exec(t, "set-offset", handlerKey, streamID, "123")
+
+			if got, want := exec(t, "handlers"), handlerKey+"\n"; got != want {
+				t.Fatalf("unexpected handlers: got %q, want %q", got, want)
+			}
+
+			got := exec(t, "checkpoints", handlerKey)
+			if !strings.Contains(got, streamID) || !strings.Contains(got, "123") {
+				t.Fatalf("unexpected checkpoints output:\n%s", got)
+			}
+
+			exec(t, "set-offset", handlerKey, streamID, "0")
+
+			if got := exec(t, "checkpoints", handlerKey); strings.Contains(got, streamID) {
+				t.Fatalf("expected a zero offset to delete the checkpoint:\n%s", got)
+			}
+
+			exec(t, "set-offset", handlerKey, streamID, "123")
+			exec(t, "delete", handlerKey)
+
+			if got := exec(t, "handlers"); got != "" {
+				t.Fatalf("unexpected handlers after delete: got %q, want none", got)
+			}
+
+			exec(t, "drop-schema")
+		})
+	}
+
+	t.Run("it can move checkpoints between backends", func(t *testing.T) {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "checkpoints.jsonl")
+
+		sqlite := []string{"-backend", "sqlite", "-dsn", "file:" + filepath.Join(dir, "db.sqlite") + "?mode=rwc"}
+		bolt := []string{"-backend", "bolt", "-dsn", filepath.Join(dir, "db.boltdb")}
+
+		exec := func(t *testing.T, args ...string) string {
+			t.Helper()
+
+			var stdout, stderr bytes.Buffer
+			if err := run(t.Context(), args, &stdout, &stderr); err != nil {
+				t.Fatalf("%s: %s\n%s", strings.Join(args, " "), err, stderr.String())
+			}
+
+			return stdout.String()
+		}
+
+		exec(t, append(sqlite, "create-schema")...)
+		exec(t, append(sqlite, "set-offset", handlerKey, streamID, "123")...)
+
+		if err := os.WriteFile(file, []byte(exec(t, append(sqlite, "export")...)), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		exec(t, append(bolt, "import", file)...)
+
+		got := exec(t, append(bolt, "checkpoints", handlerKey)...)
+		if !strings.Contains(got, streamID) || !strings.Contains(got, "123") {
+			t.Fatalf("unexpected checkpoints output:\n%s", got)
+		}
+	})
+
+	t.Run("it returns an error if the command is not recognized", func(t *testing.T) {
+		err := run(t.Context(), []string{"-backend", "bolt", "<command>"}, os.Stdout, &bytes.Buffer{})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("it returns an error if the wrong number of arguments is given", func(t *testing.T) {
+		err := run(t.Context(), []string{"-backend", "bolt", "checkpoints"}, os.Stdout, &bytes.Buffer{})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
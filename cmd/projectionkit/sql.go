@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
+	"github.com/dogmatiq/projectionkit/sqlprojection"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/microsoft/go-mssqldb"
+	_ "modernc.org/sqlite"
+)
+
+// sqlStore is a [store] for SQL databases.
+type sqlStore struct {
+	DB     *sql.DB
+	Driver sqlprojection.Driver
+}
+
+func openSQLStore(cfg config) (store, error) {
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("the -dsn flag is required for the %q backend", cfg.Backend)
+	}
+
+	var (
+		driverName string
+		driver     sqlprojection.Driver
+	)
+
+	switch cfg.Backend {
+	case "sqlite":
+		var options []sqlprojection.SQLiteOption
+		if cfg.Table != "" {
+			options = append(options, sqlprojection.WithSQLiteTable(cfg.Table))
+		}
+		driverName, driver = "sqlite", sqlprojection.NewSQLiteDriver(options...)
+
+	case "postgres", "cockroach":
+		var options []sqlprojection.PostgresOption
+		if cfg.Schema != "" {
+			options = append(options, sqlprojection.WithPostgresSchema(cfg.Schema))
+		}
+		if cfg.Table != "" {
+			options = append(options, sqlprojection.WithPostgresTable(cfg.Table))
+		}
+
+		if cfg.Backend == "cockroach" {
+			driverName, driver = "pgx", sqlprojection.NewCockroachDriver(options...)
+		} else {
+			driverName, driver = "pgx", sqlprojection.NewPostgresDriver(options...)
+		}
+
+	case "mysql":
+		var options []sqlprojection.MySQLOption
+		if cfg.Table != "" {
+			options = append(options, sqlprojection.WithMySQLTable(cfg.Table))
+		}
+		driverName, driver = "mysql", sqlprojection.NewMySQLDriver(options...)
+
+	case "mssql":
+		var options []sqlprojection.MSSQLOption
+		if cfg.Table != "" {
+			options = append(options, sqlprojection.WithMSSQLTable(cfg.Table))
+		}
+		driverName, driver = "sqlserver", sqlprojection.NewMSSQLDriver(options...)
+	}
+
+	db, err := sql.Open(driverName, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlStore{db, driver}, nil
+}
+
+func (s *sqlStore) CreateSchema(ctx context.Context) error {
+	return s.Driver.CreateSchema(ctx, s.DB)
+}
+
+func (s *sqlStore) DropSchema(ctx context.Context) error {
+	return s.Driver.DropSchema(ctx, s.DB)
+}
+
+func (s *sqlStore) HandlerKeys(ctx context.Context) ([]string, error) {
+	handlers, err := s.Driver.QueryHandlers(ctx, s.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(handlers))
+
+	for _, h := range handlers {
+		id, err := uuidpb.FromBytes(h)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, id.AsString())
+	}
+
+	return keys, nil
+}
+
+func (s *sqlStore) Checkpoints(ctx context.Context, key string) ([]projectionkit.Checkpoint, error) {
+	h, err := uuidpb.ParseAsBytes(key)
+	if err != nil {
+		return nil, err
+	}
+
+	const pageSize = 1000
+
+	var (
+		checkpoints []projectionkit.Checkpoint
+		after       []byte
+	)
+
+	for {
+		page, err := s.Driver.QueryCheckpoints(ctx, s.DB, h, after, pageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		checkpoints = append(checkpoints, page...)
+
+		if len(page) < pageSize {
+			return checkpoints, nil
+		}
+
+		after = uuidpb.MustParseAsBytes(page[len(page)-1].StreamID)
+	}
+}
+
+func (s *sqlStore) SetCheckpointOffset(ctx context.Context, key, id string, offset uint64) error {
+	h, err := uuidpb.ParseAsBytes(key)
+	if err != nil {
+		return err
+	}
+
+	streamID, err := uuidpb.ParseAsBytes(id)
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, func(tx *sql.Tx) error {
+		return s.Driver.StoreCheckpointOffset(ctx, tx, h, streamID, offset)
+	})
+}
+
+func (s *sqlStore) DeleteCheckpoints(ctx context.Context, key string) error {
+	h, err := uuidpb.ParseAsBytes(key)
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, func(tx *sql.Tx) error {
+		return s.Driver.DeleteCheckpointOffsets(ctx, tx, h)
+	})
+}
+
+func (s *sqlStore) ExportCheckpoints(ctx context.Context, w io.Writer) error {
+	return sqlprojection.ExportCheckpoints(ctx, s.DB, s.Driver, w)
+}
+
+func (s *sqlStore) ImportCheckpoints(ctx context.Context, r io.Reader) error {
+	return sqlprojection.ImportCheckpoints(ctx, s.DB, s.Driver, r)
+}
+
+func (s *sqlStore) Close() error {
+	return s.DB.Close()
+}
+
+// update calls fn within a transaction.
+func (s *sqlStore) update(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
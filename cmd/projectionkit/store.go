@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/dogmatiq/projectionkit"
+)
+
+// config is the configuration used to connect to a storage backend.
+type config struct {
+	Backend  string
+	DSN      string
+	Table    string
+	Schema   string
+	Endpoint string
+	Region   string
+}
+
+// store is an interface for administering the checkpoints stored by a specific
+// backend.
+type store interface {
+	CreateSchema(ctx context.Context) error
+	DropSchema(ctx context.Context) error
+	HandlerKeys(ctx context.Context) ([]string, error)
+	Checkpoints(ctx context.Context, key string) ([]projectionkit.Checkpoint, error)
+	SetCheckpointOffset(ctx context.Context, key, id string, offset uint64) error
+	DeleteCheckpoints(ctx context.Context, key string) error
+	ExportCheckpoints(ctx context.Context, w io.Writer) error
+	ImportCheckpoints(ctx context.Context, r io.Reader) error
+	Close() error
+}
+
+// openStore returns the store for the backend described by cfg.
+func openStore(ctx context.Context, cfg config) (store, error) {
+	switch cfg.Backend {
+	case "sqlite", "postgres", "cockroach", "mysql", "mssql":
+		return openSQLStore(cfg)
+	case "bolt":
+		return openBoltStore(cfg)
+	case "dynamodb":
+		return openDynamoStore(ctx, cfg)
+	case "":
+		return nil, fmt.Errorf("the -backend flag is required")
+	default:
+		return nil, fmt.Errorf("unrecognized backend: %q", cfg.Backend)
+	}
+}
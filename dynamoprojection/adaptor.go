@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/dogmatiq/dogma"
 	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
 	"github.com/dogmatiq/projectionkit/dynamoprojection/internal/dynamox"
 	"github.com/dogmatiq/projectionkit/internal/awsx"
 	"github.com/dogmatiq/projectionkit/internal/identity"
@@ -33,6 +35,8 @@ type adaptor struct {
 //
 // The handler stores information about the projection's checkpoint offsets in
 // the given table. Each application should have its own DynamoDB table.
+//
+// The returned handler also implements [projectionkit.CheckpointLister].
 func New(
 	client *dynamodb.Client,
 	table string,
@@ -107,6 +111,8 @@ func (a *adaptor) HandleEvent(
 
 	req.Attr.StreamID = uuidpb.MustParseAsByteArray(s.StreamID())
 	req.Attr.NextOffset.Value = a.marshalOffset(next)
+	req.Attr.UpdatedAt.Value = a.marshalTime(time.Now())
+	req.Attr.RecordedAt.Value = a.marshalTime(s.RecordedAt())
 
 	if s.CheckpointOffset() == 0 {
 		req.Transaction.TransactItems = append(req.Transaction.TransactItems, req.PutOffset)
@@ -123,21 +129,31 @@ func (a *adaptor) HandleEvent(
 	)
 
 	if isOCCConflict(err) {
-		return a.checkpointOffset(ctx, req)
+		cp, err := a.readCheckpoint(ctx, req)
+		return cp.Offset, err
 	}
 
 	return next, err
 }
 
 func (a *adaptor) CheckpointOffset(ctx context.Context, id string) (uint64, error) {
+	cp, err := a.ReadCheckpoint(ctx, id)
+	return cp.Offset, err
+}
+
+func (a *adaptor) ReadCheckpoint(ctx context.Context, id string) (projectionkit.Checkpoint, error) {
 	req := a.acquireRequests()
 	defer a.releaseRequests(req)
 
 	req.Attr.StreamID = uuidpb.MustParseAsByteArray(id)
-	return a.checkpointOffset(ctx, req)
+	return a.readCheckpoint(ctx, req)
 }
 
-func (a *adaptor) checkpointOffset(ctx context.Context, req *requests) (uint64, error) {
+func (a *adaptor) readCheckpoint(ctx context.Context, req *requests) (projectionkit.Checkpoint, error) {
+	cp := projectionkit.Checkpoint{
+		StreamID: uuidpb.FromByteArray(req.Attr.StreamID).AsString(),
+	}
+
 	out, err := awsx.Do(
 		ctx,
 		a.Client.GetItem,
@@ -148,17 +164,94 @@ func (a *adaptor) checkpointOffset(ctx context.Context, req *requests) (uint64,
 		if isTableNotFound(err) {
 			// If the table used to track offsets does not exist, we can't have
 			// handled any events yet, so the checkpoint offset is zero.
-			return 0, nil
+			return cp, nil
 		}
 
-		return 0, err
+		return cp, err
 	}
 
 	if out.Item == nil {
-		return 0, nil
+		return cp, nil
+	}
+
+	return a.unmarshalCheckpoint(out.Item)
+}
+
+func (a *adaptor) ListCheckpoints(
+	ctx context.Context,
+	after string,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	if limit <= 0 {
+		panic("limit must be positive")
+	}
+
+	var streamID []byte
+	if after != "" {
+		streamID = uuidpb.MustParseAsBytes(after)
 	}
 
-	return a.unmarshalOffset(out.Item)
+	var checkpoints []projectionkit.Checkpoint
+
+	if err := dynamox.QueryRange(
+		ctx,
+		a.Client,
+		a.OnRequest,
+		a.makeListQuery(streamID),
+		func(
+			_ context.Context,
+			item map[string]types.AttributeValue,
+		) (bool, error) {
+			cp, err := a.unmarshalCheckpoint(item)
+			if err != nil {
+				return false, err
+			}
+
+			checkpoints = append(checkpoints, cp)
+			return len(checkpoints) < limit, nil
+		},
+	); err != nil {
+		if isTableNotFound(err) {
+			// If the table used to track offsets does not exist, we can't have
+			// handled any events yet, so there are no checkpoints.
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return checkpoints, nil
+}
+
+func (a *adaptor) CountCheckpoints(ctx context.Context) (uint64, error) {
+	in := a.makeCountQuery()
+	var n uint64
+
+	for {
+		out, err := awsx.Do(
+			ctx,
+			a.Client.Query,
+			a.OnRequest,
+			in,
+		)
+		if err != nil {
+			if isTableNotFound(err) {
+				// If the table used to track offsets does not exist, we can't
+				// have handled any events yet, so there are no checkpoints.
+				return 0, nil
+			}
+
+			return 0, err
+		}
+
+		n += uint64(out.Count)
+
+		if out.LastEvaluatedKey == nil {
+			return n, nil
+		}
+
+		in.ExclusiveStartKey = out.LastEvaluatedKey
+	}
 }
 
 func (a *adaptor) Compact(ctx context.Context, s dogma.ProjectionCompactScope) error {
@@ -1,8 +1,10 @@
 package dynamoprojection_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -16,7 +18,7 @@ import (
 	. "github.com/dogmatiq/projectionkit/dynamoprojection"
 	"github.com/dogmatiq/projectionkit/dynamoprojection/internal/dynamox"
 	"github.com/dogmatiq/projectionkit/dynamoprojection/internal/fixtures" // can't dot-import due to conflict
-	"github.com/dogmatiq/projectionkit/internal/handlertest"
+	"github.com/dogmatiq/projectionkit/projectiontest"
 	"github.com/testcontainers/testcontainers-go"
 	dynamotc "github.com/testcontainers/testcontainers-go/modules/dynamodb"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -83,7 +85,7 @@ func TestAdaptor(t *testing.T) {
 
 		deps.Handler = &fixtures.MessageHandler{
 			ConfigureFunc: func(c dogma.ProjectionConfigurer) {
-				c.Identity("<projection>", handlertest.IdentityKey)
+				c.Identity("<projection>", projectiontest.IdentityKey)
 			},
 		}
 
@@ -96,10 +98,27 @@ func TestAdaptor(t *testing.T) {
 		return deps
 	}
 
-	handlertest.Run(
+	projectiontest.Run(
 		t,
-		func(t *testing.T) dogma.ProjectionMessageHandler {
-			return setup(t).Adaptor
+		func(t *testing.T, h *projectiontest.Hooks) dogma.ProjectionMessageHandler {
+			deps := setup(t)
+
+			deps.Handler.HandleEventFunc = func(
+				_ context.Context,
+				s dogma.ProjectionEventScope,
+				m dogma.Event,
+			) ([]types.TransactWriteItem, error) {
+				return nil, h.HandleEvent(s, m)
+			}
+
+			deps.Handler.ResetFunc = func(
+				_ context.Context,
+				s dogma.ProjectionResetScope,
+			) ([]types.TransactWriteItem, error) {
+				return nil, h.Reset(s)
+			}
+
+			return deps.Adaptor
 		},
 	)
 
@@ -213,4 +232,150 @@ func TestAdaptor(t *testing.T) {
 			})
 		})
 	})
+
+	t.Run("administration", func(t *testing.T) {
+		const (
+			handlerKey = projectiontest.IdentityKey
+			streamID   = "2a3b4c5d-6e7f-4a8b-9c0d-1e2f3a4b5c6d"
+		)
+
+		t.Run("it can set, list and delete checkpoints", func(t *testing.T) {
+			table := "ProjectionCheckpoint-" + uuidpb.Generate().AsString()
+
+			if err := CreateTable(t.Context(), client, table); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				if err := DeleteTable(context.Background(), client, table); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			if err := SetCheckpointOffset(t.Context(), client, table, handlerKey, streamID, 5); err != nil {
+				t.Fatal(err)
+			}
+
+			keys, err := HandlerKeys(t.Context(), client, table)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(keys) != 1 || keys[0] != handlerKey {
+				t.Fatalf("unexpected handler keys: got %v, want [%s]", keys, handlerKey)
+			}
+
+			checkpoints, err := Checkpoints(t.Context(), client, table, handlerKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(checkpoints) != 1 || checkpoints[0].StreamID != streamID || checkpoints[0].Offset != 5 {
+				t.Fatalf("unexpected checkpoints: got %+v, want %s@5", checkpoints, streamID)
+			}
+
+			if err := DeleteCheckpoints(t.Context(), client, table, handlerKey); err != nil {
+				t.Fatal(err)
+			}
+
+			checkpoints, err = Checkpoints(t.Context(), client, table, handlerKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(checkpoints) != 0 {
+				t.Fatalf("unexpected checkpoints: got %+v, want none", checkpoints)
+			}
+		})
+
+		t.Run("it deletes checkpoints that are set or imported with an offset of zero", func(t *testing.T) {
+			table := "ProjectionCheckpoint-" + uuidpb.Generate().AsString()
+			t.Cleanup(func() {
+				if err := DeleteTable(context.Background(), client, table); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			adaptor := New(
+				client,
+				table,
+				&fixtures.MessageHandler{
+					ConfigureFunc: func(c dogma.ProjectionConfigurer) {
+						c.Identity("<projection>", handlerKey)
+					},
+				},
+			)
+
+			scope := &ProjectionEventScopeStub{
+				StreamIDFunc: func() string { return streamID },
+			}
+
+			zero := []func() error{
+				func() error {
+					return SetCheckpointOffset(t.Context(), client, table, handlerKey, streamID, 0)
+				},
+				func() error {
+					input := `{"handler":"` + handlerKey + `","stream":"` + streamID + `","offset":0}` + "\n"
+					return ImportCheckpoints(t.Context(), client, table, strings.NewReader(input))
+				},
+			}
+
+			for _, fn := range zero {
+				if _, err := adaptor.HandleEvent(t.Context(), scope, EventA1); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := fn(); err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := adaptor.HandleEvent(t.Context(), scope, EventA1)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got != 1 {
+					t.Fatalf("unexpected checkpoint offset: got %d, want 1", got)
+				}
+
+				if err := SetCheckpointOffset(t.Context(), client, table, handlerKey, streamID, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+
+		t.Run("it can export and import checkpoints", func(t *testing.T) {
+			src := "ProjectionCheckpoint-" + uuidpb.Generate().AsString()
+			dst := "ProjectionCheckpoint-" + uuidpb.Generate().AsString()
+
+			for _, table := range []string{src, dst} {
+				t.Cleanup(func() {
+					if err := DeleteTable(context.Background(), client, table); err != nil {
+						t.Fatal(err)
+					}
+				})
+			}
+
+			if err := SetCheckpointOffset(t.Context(), client, src, handlerKey, streamID, 5); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := ExportCheckpoints(t.Context(), client, src, &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ImportCheckpoints(t.Context(), client, dst, &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			checkpoints, err := Checkpoints(t.Context(), client, dst, handlerKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(checkpoints) != 1 || checkpoints[0].StreamID != streamID || checkpoints[0].Offset != 5 {
+				t.Fatalf("unexpected checkpoints: got %+v, want %s@5", checkpoints, streamID)
+			}
+		})
+	})
 }
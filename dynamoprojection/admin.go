@@ -0,0 +1,343 @@
+package dynamoprojection
+
+import (
+	"context"
+	"io"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
+	"github.com/dogmatiq/projectionkit/dynamoprojection/internal/dynamox"
+	"github.com/dogmatiq/projectionkit/internal/awsx"
+)
+
+// The functions in this file are intended for inspecting and repairing the
+// checkpoints stored in a table by hand. Those that modify checkpoints must
+// not be used while the affected handlers are running.
+
+// CreateTable creates the table used to store checkpoints if it does not
+// already exist.
+//
+// It's not necessary to call CreateTable before using the handler, as the
+// table is created on demand.
+func CreateTable(ctx context.Context, client *dynamodb.Client, table string) error {
+	return createTable(ctx, client, table, nil)
+}
+
+// DeleteTable deletes the table used to store checkpoints, including the
+// checkpoints of all handlers.
+func DeleteTable(ctx context.Context, client *dynamodb.Client, table string) error {
+	return dynamox.DeleteTableIfExists(ctx, client, table, nil)
+}
+
+// HandlerKeys returns the identity keys of the handlers that have checkpoints
+// stored in the given table, in sorted order.
+func HandlerKeys(ctx context.Context, client *dynamodb.Client, table string) ([]string, error) {
+	in := &dynamodb.ScanInput{
+		TableName: &table,
+		ExpressionAttributeNames: map[string]string{
+			"#H": handlerKeyAttr,
+		},
+		ProjectionExpression: aws.String("#H"),
+	}
+
+	seen := map[string]struct{}{}
+
+	for {
+		out, err := awsx.Do(ctx, client.Scan, nil, in)
+		if err != nil {
+			if isTableNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		for _, item := range out.Items {
+			if b, ok := item[handlerKeyAttr].(*types.AttributeValueMemberB); ok {
+				if id, err := uuidpb.FromBytes(b.Value); err == nil {
+					seen[id.AsString()] = struct{}{}
+				}
+			}
+		}
+
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+
+		in.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	return keys, nil
+}
+
+// Checkpoints returns all checkpoints stored in the given table for the
+// handler with the given identity key, ordered by stream ID.
+func Checkpoints(
+	ctx context.Context,
+	client *dynamodb.Client,
+	table, key string,
+) ([]projectionkit.Checkpoint, error) {
+	a, err := newAdminAdaptor(client, table, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.ListCheckpoints(ctx, "", math.MaxInt)
+}
+
+// SetCheckpointOffset sets the checkpoint offset of a specific event stream
+// for the handler with the given identity key, regardless of its current
+// value. If offset is zero, the checkpoint is deleted.
+func SetCheckpointOffset(
+	ctx context.Context,
+	client *dynamodb.Client,
+	table, key, id string,
+	offset uint64,
+) error {
+	a, err := newAdminAdaptor(client, table, key)
+	if err != nil {
+		return err
+	}
+
+	streamID, err := uuidpb.ParseAsBytes(id)
+	if err != nil {
+		return err
+	}
+
+	return a.putCheckpointOffset(ctx, streamID, offset, time.Now())
+}
+
+// putCheckpointOffset sets the checkpoint offset of the stream with the given
+// ID, regardless of its current value, recording that it was updated at t.
+//
+// If offset is zero, the checkpoint is deleted instead, as the adaptor only
+// stores the offset of a stream's first event if there is no existing item.
+func (a *adaptor) putCheckpointOffset(
+	ctx context.Context,
+	streamID []byte,
+	offset uint64,
+	t time.Time,
+) error {
+	if err := a.createTableOnce.Do(ctx, a.createTable); err != nil {
+		return err
+	}
+
+	if offset == 0 {
+		_, err := awsx.Do(
+			ctx,
+			a.Client.DeleteItem,
+			nil,
+			&dynamodb.DeleteItemInput{
+				TableName: &a.Table,
+				Key: map[string]types.AttributeValue{
+					handlerKeyAttr: &a.handlerKeyAttr,
+					streamIDAttr:   &types.AttributeValueMemberB{Value: streamID},
+				},
+			},
+		)
+		return err
+	}
+
+	_, err := awsx.Do(
+		ctx,
+		a.Client.PutItem,
+		nil,
+		&dynamodb.PutItemInput{
+			TableName: &a.Table,
+			Item: map[string]types.AttributeValue{
+				handlerKeyAttr: &a.handlerKeyAttr,
+				streamIDAttr:   &types.AttributeValueMemberB{Value: streamID},
+				offsetAttr:     &types.AttributeValueMemberN{Value: a.marshalOffset(offset)},
+				updatedAtAttr:  &types.AttributeValueMemberN{Value: a.marshalTime(t)},
+			},
+		},
+	)
+
+	return err
+}
+
+// DeleteCheckpoints deletes all checkpoints stored in the given table for the
+// handler with the given identity key.
+//
+// Unlike resetting the handler, it does not affect the projection's data.
+func DeleteCheckpoints(
+	ctx context.Context,
+	client *dynamodb.Client,
+	table, key string,
+) error {
+	a, err := newAdminAdaptor(client, table, key)
+	if err != nil {
+		return err
+	}
+
+	req := a.acquireRequests()
+	defer a.releaseRequests(req)
+
+	var keys []map[string]types.AttributeValue
+
+	if err := dynamox.QueryRange(
+		ctx,
+		client,
+		nil,
+		&req.GetOffsets,
+		func(
+			_ context.Context,
+			item map[string]types.AttributeValue,
+		) (bool, error) {
+			keys = append(keys, map[string]types.AttributeValue{
+				handlerKeyAttr: &a.handlerKeyAttr,
+				streamIDAttr:   item[streamIDAttr],
+			})
+			return true, nil
+		},
+	); err != nil {
+		if isTableNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, k := range keys {
+		if _, err := awsx.Do(
+			ctx,
+			client.DeleteItem,
+			nil,
+			&dynamodb.DeleteItemInput{
+				TableName: &a.Table,
+				Key:       k,
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportCheckpoints writes the checkpoint offsets of all handlers stored in the
+// given table to w, in the format written by [projectionkit.CheckpointEncoder].
+func ExportCheckpoints(
+	ctx context.Context,
+	client *dynamodb.Client,
+	table string,
+	w io.Writer,
+) error {
+	enc := projectionkit.NewCheckpointEncoder(w)
+
+	keys, err := HandlerKeys(ctx, client, table)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		checkpoints, err := Checkpoints(ctx, client, table, key)
+		if err != nil {
+			return err
+		}
+
+		for _, cp := range checkpoints {
+			if err := enc.Encode(projectionkit.ExportedCheckpoint{
+				HandlerKey: key,
+				StreamID:   cp.StreamID,
+				Offset:     cp.Offset,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ImportCheckpoints reads checkpoint offsets from r, in the format written by
+// [projectionkit.CheckpointEncoder], and stores them in the given table,
+// replacing any existing checkpoint offsets for the same handlers and streams.
+//
+// The entire input is read and validated before any checkpoints are stored.
+// The checkpoints are stored individually, so a failure may leave some of them
+// imported; the import is safe to repeat. Checkpoints with an offset of zero
+// are deleted. Checkpoints that are not present in r are left unchanged.
+func ImportCheckpoints(
+	ctx context.Context,
+	client *dynamodb.Client,
+	table string,
+	r io.Reader,
+) error {
+	dec := projectionkit.NewCheckpointDecoder(r)
+
+	var checkpoints []projectionkit.ExportedCheckpoint
+
+	for {
+		cp, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		checkpoints = append(checkpoints, cp)
+	}
+
+	adaptors := map[string]*adaptor{}
+	now := time.Now()
+
+	for _, cp := range checkpoints {
+		a, ok := adaptors[cp.HandlerKey]
+		if !ok {
+			var err error
+			a, err = newAdminAdaptor(client, table, cp.HandlerKey)
+			if err != nil {
+				return err
+			}
+			adaptors[cp.HandlerKey] = a
+		}
+
+		if err := a.putCheckpointOffset(
+			ctx,
+			uuidpb.MustParseAsBytes(cp.StreamID),
+			cp.Offset,
+			now,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newAdminAdaptor returns an adaptor for the handler with the given identity
+// key, for use by the administrative functions.
+func newAdminAdaptor(
+	client *dynamodb.Client,
+	table, key string,
+) (*adaptor, error) {
+	handlerKey, err := uuidpb.ParseAsBytes(key)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &adaptor{
+		Client: client,
+		Table:  table,
+
+		handlerKeyAttr: types.AttributeValueMemberB{
+			Value: handlerKey,
+		},
+	}
+
+	a.requests.New = a.prepareRequests
+
+	return a, nil
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
 	"github.com/dogmatiq/projectionkit/dynamoprojection/internal/dynamox"
 )
 
@@ -24,6 +27,16 @@ var (
 	// offsetAttr is the name of the attribute that stores the checkpoint offset
 	// on each item.
 	offsetAttr = "O"
+
+	// updatedAtAttr is the name of the attribute that stores the time at which
+	// the checkpoint offset was last updated, as the number of nanoseconds
+	// since the Unix epoch.
+	updatedAtAttr = "U"
+
+	// eventRecordedAtAttr is the name of the attribute that stores the time at
+	// which the last applied event was recorded, as the number of nanoseconds
+	// since the Unix epoch.
+	eventRecordedAtAttr = "R"
 )
 
 type requests struct {
@@ -31,6 +44,8 @@ type requests struct {
 		StreamID   [16]byte                    // [streamIDAttr]
 		PrevOffset types.AttributeValueMemberN // [checkpointOffsetAttr]
 		NextOffset types.AttributeValueMemberN // [checkpointOffsetAttr]
+		UpdatedAt  types.AttributeValueMemberN // [updatedAtAttr]
+		RecordedAt types.AttributeValueMemberN // [eventRecordedAtAttr]
 	}
 
 	Transaction  dynamodb.TransactWriteItemsInput
@@ -42,11 +57,22 @@ type requests struct {
 }
 
 func (a *adaptor) createTable(ctx context.Context) error {
+	return createTable(ctx, a.Client, a.Table, a.OnRequest)
+}
+
+// createTable creates the table used to store checkpoints if it does not
+// already exist.
+func createTable(
+	ctx context.Context,
+	client *dynamodb.Client,
+	table string,
+	onRequest func(any) []func(*dynamodb.Options),
+) error {
 	return dynamox.CreateTableIfNotExists(
 		ctx,
-		a.Client,
-		a.Table,
-		a.OnRequest,
+		client,
+		table,
+		onRequest,
 		dynamox.KeyAttr{
 			Name:    &handlerKeyAttr,
 			Type:    types.ScalarAttributeTypeB,
@@ -85,9 +111,11 @@ func (a *adaptor) prepareRequests() any {
 				"#H": handlerKeyAttr,
 			},
 			Item: map[string]types.AttributeValue{
-				handlerKeyAttr: &a.handlerKeyAttr,
-				streamIDAttr:   &types.AttributeValueMemberB{Value: req.Attr.StreamID[:]},
-				offsetAttr:     &req.Attr.NextOffset,
+				handlerKeyAttr:      &a.handlerKeyAttr,
+				streamIDAttr:        &types.AttributeValueMemberB{Value: req.Attr.StreamID[:]},
+				offsetAttr:          &req.Attr.NextOffset,
+				updatedAtAttr:       &req.Attr.UpdatedAt,
+				eventRecordedAtAttr: &req.Attr.RecordedAt,
 			},
 
 			// Fail if the record exists so we can detect an OCC conflict.
@@ -104,12 +132,16 @@ func (a *adaptor) prepareRequests() any {
 			},
 			ExpressionAttributeNames: map[string]string{
 				"#O": offsetAttr,
+				"#U": updatedAtAttr,
+				"#R": eventRecordedAtAttr,
 			},
 			ExpressionAttributeValues: map[string]types.AttributeValue{
 				":P": &req.Attr.PrevOffset,
 				":N": &req.Attr.NextOffset,
+				":U": &req.Attr.UpdatedAt,
+				":R": &req.Attr.RecordedAt,
 			},
-			UpdateExpression: aws.String(`SET #O = :N`),
+			UpdateExpression: aws.String(`SET #O = :N, #U = :U, #R = :R`),
 
 			// Fail if the record does not exist, or exists with a different
 			// checkpoint offset, so we can detect an OCC conflict.
@@ -154,6 +186,106 @@ func (a *adaptor) makeDeleteOperation(item map[string]types.AttributeValue) type
 	}
 }
 
+// makeListQuery returns a query that lists the checkpoints for streams with IDs
+// that sort after the given stream ID, or from the beginning if after is nil.
+func (a *adaptor) makeListQuery(after []byte) *dynamodb.QueryInput {
+	in := &dynamodb.QueryInput{
+		TableName:              &a.Table,
+		KeyConditionExpression: aws.String("#H = :H"),
+		ExpressionAttributeNames: map[string]string{
+			"#H": handlerKeyAttr,
+			"#S": streamIDAttr,
+			"#O": offsetAttr,
+			"#U": updatedAtAttr,
+			"#R": eventRecordedAtAttr,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":H": &a.handlerKeyAttr,
+		},
+		ProjectionExpression: aws.String("#S, #O, #U, #R"),
+	}
+
+	if after != nil {
+		in.ExclusiveStartKey = map[string]types.AttributeValue{
+			handlerKeyAttr: &a.handlerKeyAttr,
+			streamIDAttr:   &types.AttributeValueMemberB{Value: after},
+		}
+	}
+
+	return in
+}
+
+// makeCountQuery returns a query that counts the checkpoints.
+func (a *adaptor) makeCountQuery() *dynamodb.QueryInput {
+	return &dynamodb.QueryInput{
+		TableName:              &a.Table,
+		KeyConditionExpression: aws.String("#H = :H"),
+		ExpressionAttributeNames: map[string]string{
+			"#H": handlerKeyAttr,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":H": &a.handlerKeyAttr,
+		},
+		Select: types.SelectCount,
+	}
+}
+
+// unmarshalCheckpoint returns the checkpoint represented by item.
+func (a *adaptor) unmarshalCheckpoint(item map[string]types.AttributeValue) (projectionkit.Checkpoint, error) {
+	var (
+		cp  projectionkit.Checkpoint
+		err error
+	)
+
+	if cp.StreamID, err = a.unmarshalStreamID(item); err != nil {
+		return cp, err
+	}
+
+	if cp.Offset, err = a.unmarshalOffset(item); err != nil {
+		return cp, err
+	}
+
+	if cp.UpdatedAt, err = a.unmarshalTime(item, updatedAtAttr); err != nil {
+		return cp, err
+	}
+
+	cp.EventRecordedAt, err = a.unmarshalTime(item, eventRecordedAtAttr)
+	return cp, err
+}
+
+func (a *adaptor) unmarshalStreamID(item map[string]types.AttributeValue) (string, error) {
+	s, ok := item[streamIDAttr]
+	if !ok {
+		return "", fmt.Errorf(
+			"%q table is missing %q attribute",
+			a.Table,
+			streamIDAttr,
+		)
+	}
+
+	b, ok := s.(*types.AttributeValueMemberB)
+	if !ok {
+		return "", fmt.Errorf(
+			"%q table is has invalid %q attribute: expected binary type, got %T",
+			a.Table,
+			streamIDAttr,
+			s,
+		)
+	}
+
+	id, err := uuidpb.FromBytes(b.Value)
+	if err != nil {
+		return "", fmt.Errorf(
+			"%q table has invalid %q attribute: %w",
+			a.Table,
+			streamIDAttr,
+			err,
+		)
+	}
+
+	return id.AsString(), nil
+}
+
 func (a *adaptor) marshalOffset(cp uint64) string {
 	return strconv.FormatUint(cp, 10)
 }
@@ -190,3 +322,47 @@ func (a *adaptor) unmarshalOffset(item map[string]types.AttributeValue) (uint64,
 
 	return cp, nil
 }
+
+func (a *adaptor) marshalTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// unmarshalTime returns the time stored in the given attribute of item.
+//
+// It returns the zero time if the attribute is not present, which is the case
+// for items written by earlier versions.
+func (a *adaptor) unmarshalTime(item map[string]types.AttributeValue, attr string) (time.Time, error) {
+	s, ok := item[attr]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	n, ok := s.(*types.AttributeValueMemberN)
+	if !ok {
+		return time.Time{}, fmt.Errorf(
+			"%q table is has invalid %q attribute: expected number type, got %T",
+			a.Table,
+			attr,
+			s,
+		)
+	}
+
+	v, err := strconv.ParseInt(n.Value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(
+			"%q table has invalid %q attribute: %w",
+			a.Table,
+			attr,
+			err,
+		)
+	}
+
+	if v == 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(0, v), nil
+}
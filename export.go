@@ -0,0 +1,114 @@
+package projectionkit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+)
+
+// ExportedCheckpoint is the checkpoint offset of a specific handler and event
+// stream, in a form that is independent of the storage backend.
+//
+// It's used to move checkpoints between backends. The time at which the
+// checkpoint was updated and the time at which the last event was recorded are
+// not included.
+type ExportedCheckpoint struct {
+	// HandlerKey is the identity key of the handler.
+	HandlerKey string `json:"handler"`
+
+	// StreamID is the RFC 9562 UUID that identifies the event stream.
+	StreamID string `json:"stream"`
+
+	// Offset is the offset at which the handler expects to resume handling
+	// events from the stream.
+	Offset uint64 `json:"offset"`
+}
+
+// CheckpointEncoder writes checkpoints in the portable export format, which
+// consists of one JSON object per line.
+type CheckpointEncoder struct {
+	w io.Writer
+}
+
+// NewCheckpointEncoder returns a [CheckpointEncoder] that writes to w.
+func NewCheckpointEncoder(w io.Writer) *CheckpointEncoder {
+	return &CheckpointEncoder{w}
+}
+
+// Encode writes a single checkpoint.
+func (e *CheckpointEncoder) Encode(cp ExportedCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+// CheckpointDecoder reads checkpoints in the portable export format written by
+// [CheckpointEncoder].
+type CheckpointDecoder struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// NewCheckpointDecoder returns a [CheckpointDecoder] that reads from r.
+func NewCheckpointDecoder(r io.Reader) *CheckpointDecoder {
+	return &CheckpointDecoder{s: bufio.NewScanner(r)}
+}
+
+// Decode reads the next checkpoint.
+//
+// It returns [io.EOF] if there are no more checkpoints. Blank lines are
+// ignored. The handler key and stream ID are returned in their canonical form.
+func (d *CheckpointDecoder) Decode() (ExportedCheckpoint, error) {
+	for d.s.Scan() {
+		d.line++
+
+		data := bytes.TrimSpace(d.s.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		cp, err := unmarshalExportedCheckpoint(data)
+		if err != nil {
+			return ExportedCheckpoint{}, fmt.Errorf("line %d: %w", d.line, err)
+		}
+
+		return cp, nil
+	}
+
+	if err := d.s.Err(); err != nil {
+		return ExportedCheckpoint{}, err
+	}
+
+	return ExportedCheckpoint{}, io.EOF
+}
+
+// unmarshalExportedCheckpoint parses and validates a single checkpoint.
+func unmarshalExportedCheckpoint(data []byte) (ExportedCheckpoint, error) {
+	var cp ExportedCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return ExportedCheckpoint{}, err
+	}
+
+	key, err := uuidpb.Parse(cp.HandlerKey)
+	if err != nil {
+		return ExportedCheckpoint{}, fmt.Errorf("invalid handler key: %w", err)
+	}
+
+	id, err := uuidpb.Parse(cp.StreamID)
+	if err != nil {
+		return ExportedCheckpoint{}, fmt.Errorf("invalid stream ID: %w", err)
+	}
+
+	cp.HandlerKey = key.AsString()
+	cp.StreamID = id.AsString()
+
+	return cp, nil
+}
@@ -0,0 +1,117 @@
+package projectionkit_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	. "github.com/dogmatiq/projectionkit"
+)
+
+func TestCheckpointDecoder(t *testing.T) {
+	t.Run("it decodes checkpoints written by the encoder", func(t *testing.T) {
+		want := []ExportedCheckpoint{
+			{
+				HandlerKey: "1b0d6c2a-9f7e-4c5d-8b3a-2e1f0d9c8b7a",
+				StreamID:   "2a3b4c5d-6e7f-4a8b-9c0d-1e2f3a4b5c6d",
+				Offset:     1,
+			},
+			{
+				HandlerKey: "9e8d7c6b-5a4f-4e3d-a2c1-b0a9f8e7d6c5",
+				StreamID:   "7d6c5b4a-3f2e-4d1c-8b0a-9f8e7d6c5b4a",
+				Offset:     18446744073709551615,
+			},
+		}
+
+		var buf bytes.Buffer
+		enc := NewCheckpointEncoder(&buf)
+
+		for _, cp := range want {
+			if err := enc.Encode(cp); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		dec := NewCheckpointDecoder(&buf)
+
+		for _, w := range want {
+			got, err := dec.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != w {
+				t.Fatalf("unexpected checkpoint: got %+v, want %+v", got, w)
+			}
+		}
+
+		if _, err := dec.Decode(); err != io.EOF {
+			t.Fatalf("unexpected error: got %v, want %v", err, io.EOF)
+		}
+	})
+
+	t.Run("it ignores blank lines", func(t *testing.T) {
+		dec := NewCheckpointDecoder(strings.NewReader(
+			"\n" +
+				`{"handler":"1b0d6c2a-9f7e-4c5d-8b3a-2e1f0d9c8b7a","stream":"2a3b4c5d-6e7f-4a8b-9c0d-1e2f3a4b5c6d","offset":1}` +
+				"\n  \n",
+		))
+
+		if _, err := dec.Decode(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := dec.Decode(); err != io.EOF {
+			t.Fatalf("unexpected error: got %v, want %v", err, io.EOF)
+		}
+	})
+
+	t.Run("it returns the canonical form of each UUID", func(t *testing.T) {
+		dec := NewCheckpointDecoder(strings.NewReader(
+			`{"handler":"1B0D6C2A-9F7E-4C5D-8B3A-2E1F0D9C8B7A","stream":"2A3B4C5D-6E7F-4A8B-9C0D-1E2F3A4B5C6D","offset":1}`,
+		))
+
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := ExportedCheckpoint{
+			HandlerKey: "1b0d6c2a-9f7e-4c5d-8b3a-2e1f0d9c8b7a",
+			StreamID:   "2a3b4c5d-6e7f-4a8b-9c0d-1e2f3a4b5c6d",
+			Offset:     1,
+		}
+
+		if got != want {
+			t.Fatalf("unexpected checkpoint: got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("it returns an error that includes the line number", func(t *testing.T) {
+		cases := []struct {
+			Desc  string
+			Input string
+		}{
+			{"malformed JSON", `{`},
+			{"invalid handler key", `{"handler":"<invalid>","stream":"2a3b4c5d-6e7f-4a8b-9c0d-1e2f3a4b5c6d","offset":1}`},
+			{"missing stream ID", `{"handler":"1b0d6c2a-9f7e-4c5d-8b3a-2e1f0d9c8b7a","offset":1}`},
+			{"negative offset", `{"handler":"1b0d6c2a-9f7e-4c5d-8b3a-2e1f0d9c8b7a","stream":"2a3b4c5d-6e7f-4a8b-9c0d-1e2f3a4b5c6d","offset":-1}`},
+		}
+
+		for _, c := range cases {
+			t.Run(c.Desc, func(t *testing.T) {
+				dec := NewCheckpointDecoder(strings.NewReader("\n" + c.Input + "\n"))
+
+				_, err := dec.Decode()
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				if !strings.HasPrefix(err.Error(), "line 2: ") {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			})
+		}
+	})
+}
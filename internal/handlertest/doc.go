@@ -1,3 +0,0 @@
-// Package handlertest contains a common test suite for all handler
-// implementations.
-package handlertest
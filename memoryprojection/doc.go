@@ -1,6 +1,9 @@
 // Package memoryprojection provides utilities for building in-memory
 // projections.
 //
-// Memory projections do not persist any state, and therefore may only be useful
-// for testing or with an event-sourcing engine.
+// Memory projections do not persist any state by themselves, and therefore may
+// only be useful for testing or with an event-sourcing engine. A projection's
+// state may be saved to and restored from a snapshot, allowing it to resume
+// from its saved checkpoints after a restart. Subscribers may be notified each
+// time the projection changes.
 package memoryprojection
@@ -0,0 +1,105 @@
+package memoryprojection
+
+import (
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
+	"github.com/dogmatiq/projectionkit/internal/identity"
+)
+
+// ExportCheckpoints writes the projection's checkpoint offsets to w, in the
+// format written by [projectionkit.CheckpointEncoder].
+//
+// Unlike [Projection.Snapshot], it does not include the projection's value.
+func (p *Projection[T, H]) ExportCheckpoints(w io.Writer) error {
+	key := p.handlerKey()
+
+	p.m.RLock()
+	checkpoints := make([]projectionkit.ExportedCheckpoint, 0, len(p.checkpoints))
+	for _, id := range slices.Sorted(maps.Keys(p.checkpoints)) {
+		checkpoints = append(checkpoints, projectionkit.ExportedCheckpoint{
+			HandlerKey: key,
+			StreamID:   id,
+			Offset:     p.checkpoints[id].Offset,
+		})
+	}
+	p.m.RUnlock()
+
+	enc := projectionkit.NewCheckpointEncoder(w)
+
+	for _, cp := range checkpoints {
+		if err := enc.Encode(cp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportCheckpoints reads checkpoint offsets from r, in the format written by
+// [projectionkit.CheckpointEncoder], replacing the projection's existing
+// checkpoint offsets for the same streams.
+//
+// Checkpoints for other handlers are ignored. Checkpoints with an offset of
+// zero are deleted. Checkpoints that are not present in r are left unchanged.
+// The projection is left unchanged if r can not be read. The projection's
+// value is not affected, and subscribers are not notified.
+func (p *Projection[T, H]) ImportCheckpoints(r io.Reader) error {
+	key := p.handlerKey()
+	dec := projectionkit.NewCheckpointDecoder(r)
+
+	var checkpoints []projectionkit.ExportedCheckpoint
+
+	for {
+		cp, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if cp.HandlerKey == key {
+			checkpoints = append(checkpoints, cp)
+		}
+	}
+
+	if len(checkpoints) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	for _, cp := range checkpoints {
+		if cp.Offset == 0 {
+			delete(p.checkpoints, cp.StreamID)
+			continue
+		}
+
+		if p.checkpoints == nil {
+			p.checkpoints = map[string]projectionkit.Checkpoint{}
+		}
+
+		p.checkpoints[cp.StreamID] = projectionkit.Checkpoint{
+			StreamID:  cp.StreamID,
+			Offset:    cp.Offset,
+			UpdatedAt: now,
+		}
+	}
+
+	p.version++
+
+	return nil
+}
+
+// handlerKey returns the canonical form of the handler's identity key.
+func (p *Projection[T, H]) handlerKey() string {
+	return uuidpb.FromByteArray(identity.Key(p.Handler)).AsString()
+}
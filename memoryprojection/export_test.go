@@ -0,0 +1,141 @@
+package memoryprojection_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dogmatiq/dogma"
+	. "github.com/dogmatiq/enginekit/enginetest/stubs"
+	"github.com/dogmatiq/projectionkit"
+	. "github.com/dogmatiq/projectionkit/memoryprojection"
+	"github.com/dogmatiq/projectionkit/memoryprojection/internal/fixtures" // can't dot-import due to conflict
+	"github.com/dogmatiq/projectionkit/projectiontest"
+)
+
+func TestProjection_checkpointExport(t *testing.T) {
+	type projection = Projection[int, *fixtures.MessageHandler[int]]
+
+	newProjection := func() *projection {
+		return &projection{
+			Handler: &fixtures.MessageHandler[int]{
+				ConfigureFunc: func(c dogma.ProjectionConfigurer) {
+					c.Identity("<projection>", projectiontest.IdentityKey)
+				},
+			},
+		}
+	}
+
+	streamID := (&ProjectionEventScopeStub{}).StreamID()
+
+	offset := func(t *testing.T, p *projection) uint64 {
+		t.Helper()
+
+		cp, err := p.CheckpointOffset(t.Context(), streamID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return cp
+	}
+
+	t.Run("it imports the checkpoints written by ExportCheckpoints()", func(t *testing.T) {
+		src := newProjection()
+
+		for offset := range uint64(3) {
+			if _, err := src.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{
+					OffsetFunc:           func() uint64 { return offset },
+					CheckpointOffsetFunc: func() uint64 { return offset },
+				},
+				EventA1,
+			); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := src.ExportCheckpoints(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		cp, err := projectionkit.NewCheckpointDecoder(bytes.NewReader(buf.Bytes())).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := projectionkit.ExportedCheckpoint{
+			HandlerKey: projectiontest.IdentityKey,
+			StreamID:   streamID,
+			Offset:     3,
+		}
+
+		if cp != want {
+			t.Fatalf("unexpected exported checkpoint: got %+v, want %+v", cp, want)
+		}
+
+		dst := newProjection()
+		if err := dst.ImportCheckpoints(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := offset(t, dst); got != 3 {
+			t.Fatalf("unexpected checkpoint offset: got %d, want 3", got)
+		}
+	})
+
+	t.Run("it deletes checkpoints imported with an offset of zero", func(t *testing.T) {
+		p := newProjection()
+
+		if err := p.ImportCheckpoints(strings.NewReader(
+			`{"handler":"` + projectiontest.IdentityKey + `","stream":"` + streamID + `","offset":5}`,
+		)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := p.ImportCheckpoints(strings.NewReader(
+			`{"handler":"` + projectiontest.IdentityKey + `","stream":"` + streamID + `","offset":0}`,
+		)); err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := p.CountCheckpoints(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n != 0 {
+			t.Fatalf("unexpected number of checkpoints: got %d, want 0", n)
+		}
+	})
+
+	t.Run("it ignores the checkpoints of other handlers", func(t *testing.T) {
+		p := newProjection()
+
+		if err := p.ImportCheckpoints(strings.NewReader(
+			`{"handler":"26b4d1ee-c7d9-4ba2-a4d0-cc1c4d5b3a6e","stream":"` + streamID + `","offset":5}`,
+		)); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := offset(t, p); got != 0 {
+			t.Fatalf("unexpected checkpoint offset: got %d, want 0", got)
+		}
+	})
+
+	t.Run("it leaves the checkpoints unchanged if the input is invalid", func(t *testing.T) {
+		p := newProjection()
+
+		if err := p.ImportCheckpoints(strings.NewReader(
+			`{"handler":"` + projectiontest.IdentityKey + `","stream":"` + streamID + `","offset":5}` + "\n" +
+				`{"handler":"<invalid>"}`,
+		)); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		if got := offset(t, p); got != 0 {
+			t.Fatalf("unexpected checkpoint offset: got %d, want 0", got)
+		}
+	})
+}
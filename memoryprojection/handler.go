@@ -15,6 +15,16 @@ type MessageHandler[T any] interface {
 	// produce the same configuration each time it's called.
 	Configure(c dogma.ProjectionConfigurer)
 
+	// Initial returns the value of a projection to which no events have been
+	// applied.
+	//
+	// It's called before the first event is applied, or when the projection is
+	// queried before any events have been applied. Implementations of Reset
+	// typically return a new initial value.
+	//
+	// Embed [NoInitialBehavior] in the handler to use the zero value of T.
+	Initial() T
+
 	// HandleEvent updates the projection to reflect the occurrence of a
 	// [dogma.Event]. It may do so by modifying v in-place then returning it, or
 	// by returning an entirely new value.
@@ -24,6 +34,29 @@ type MessageHandler[T any] interface {
 	// It may do so by modifying v in-place then returning it, or by returning
 	// an entirely new value.
 	Compact(v T, s dogma.ProjectionCompactScope) T
+
+	// Reset clears all projection data.
+	//
+	// It may release any resources held by v. It returns the projection's
+	// value after it has been reset, which is typically the result of Initial.
+	// If it returns an error, the projection's value and checkpoints are left
+	// unchanged.
+	//
+	// Not all projections can be reset. Embed [NoResetBehavior] in the handler
+	// to indicate that reset is not supported.
+	Reset(v T, s dogma.ProjectionResetScope) (T, error)
+}
+
+// NoInitialBehavior can be embedded in MessageHandler implementations to
+// indicate that the initial value of the projection is the zero value of T.
+//
+// It provides an implementation of MessageHandler.Initial() that returns the
+// zero value.
+type NoInitialBehavior[T any] struct{}
+
+// Initial returns the zero value of T.
+func (NoInitialBehavior[T]) Initial() (v T) {
+	return v
 }
 
 // NoCompactBehavior can be embedded in MessageHandler implementations to
@@ -36,3 +69,15 @@ type NoCompactBehavior[T any] struct{}
 func (NoCompactBehavior[T]) Compact(v T, _ dogma.ProjectionCompactScope) T {
 	return v
 }
+
+// NoResetBehavior is an embeddable type for [MessageHandler] implementations
+// that don't support resetting their state.
+//
+// Embed this type in a [MessageHandler] when resetting projection data isn't
+// feasible or required.
+type NoResetBehavior[T any] struct{}
+
+// Reset returns an error indicating that reset is not supported.
+func (NoResetBehavior[T]) Reset(v T, _ dogma.ProjectionResetScope) (T, error) {
+	return v, dogma.ErrNotSupported
+}
@@ -7,6 +7,14 @@ import (
 	. "github.com/dogmatiq/projectionkit/memoryprojection"
 )
 
+func TestNoInitialBehavior(t *testing.T) {
+	var v NoInitialBehavior[map[string]int]
+
+	if value := v.Initial(); value != nil {
+		t.Fatalf("unexpected value: got %v, want nil", value)
+	}
+}
+
 func TestNoCompactBehavior(t *testing.T) {
 	var v NoCompactBehavior[int]
 
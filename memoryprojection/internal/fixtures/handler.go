@@ -9,6 +9,8 @@ type MessageHandler[T any] struct {
 	ConfigureFunc   func(dogma.ProjectionConfigurer)
 	HandleEventFunc func(T, dogma.ProjectionEventScope, dogma.Event) (T, error)
 	CompactFunc     func(T, dogma.ProjectionCompactScope) T
+	InitialFunc     func() T
+	ResetFunc       func(T, dogma.ProjectionResetScope) (T, error)
 }
 
 // Configure configures the behavior of the engine as it relates to this
@@ -50,3 +52,27 @@ func (h *MessageHandler[T]) Compact(v T, s dogma.ProjectionCompactScope) T {
 	}
 	return v
 }
+
+// Initial returns the value of a projection to which no events have been
+// applied.
+//
+// If h.InitialFunc is non-nil, it returns h.InitialFunc(). Otherwise, it
+// returns the zero value of T.
+func (h *MessageHandler[T]) Initial() T {
+	if h != nil && h.InitialFunc != nil {
+		return h.InitialFunc()
+	}
+	var zero T
+	return zero
+}
+
+// Reset clears all projection data.
+//
+// If h.ResetFunc is non-nil, it returns h.ResetFunc(v, s). Otherwise, it
+// returns h.Initial().
+func (h *MessageHandler[T]) Reset(v T, s dogma.ProjectionResetScope) (T, error) {
+	if h != nil && h.ResetFunc != nil {
+		return h.ResetFunc(v, s)
+	}
+	return h.Initial(), nil
+}
@@ -2,18 +2,61 @@ package memoryprojection
 
 import (
 	"context"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dogmatiq/dogma"
+	"github.com/dogmatiq/projectionkit"
 )
 
 // Projection is an in-memory projection that builds a value of type T.
+//
+// It implements [projectionkit.CheckpointLister]. Use [Projection.Snapshot] and
+// [Projection.Restore] to retain the projection's state across restarts.
+//
+// By default, queries and events are serialized by a read-write mutex, such
+// that a long-running query delays the handling of events, and vice versa. If
+// Clone is set the projection instead operates in copy-on-write mode, in which
+// each change produces a new immutable version of the value, and queries never
+// block event handling.
+//
+// Use [Projection.Subscribe] to be notified when the projection changes.
 type Projection[T any, H MessageHandler[T]] struct {
 	Handler H
 
+	// Codec is the codec used to encode the projection's value within
+	// snapshots. If it's nil, [JSONCodec] is used.
+	Codec Codec[T]
+
+	// Clone returns a deep copy of a value, such that modifying the copy
+	// does not affect the original.
+	//
+	// If it's non-nil, the projection operates in copy-on-write mode. The
+	// handler is always passed a clone of the current value, and the value it
+	// returns is published atomically once the change is complete. It must
+	// not be changed once the projection is in use.
+	Clone func(T) T
+
 	m           sync.RWMutex
-	checkpoints map[string]uint64
+	checkpoints map[string]projectionkit.Checkpoint
 	value       T
+
+	// initialized is true once value has been set, either to the handler's
+	// initial value or to a value produced by the handler.
+	initialized bool
+
+	// version is incremented each time the value or checkpoints change.
+	version uint64
+
+	// published is the most recent version of the value, if the projection is
+	// in copy-on-write mode. It's nil until the value has been initialized.
+	published atomic.Pointer[T]
+
+	// subs is the set of subscriptions to changes made to the projection.
+	subs subscribers
 }
 
 // Query queries a value of type T to produce a result of type R.
@@ -21,8 +64,25 @@ type Projection[T any, H MessageHandler[T]] struct {
 // q is called with the current value, which may be read within the lifetime of
 // the call to fn. fn MUST NOT retain a reference to the value after the call
 // returns. fn MUST NOT modify the value.
+//
+// If the projection is in copy-on-write mode, q does not block the handling of
+// events, and it may retain the value after the call returns, as it's never
+// modified.
 func Query[T, R any, H MessageHandler[T]](p *Projection[T, H], q func(T) R) R {
+	if p.Clone != nil {
+		return q(p.current())
+	}
+
 	p.m.RLock()
+
+	if !p.initialized {
+		p.m.RUnlock()
+		p.m.Lock()
+		p.initialize()
+		p.m.Unlock()
+		p.m.RLock()
+	}
+
 	defer p.m.RUnlock()
 
 	return q(p.value)
@@ -36,32 +96,50 @@ func (p *Projection[T, H]) Configure(c dogma.ProjectionConfigurer) {
 
 // HandleEvent updates the projection to reflect the occurrence of an event.
 func (p *Projection[T, H]) HandleEvent(
-	_ context.Context,
+	ctx context.Context,
 	s dogma.ProjectionEventScope,
 	m dogma.Event,
 ) (uint64, error) {
+	// The change is delivered to subscribers after p.m is unlocked.
+	var change *pendingChange
+	defer func() { p.subs.deliver(ctx, change) }()
+
 	p.m.Lock()
 	defer p.m.Unlock()
 
 	id := s.StreamID()
-	cp := p.checkpoints[id]
+	cp := p.checkpoints[id].Offset
 
 	if s.CheckpointOffset() != cp {
 		return cp, nil
 	}
 
-	value, err := p.Handler.HandleEvent(p.value, s, m)
+	p.initialize()
+
+	value, err := p.Handler.HandleEvent(p.writable(), s, m)
 	if err != nil {
 		return 0, err
 	}
 
 	if p.checkpoints == nil {
-		p.checkpoints = map[string]uint64{}
+		p.checkpoints = map[string]projectionkit.Checkpoint{}
 	}
 
 	cp = s.Offset() + 1
-	p.checkpoints[id] = cp
-	p.value = value
+	p.checkpoints[id] = projectionkit.Checkpoint{
+		StreamID:        id,
+		Offset:          cp,
+		UpdatedAt:       time.Now(),
+		EventRecordedAt: s.RecordedAt(),
+	}
+	p.setValue(value)
+	p.version++
+
+	change = p.subs.prepare(Change{
+		Kind:     HandleEventChange,
+		StreamID: id,
+		Offset:   cp,
+	})
 
 	return cp, nil
 }
@@ -72,31 +150,155 @@ func (p *Projection[T, H]) CheckpointOffset(_ context.Context, id string) (uint6
 	p.m.RLock()
 	defer p.m.RUnlock()
 
-	return p.checkpoints[id], nil
+	return p.checkpoints[id].Offset, nil
+}
+
+// ReadCheckpoint returns the checkpoint for a specific event stream.
+func (p *Projection[T, H]) ReadCheckpoint(_ context.Context, id string) (projectionkit.Checkpoint, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if cp, ok := p.checkpoints[id]; ok {
+		return cp, nil
+	}
 
+	return projectionkit.Checkpoint{StreamID: id}, nil
+}
+
+// ListCheckpoints returns up to limit checkpoints, ordered by stream ID,
+// for streams with IDs that sort after the given stream ID.
+func (p *Projection[T, H]) ListCheckpoints(
+	_ context.Context,
+	after string,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	if limit <= 0 {
+		panic("limit must be positive")
+	}
+
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	var checkpoints []projectionkit.Checkpoint
+
+	for _, id := range slices.Sorted(maps.Keys(p.checkpoints)) {
+		if id <= after {
+			continue
+		}
+
+		if len(checkpoints) == limit {
+			break
+		}
+
+		checkpoints = append(checkpoints, p.checkpoints[id])
+	}
+
+	return checkpoints, nil
+}
+
+// CountCheckpoints returns the number of event streams for which there is a
+// checkpoint.
+func (p *Projection[T, H]) CountCheckpoints(context.Context) (uint64, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return uint64(len(p.checkpoints)), nil
 }
 
 // Compact reduces the size of the projection's data.
-func (p *Projection[T, H]) Compact(_ context.Context, s dogma.ProjectionCompactScope) error {
+func (p *Projection[T, H]) Compact(ctx context.Context, s dogma.ProjectionCompactScope) error {
+	var change *pendingChange
+	defer func() { p.subs.deliver(ctx, change) }()
+
 	p.m.Lock()
 	defer p.m.Unlock()
 
 	if p.checkpoints != nil {
 		// Only attempt to compact the value if some events have been applied.
-		p.value = p.Handler.Compact(p.value, s)
+		p.setValue(p.Handler.Compact(p.writable(), s))
+		p.version++
+		change = p.subs.prepare(Change{Kind: CompactChange})
 	}
 
 	return nil
 }
 
 // Reset resets the projection to its initial state.
-func (p *Projection[T, H]) Reset(context.Context, dogma.ProjectionResetScope) error {
+//
+// It replaces the projection's value with the value returned by the handler's
+// Reset() method and discards all checkpoints. The projection is left
+// unchanged if the handler returns an error.
+func (p *Projection[T, H]) Reset(ctx context.Context, s dogma.ProjectionResetScope) error {
+	var change *pendingChange
+	defer func() { p.subs.deliver(ctx, change) }()
+
 	p.m.Lock()
 	defer p.m.Unlock()
 
+	p.initialize()
+
+	value, err := p.Handler.Reset(p.writable(), s)
+	if err != nil {
+		return err
+	}
+
 	p.checkpoints = nil
-	var zero T
-	p.value = zero
+	p.setValue(value)
+	p.version++
+	change = p.subs.prepare(Change{Kind: ResetChange})
 
 	return nil
 }
+
+// initialize sets the projection's value to the handler's initial value if it
+// has not already been set.
+//
+// p.m must be locked for writing.
+func (p *Projection[T, H]) initialize() {
+	if !p.initialized {
+		p.setValue(p.Handler.Initial())
+		p.initialized = true
+	}
+}
+
+// setValue sets the projection's value, publishing it if the projection is in
+// copy-on-write mode.
+//
+// p.m must be locked for writing.
+func (p *Projection[T, H]) setValue(v T) {
+	p.value = v
+
+	if p.Clone != nil {
+		p.published.Store(&v)
+	}
+}
+
+// writable returns the value to pass to the handler when applying a change.
+//
+// In copy-on-write mode it returns a clone of the value, so that the published
+// version is not modified.
+//
+// p.m must be locked for writing.
+func (p *Projection[T, H]) writable() T {
+	if p.Clone != nil {
+		return p.Clone(p.value)
+	}
+	return p.value
+}
+
+// current returns the most recently published version of the value,
+// initializing it if necessary.
+//
+// It must only be called if the projection is in copy-on-write mode.
+func (p *Projection[T, H]) current() T {
+	if v := p.published.Load(); v != nil {
+		return *v
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.initialize()
+
+	return p.value
+}
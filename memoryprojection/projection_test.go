@@ -1,15 +1,18 @@
 package memoryprojection_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"maps"
 	"testing"
 
 	"github.com/dogmatiq/dogma"
 	. "github.com/dogmatiq/enginekit/enginetest/stubs"
-	"github.com/dogmatiq/projectionkit/internal/handlertest"
 	"github.com/dogmatiq/projectionkit/memoryprojection"
 	. "github.com/dogmatiq/projectionkit/memoryprojection"
 	"github.com/dogmatiq/projectionkit/memoryprojection/internal/fixtures" // can't dot-import due to conflict
+	"github.com/dogmatiq/projectionkit/projectiontest"
 )
 
 func TestProjection(t *testing.T) {
@@ -21,7 +24,7 @@ func TestProjection(t *testing.T) {
 
 		deps.Handler = &fixtures.MessageHandler[int]{
 			ConfigureFunc: func(c dogma.ProjectionConfigurer) {
-				c.Identity("<projection>", handlertest.IdentityKey)
+				c.Identity("<projection>", projectiontest.IdentityKey)
 			},
 		}
 
@@ -32,10 +35,27 @@ func TestProjection(t *testing.T) {
 		return deps
 	}
 
-	handlertest.Run(
+	projectiontest.Run(
 		t,
-		func(t *testing.T) dogma.ProjectionMessageHandler {
-			return setup(t).Adaptor
+		func(t *testing.T, h *projectiontest.Hooks) dogma.ProjectionMessageHandler {
+			deps := setup(t)
+
+			deps.Handler.HandleEventFunc = func(
+				v int,
+				s dogma.ProjectionEventScope,
+				m dogma.Event,
+			) (int, error) {
+				return v, h.HandleEvent(s, m)
+			}
+
+			deps.Handler.ResetFunc = func(
+				_ int,
+				s dogma.ProjectionResetScope,
+			) (int, error) {
+				return 0, h.Reset(s)
+			}
+
+			return deps.Adaptor
 		},
 	)
 
@@ -80,6 +100,50 @@ func TestProjection(t *testing.T) {
 					t.Fatal("expected handler to be called")
 				}
 			})
+
+			t.Run("it forwards the handler's initial value to the handler", func(t *testing.T) {
+				deps := setup(t)
+
+				initialCalls := 0
+				deps.Handler.InitialFunc = func() int {
+					initialCalls++
+					return 100
+				}
+
+				deps.Handler.HandleEventFunc = func(
+					v int,
+					_ dogma.ProjectionEventScope,
+					_ dogma.Event,
+				) (int, error) {
+					return v + 1, nil
+				}
+
+				for offset := range uint64(2) {
+					if _, err := deps.Adaptor.HandleEvent(
+						t.Context(),
+						&ProjectionEventScopeStub{
+							OffsetFunc:           func() uint64 { return offset },
+							CheckpointOffsetFunc: func() uint64 { return offset },
+						},
+						EventA1,
+					); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				got := memoryprojection.Query(
+					deps.Adaptor,
+					func(v int) int { return v },
+				)
+
+				if want := 102; got != want {
+					t.Fatalf("unexpected value: got %d, want %d", got, want)
+				}
+
+				if initialCalls != 1 {
+					t.Fatalf("unexpected number of calls to Initial(): got %d, want 1", initialCalls)
+				}
+			})
 		})
 
 		t.Run("func Compact()", func(t *testing.T) {
@@ -118,6 +182,60 @@ func TestProjection(t *testing.T) {
 					t.Fatalf("unexpected query result: got %d, want %d", got, want)
 				}
 			})
+
+			t.Run("it calls the query function with the handler's initial value", func(t *testing.T) {
+				deps := setup(t)
+
+				deps.Handler.InitialFunc = func() int {
+					return 100
+				}
+
+				got := memoryprojection.Query(
+					deps.Adaptor,
+					func(v int) int {
+						return v * 2
+					},
+				)
+
+				if want := 200; got != want {
+					t.Fatalf("unexpected query result: got %d, want %d", got, want)
+				}
+			})
+		})
+
+		t.Run("func Reset()", func(t *testing.T) {
+			t.Run("it forwards the handler's initial value to the handler", func(t *testing.T) {
+				deps := setup(t)
+
+				deps.Handler.InitialFunc = func() int {
+					return 100
+				}
+
+				called := false
+				deps.Handler.ResetFunc = func(
+					v int,
+					_ dogma.ProjectionResetScope,
+				) (int, error) {
+					called = true
+
+					if want := 100; v != want {
+						t.Fatalf("unexpected value: got %d, want %d", v, want)
+					}
+
+					return v, nil
+				}
+
+				if err := deps.Adaptor.Reset(
+					t.Context(),
+					&ProjectionResetScopeStub{},
+				); err != nil {
+					t.Fatal(err)
+				}
+
+				if !called {
+					t.Fatal("expected handler to be called")
+				}
+			})
 		})
 	})
 
@@ -236,5 +354,287 @@ func TestProjection(t *testing.T) {
 			})
 		})
 
+		t.Run("func Reset()", func(t *testing.T) {
+			t.Run("it replaces the value with the one returned by the handler", func(t *testing.T) {
+				deps := setup(t)
+
+				deps.Handler.ResetFunc = func(
+					v int,
+					_ dogma.ProjectionResetScope,
+				) (int, error) {
+					if want := 321; v != want {
+						t.Fatalf("unexpected value: got %d, want %d", v, want)
+					}
+
+					return 123, nil
+				}
+
+				if err := deps.Adaptor.Reset(
+					t.Context(),
+					&ProjectionResetScopeStub{},
+				); err != nil {
+					t.Fatal(err)
+				}
+
+				got := memoryprojection.Query(
+					deps.Adaptor,
+					func(v int) int { return v },
+				)
+
+				if want := 123; got != want {
+					t.Fatalf("unexpected value: got %d, want %d", got, want)
+				}
+
+				n, err := deps.Adaptor.CountCheckpoints(t.Context())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if n != 0 {
+					t.Fatalf("unexpected number of checkpoints: got %d, want 0", n)
+				}
+			})
+
+			t.Run("it does not modify the projection if the handler fails", func(t *testing.T) {
+				deps := setup(t)
+				want := errors.New("<error>")
+
+				deps.Handler.ResetFunc = func(
+					int,
+					dogma.ProjectionResetScope,
+				) (int, error) {
+					return 0, want
+				}
+
+				if err := deps.Adaptor.Reset(
+					t.Context(),
+					&ProjectionResetScopeStub{},
+				); err != want {
+					t.Fatalf("unexpected error: got %v, want %v", err, want)
+				}
+
+				got := memoryprojection.Query(
+					deps.Adaptor,
+					func(v int) int { return v },
+				)
+
+				if want := 321; got != want {
+					t.Fatalf("unexpected value: got %d, want %d", got, want)
+				}
+
+				n, err := deps.Adaptor.CountCheckpoints(t.Context())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if n != 1 {
+					t.Fatalf("unexpected number of checkpoints: got %d, want 1", n)
+				}
+			})
+		})
+	})
+}
+
+func TestNoResetBehavior(t *testing.T) {
+	var h NoResetBehavior[int]
+
+	v, err := h.Reset(123, &ProjectionResetScopeStub{})
+	if err != dogma.ErrNotSupported {
+		t.Fatalf("unexpected error: got %v, want %v", err, dogma.ErrNotSupported)
+	}
+
+	if v != 123 {
+		t.Fatalf("unexpected value: got %d, want 123", v)
+	}
+}
+
+func TestProjection_copyOnWrite(t *testing.T) {
+	type projection = Projection[map[string]int, *fixtures.MessageHandler[map[string]int]]
+
+	setup := func(t *testing.T) (deps struct {
+		Handler *fixtures.MessageHandler[map[string]int]
+		Adaptor *projection
+	}) {
+		t.Helper()
+
+		deps.Handler = &fixtures.MessageHandler[map[string]int]{
+			ConfigureFunc: func(c dogma.ProjectionConfigurer) {
+				c.Identity("<projection>", projectiontest.IdentityKey)
+			},
+			InitialFunc: func() map[string]int {
+				return map[string]int{}
+			},
+			HandleEventFunc: func(
+				v map[string]int,
+				_ dogma.ProjectionEventScope,
+				_ dogma.Event,
+			) (map[string]int, error) {
+				v["count"]++
+				return v, nil
+			},
+		}
+
+		deps.Adaptor = &projection{
+			Handler: deps.Handler,
+			Clone:   maps.Clone[map[string]int],
+		}
+
+		return deps
+	}
+
+	projectiontest.Run(
+		t,
+		func(t *testing.T, h *projectiontest.Hooks) dogma.ProjectionMessageHandler {
+			deps := setup(t)
+
+			deps.Handler.HandleEventFunc = func(
+				v map[string]int,
+				s dogma.ProjectionEventScope,
+				m dogma.Event,
+			) (map[string]int, error) {
+				return v, h.HandleEvent(s, m)
+			}
+
+			deps.Handler.ResetFunc = func(
+				_ map[string]int,
+				s dogma.ProjectionResetScope,
+			) (map[string]int, error) {
+				return map[string]int{}, h.Reset(s)
+			}
+
+			return deps.Adaptor
+		},
+	)
+
+	// handleEvent applies the event at the given offset to p.
+	handleEvent := func(t *testing.T, p *projection, offset uint64) {
+		t.Helper()
+
+		if _, err := p.HandleEvent(
+			t.Context(),
+			&ProjectionEventScopeStub{
+				OffsetFunc:           func() uint64 { return offset },
+				CheckpointOffsetFunc: func() uint64 { return offset },
+			},
+			EventA1,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	retain := func(p *projection) map[string]int {
+		return memoryprojection.Query(p, func(v map[string]int) map[string]int { return v })
+	}
+
+	t.Run("func Query()", func(t *testing.T) {
+		t.Run("it calls the query function with the handler's initial value", func(t *testing.T) {
+			deps := setup(t)
+
+			if got := retain(deps.Adaptor); got == nil || len(got) != 0 {
+				t.Fatalf("unexpected value: got %v, want an empty map", got)
+			}
+		})
+
+		t.Run("it allows the query function to retain the value", func(t *testing.T) {
+			deps := setup(t)
+			handleEvent(t, deps.Adaptor, 0)
+
+			retained := retain(deps.Adaptor)
+			handleEvent(t, deps.Adaptor, 1)
+
+			if got, want := retained["count"], 1; got != want {
+				t.Fatalf("unexpected retained value: got %d, want %d", got, want)
+			}
+
+			if got, want := retain(deps.Adaptor)["count"], 2; got != want {
+				t.Fatalf("unexpected current value: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it does not block the handling of events", func(t *testing.T) {
+			deps := setup(t)
+
+			querying := make(chan struct{})
+			release := make(chan struct{})
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+
+				memoryprojection.Query(
+					deps.Adaptor,
+					func(map[string]int) struct{} {
+						close(querying)
+						<-release
+						return struct{}{}
+					},
+				)
+			}()
+
+			<-querying
+			handleEvent(t, deps.Adaptor, 0)
+			close(release)
+			<-done
+
+			if got, want := retain(deps.Adaptor)["count"], 1; got != want {
+				t.Fatalf("unexpected value: got %d, want %d", got, want)
+			}
+		})
+	})
+
+	t.Run("func HandleEvent()", func(t *testing.T) {
+		t.Run("it does not modify the published value if the handler fails", func(t *testing.T) {
+			deps := setup(t)
+			handleEvent(t, deps.Adaptor, 0)
+
+			want := errors.New("<error>")
+			deps.Handler.HandleEventFunc = func(
+				v map[string]int,
+				_ dogma.ProjectionEventScope,
+				_ dogma.Event,
+			) (map[string]int, error) {
+				v["count"] = 100
+				return v, want
+			}
+
+			if _, err := deps.Adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{
+					OffsetFunc:           func() uint64 { return 1 },
+					CheckpointOffsetFunc: func() uint64 { return 1 },
+				},
+				EventA1,
+			); err != want {
+				t.Fatalf("unexpected error: got %v, want %v", err, want)
+			}
+
+			if got, want := retain(deps.Adaptor)["count"], 1; got != want {
+				t.Fatalf("unexpected value: got %d, want %d", got, want)
+			}
+		})
+	})
+
+	t.Run("func Restore()", func(t *testing.T) {
+		t.Run("it publishes the restored value", func(t *testing.T) {
+			src := setup(t).Adaptor
+			handleEvent(t, src, 0)
+			handleEvent(t, src, 1)
+
+			var buf bytes.Buffer
+			if err := src.Snapshot(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := setup(t).Adaptor
+			handleEvent(t, dst, 0)
+
+			if err := dst.Restore(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := retain(dst)["count"], 2; got != want {
+				t.Fatalf("unexpected value: got %d, want %d", got, want)
+			}
+		})
 	})
 }
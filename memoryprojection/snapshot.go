@@ -0,0 +1,307 @@
+package memoryprojection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/dogmatiq/projectionkit"
+)
+
+// Codec encodes and decodes a projection's value for use in snapshots.
+type Codec[T any] interface {
+	// Marshal returns the binary representation of v.
+	Marshal(v T) ([]byte, error)
+
+	// Unmarshal returns the value represented by data.
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSONCodec is a [Codec] that encodes values as JSON.
+//
+// It's used when a [Projection] has no codec of its own.
+type JSONCodec[T any] struct{}
+
+// Marshal returns the JSON representation of v.
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal returns the value represented by the JSON in data.
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// snapshot is the serialized form of a projection's state.
+type snapshot struct {
+	Checkpoints []snapshotCheckpoint `json:"checkpoints"`
+	Value       []byte               `json:"value"`
+}
+
+// snapshotCheckpoint is the serialized form of a checkpoint.
+type snapshotCheckpoint struct {
+	StreamID        string    `json:"stream"`
+	Offset          uint64    `json:"offset"`
+	UpdatedAt       time.Time `json:"updated_at,omitzero"`
+	EventRecordedAt time.Time `json:"event_recorded_at,omitzero"`
+}
+
+// Snapshot writes the projection's value and checkpoints to w.
+//
+// The value and checkpoints are captured atomically, such that the snapshot
+// reflects the projection's state between two events.
+func (p *Projection[T, H]) Snapshot(w io.Writer) error {
+	_, err := p.snapshot(w)
+	return err
+}
+
+// snapshot writes the projection's state to w and returns the version of the
+// state that was written.
+func (p *Projection[T, H]) snapshot(w io.Writer) (uint64, error) {
+	s, version, err := p.capture()
+	if err != nil {
+		return 0, err
+	}
+
+	return version, json.NewEncoder(w).Encode(s)
+}
+
+// capture returns the projection's current state.
+func (p *Projection[T, H]) capture() (snapshot, uint64, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	var s snapshot
+
+	// The value is omitted if it has not been initialized, so that the
+	// restored projection obtains it from the handler's Initial() method.
+	if p.initialized {
+		data, err := p.codec().Marshal(p.value)
+		if err != nil {
+			return snapshot{}, 0, err
+		}
+		s.Value = data
+	}
+
+	s.Checkpoints = make([]snapshotCheckpoint, 0, len(p.checkpoints))
+	for _, id := range slices.Sorted(maps.Keys(p.checkpoints)) {
+		s.Checkpoints = append(s.Checkpoints, snapshotCheckpoint(p.checkpoints[id]))
+	}
+
+	return s, p.version, nil
+}
+
+// Restore replaces the projection's value and checkpoints with those in a
+// snapshot read from r, as written by [Projection.Snapshot].
+//
+// The projection is left unchanged if the snapshot can not be read.
+//
+// Subscribers are notified of the change with a [RestoreChange]. Subscribers
+// with back-pressure may delay the return of Restore indefinitely; use
+// [Projection.LoadSnapshot] to bound the delay with a context.
+func (p *Projection[T, H]) Restore(r io.Reader) error {
+	return p.restore(context.Background(), r)
+}
+
+// restore replaces the projection's value and checkpoints with those in a
+// snapshot read from r.
+//
+// Delivery of the change to subscribers with back-pressure stops waiting when
+// ctx is canceled.
+func (p *Projection[T, H]) restore(ctx context.Context, r io.Reader) error {
+	var s snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return err
+	}
+
+	var (
+		checkpoints map[string]projectionkit.Checkpoint
+		value       T
+	)
+
+	if len(s.Checkpoints) != 0 {
+		checkpoints = make(map[string]projectionkit.Checkpoint, len(s.Checkpoints))
+		for _, cp := range s.Checkpoints {
+			checkpoints[cp.StreamID] = projectionkit.Checkpoint(cp)
+		}
+	}
+
+	if s.Value != nil {
+		v, err := p.codec().Unmarshal(s.Value)
+		if err != nil {
+			return err
+		}
+		value = v
+	}
+
+	var change *pendingChange
+	defer func() { p.subs.deliver(ctx, change) }()
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.checkpoints = checkpoints
+	p.initialized = s.Value != nil
+	p.version++
+
+	if p.initialized {
+		p.setValue(value)
+	} else {
+		p.value = value
+		p.published.Store(nil)
+	}
+
+	change = p.subs.prepare(Change{Kind: RestoreChange})
+
+	return nil
+}
+
+// codec returns the codec used to encode the projection's value.
+func (p *Projection[T, H]) codec() Codec[T] {
+	if p.Codec != nil {
+		return p.Codec
+	}
+	return JSONCodec[T]{}
+}
+
+// SnapshotStore is a durable location in which a projection's snapshot is
+// stored.
+type SnapshotStore interface {
+	// Save replaces the stored snapshot with the data written by fn.
+	//
+	// The existing snapshot must remain intact if fn returns an error.
+	Save(ctx context.Context, fn func(w io.Writer) error) error
+
+	// Load calls fn with the stored snapshot.
+	//
+	// It returns false if there is no stored snapshot, in which case fn is not
+	// called.
+	Load(ctx context.Context, fn func(r io.Reader) error) (bool, error)
+}
+
+// FileSnapshotStore is a [SnapshotStore] that stores a snapshot in a file.
+type FileSnapshotStore struct {
+	// Path is the path to the file.
+	Path string
+}
+
+// Save replaces the file with the data written by fn.
+//
+// The data is written to a temporary file in the same directory, which is
+// renamed once the data has been flushed to disk.
+func (s FileSnapshotStore) Save(_ context.Context, fn func(w io.Writer) error) error {
+	dir, name := filepath.Split(s.Path)
+
+	f, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // nolint:errcheck
+	defer f.Close()
+
+	if err := fn(f); err != nil {
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.Path)
+}
+
+// Load calls fn with the contents of the file.
+func (s FileSnapshotStore) Load(_ context.Context, fn func(r io.Reader) error) (bool, error) {
+	f, err := os.Open(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	return true, fn(f)
+}
+
+// SaveSnapshot writes a snapshot of the projection to s.
+func (p *Projection[T, H]) SaveSnapshot(ctx context.Context, s SnapshotStore) error {
+	return s.Save(ctx, p.Snapshot)
+}
+
+// LoadSnapshot restores the projection from the snapshot stored in s.
+//
+// It returns false if s does not contain a snapshot, in which case the
+// projection is left unchanged.
+func (p *Projection[T, H]) LoadSnapshot(ctx context.Context, s SnapshotStore) (bool, error) {
+	return s.Load(ctx, func(r io.Reader) error {
+		return p.restore(ctx, r)
+	})
+}
+
+// SnapshotPeriodically writes a snapshot of the projection to s at the given
+// interval until ctx is canceled.
+//
+// A snapshot is only written if the projection has changed since the last
+// snapshot was written. When ctx is canceled, a final snapshot is written
+// before returning ctx's error, such that a subsequent call to
+// [Projection.LoadSnapshot] resumes from the latest checkpoints.
+func (p *Projection[T, H]) SnapshotPeriodically(
+	ctx context.Context,
+	s SnapshotStore,
+	interval time.Duration,
+) error {
+	if interval <= 0 {
+		panic("snapshot interval must be positive")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	saved := false
+	var version uint64
+
+	save := func(ctx context.Context) error {
+		p.m.RLock()
+		unchanged := saved && p.version == version
+		p.m.RUnlock()
+
+		if unchanged {
+			return nil
+		}
+
+		return s.Save(ctx, func(w io.Writer) error {
+			v, err := p.snapshot(w)
+			version = v
+			return err
+		})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := save(context.WithoutCancel(ctx)); err != nil {
+				return err
+			}
+			return ctx.Err()
+
+		case <-ticker.C:
+			if err := save(ctx); err != nil {
+				return err
+			}
+			saved = true
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package memoryprojection_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dogmatiq/dogma"
+	. "github.com/dogmatiq/enginekit/enginetest/stubs"
+	"github.com/dogmatiq/projectionkit/memoryprojection"
+	. "github.com/dogmatiq/projectionkit/memoryprojection"
+	"github.com/dogmatiq/projectionkit/memoryprojection/internal/fixtures" // can't dot-import due to conflict
+	"github.com/dogmatiq/projectionkit/projectiontest"
+)
+
+func TestProjection_snapshots(t *testing.T) {
+	type projection = Projection[int, *fixtures.MessageHandler[int]]
+
+	newProjection := func() *projection {
+		return &projection{
+			Handler: &fixtures.MessageHandler[int]{
+				ConfigureFunc: func(c dogma.ProjectionConfigurer) {
+					c.Identity("<projection>", projectiontest.IdentityKey)
+				},
+				HandleEventFunc: func(
+					v int,
+					_ dogma.ProjectionEventScope,
+					_ dogma.Event,
+				) (int, error) {
+					return v + 1, nil
+				},
+			},
+		}
+	}
+
+	// handleEvents applies n events from the same stream to p.
+	handleEvents := func(t *testing.T, p *projection, n uint64) {
+		t.Helper()
+
+		for offset := range n {
+			if _, err := p.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{
+					OffsetFunc:           func() uint64 { return offset },
+					CheckpointOffsetFunc: func() uint64 { return offset },
+				},
+				EventA1,
+			); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	value := func(p *projection) int {
+		return memoryprojection.Query(p, func(v int) int { return v })
+	}
+
+	streamID := (&ProjectionEventScopeStub{}).StreamID()
+
+	t.Run("func Restore()", func(t *testing.T) {
+		t.Run("it restores the value and checkpoints written by Snapshot()", func(t *testing.T) {
+			src := newProjection()
+			handleEvents(t, src, 3)
+
+			var buf bytes.Buffer
+			if err := src.Snapshot(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := newProjection()
+			if err := dst.Restore(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := value(dst), 3; got != want {
+				t.Fatalf("unexpected value: got %d, want %d", got, want)
+			}
+
+			want, err := src.ReadCheckpoint(t.Context(), streamID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := dst.ReadCheckpoint(t.Context(), streamID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Offset != 3 || !got.UpdatedAt.Equal(want.UpdatedAt) || !got.EventRecordedAt.Equal(want.EventRecordedAt) {
+				t.Fatalf("unexpected checkpoint: got %+v, want %+v", got, want)
+			}
+
+			// The restored projection resumes from the saved checkpoint offset.
+			handleEvents(t, dst, 4)
+
+			if got, want := value(dst), 4; got != want {
+				t.Fatalf("unexpected value after resuming: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it restores a projection to which no events have been applied", func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := newProjection().Snapshot(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			p := newProjection()
+			handleEvents(t, p, 1)
+
+			if err := p.Restore(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := value(p); got != 0 {
+				t.Fatalf("unexpected value: got %d, want 0", got)
+			}
+
+			n, err := p.CountCheckpoints(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n != 0 {
+				t.Fatalf("unexpected number of checkpoints: got %d, want 0", n)
+			}
+		})
+
+		t.Run("it restores the value of a projection that has been reset", func(t *testing.T) {
+			src := newProjection()
+			src.Handler.ResetFunc = func(int, dogma.ProjectionResetScope) (int, error) {
+				return 100, nil
+			}
+
+			handleEvents(t, src, 3)
+
+			if err := src.Reset(t.Context(), &ProjectionResetScopeStub{}); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := src.Snapshot(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := newProjection()
+			dst.Handler.InitialFunc = func() int {
+				t.Fatal("unexpected call")
+				return 0
+			}
+
+			if err := dst.Restore(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := value(dst), 100; got != want {
+				t.Fatalf("unexpected value: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it uses the handler's initial value if the snapshot has no value", func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := newProjection().Snapshot(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			p := newProjection()
+			p.Handler.InitialFunc = func() int {
+				return 100
+			}
+
+			if err := p.Restore(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := value(p), 100; got != want {
+				t.Fatalf("unexpected value: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it uses the projection's codec", func(t *testing.T) {
+			src := newProjection()
+			src.Codec = decimalCodec{}
+			handleEvents(t, src, 2)
+
+			var buf bytes.Buffer
+			if err := src.Snapshot(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := newProjection()
+			dst.Codec = decimalCodec{}
+
+			if err := dst.Restore(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := value(dst), 2; got != want {
+				t.Fatalf("unexpected value: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it does not modify the projection if the snapshot is invalid", func(t *testing.T) {
+			p := newProjection()
+			handleEvents(t, p, 2)
+
+			if err := p.Restore(strings.NewReader("<invalid>")); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if got, want := value(p), 2; got != want {
+				t.Fatalf("unexpected value: got %d, want %d", got, want)
+			}
+		})
+	})
+
+	t.Run("type FileSnapshotStore", func(t *testing.T) {
+		t.Run("it loads the snapshot that was saved", func(t *testing.T) {
+			store := FileSnapshotStore{
+				Path: filepath.Join(t.TempDir(), "snapshot.json"),
+			}
+
+			src := newProjection()
+			handleEvents(t, src, 3)
+
+			if err := src.SaveSnapshot(t.Context(), store); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := newProjection()
+			ok, err := dst.LoadSnapshot(t.Context(), store)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !ok {
+				t.Fatal("expected a snapshot to be loaded")
+			}
+
+			if got, want := value(dst), 3; got != want {
+				t.Fatalf("unexpected value: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it returns false if there is no snapshot", func(t *testing.T) {
+			store := FileSnapshotStore{
+				Path: filepath.Join(t.TempDir(), "snapshot.json"),
+			}
+
+			ok, err := newProjection().LoadSnapshot(t.Context(), store)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ok {
+				t.Fatal("did not expect a snapshot to be loaded")
+			}
+		})
+
+		t.Run("it retains the existing snapshot if the new one can not be written", func(t *testing.T) {
+			dir := t.TempDir()
+			store := FileSnapshotStore{
+				Path: filepath.Join(dir, "snapshot.json"),
+			}
+
+			if err := store.Save(t.Context(), func(w io.Writer) error {
+				_, err := io.WriteString(w, "<existing>")
+				return err
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			want := errors.New("<error>")
+			if err := store.Save(t.Context(), func(w io.Writer) error {
+				io.WriteString(w, "<partial>") // nolint:errcheck
+				return want
+			}); err != want {
+				t.Fatalf("unexpected error: got %v, want %v", err, want)
+			}
+
+			data, err := os.ReadFile(store.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := string(data); got != "<existing>" {
+				t.Fatalf("unexpected snapshot: got %q, want %q", got, "<existing>")
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(entries) != 1 {
+				t.Fatalf("expected temporary files to be removed, got %d entries", len(entries))
+			}
+		})
+	})
+
+	t.Run("func SnapshotPeriodically()", func(t *testing.T) {
+		t.Run("it writes a final snapshot when the context is canceled", func(t *testing.T) {
+			store := FileSnapshotStore{
+				Path: filepath.Join(t.TempDir(), "snapshot.json"),
+			}
+
+			p := newProjection()
+			handleEvents(t, p, 2)
+
+			ctx, cancel := context.WithCancel(t.Context())
+			cancel()
+
+			if err := p.SnapshotPeriodically(ctx, store, time.Hour); err != context.Canceled {
+				t.Fatalf("unexpected error: got %v, want %v", err, context.Canceled)
+			}
+
+			dst := newProjection()
+			if _, err := dst.LoadSnapshot(t.Context(), store); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := value(dst), 2; got != want {
+				t.Fatalf("unexpected value: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it only writes a snapshot if the projection has changed", func(t *testing.T) {
+			store := &countingSnapshotStore{}
+
+			p := newProjection()
+			handleEvents(t, p, 1)
+
+			ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+			defer cancel()
+
+			if err := p.SnapshotPeriodically(ctx, store, time.Millisecond); err != context.DeadlineExceeded {
+				t.Fatalf("unexpected error: got %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			if store.Saves != 1 {
+				t.Fatalf("unexpected number of snapshots: got %d, want 1", store.Saves)
+			}
+		})
+
+		t.Run("it panics if the interval is not positive", func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+
+			newProjection().SnapshotPeriodically(t.Context(), &countingSnapshotStore{}, 0) // nolint:errcheck
+		})
+	})
+}
+
+// decimalCodec is a [Codec] that encodes integers as decimal strings.
+type decimalCodec struct{}
+
+func (decimalCodec) Marshal(v int) ([]byte, error) {
+	return []byte(strconv.Itoa(v)), nil
+}
+
+func (decimalCodec) Unmarshal(data []byte) (int, error) {
+	return strconv.Atoi(string(data))
+}
+
+// countingSnapshotStore is a [SnapshotStore] that counts the snapshots that are
+// saved, and discards them.
+type countingSnapshotStore struct {
+	Saves int
+}
+
+func (s *countingSnapshotStore) Save(_ context.Context, fn func(io.Writer) error) error {
+	s.Saves++
+	return fn(io.Discard)
+}
+
+func (s *countingSnapshotStore) Load(context.Context, func(io.Reader) error) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,328 @@
+package memoryprojection
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// ChangeKind is an enumeration of the operations that change a projection.
+type ChangeKind int
+
+const (
+	// HandleEventChange indicates that an event was applied to the projection
+	// by [Projection.HandleEvent].
+	HandleEventChange ChangeKind = iota + 1
+
+	// CompactChange indicates that the projection's value was compacted by
+	// [Projection.Compact].
+	CompactChange
+
+	// ResetChange indicates that the projection was reset by
+	// [Projection.Reset].
+	ResetChange
+
+	// RestoreChange indicates that the projection's value and checkpoints
+	// were replaced by [Projection.Restore] or [Projection.LoadSnapshot].
+	RestoreChange
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case HandleEventChange:
+		return "handle-event"
+	case CompactChange:
+		return "compact"
+	case ResetChange:
+		return "reset"
+	case RestoreChange:
+		return "restore"
+	default:
+		return "unknown"
+	}
+}
+
+// Change describes a change to a projection.
+type Change struct {
+	// Kind is the operation that changed the projection.
+	Kind ChangeKind
+
+	// StreamID is the ID of the stream containing the event that was applied.
+	// It's empty unless Kind is [HandleEventChange].
+	StreamID string
+
+	// Offset is the stream's checkpoint offset after the event was applied.
+	// It's zero unless Kind is [HandleEventChange].
+	Offset uint64
+}
+
+// Subscription receives notifications of the changes made to a projection.
+//
+// Use [Projection.Subscribe] to create a subscription.
+type Subscription struct {
+	// C is the channel on which changes are delivered, in the order they were
+	// made. It's closed when the subscription is closed.
+	C <-chan Change
+
+	ch      chan Change
+	block   bool
+	done    chan struct{}
+	close   sync.Once
+	dropped atomic.Uint64
+	subs    *subscribers
+}
+
+// Dropped returns the number of changes that were not delivered because the
+// subscriber was not ready to receive them.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops the delivery of changes and closes s.C.
+//
+// It's safe to call Close more than once.
+func (s *Subscription) Close() {
+	s.close.Do(func() {
+		// Closing done first unblocks any delivery to this subscription that
+		// is waiting for the subscriber, so that the lock can be acquired.
+		close(s.done)
+
+		s.subs.m.Lock()
+		defer s.subs.m.Unlock()
+
+		delete(s.subs.all, s)
+		s.subs.count.Add(-1)
+		close(s.ch)
+	})
+}
+
+// SubscribeOption is a functional option that changes the behavior of
+// [Projection.Subscribe].
+type SubscribeOption func(*Subscription)
+
+// WithBufferSize is a [SubscribeOption] that sets the number of changes that
+// may be buffered while waiting for the subscriber to receive them.
+//
+// By default, up to 16 changes are buffered.
+func WithBufferSize(n int) SubscribeOption {
+	if n < 0 {
+		panic("buffer size must not be negative")
+	}
+
+	return func(s *Subscription) {
+		s.ch = make(chan Change, n)
+	}
+}
+
+// WithBackPressure is a [SubscribeOption] that causes the projection to wait
+// for the subscriber to receive each change once the buffer is full.
+//
+// By default, changes that do not fit in the buffer are dropped, and counted
+// by [Subscription.Dropped]. With back-pressure, a slow subscriber delays each
+// operation that changes the projection until the change is received. A change
+// is still dropped if the context passed to that operation is canceled first.
+func WithBackPressure() SubscribeOption {
+	return func(s *Subscription) {
+		s.block = true
+	}
+}
+
+// Subscribe returns a [Subscription] that receives a [Change] after each call
+// to [Projection.HandleEvent], [Projection.Compact], [Projection.Reset],
+// [Projection.Restore] or [Projection.LoadSnapshot] that changes the
+// projection.
+//
+// Changes are delivered after the projection's lock is released, so the
+// subscriber may query the projection in response to each change. The
+// subscription must be closed when it's no longer needed.
+func (p *Projection[T, H]) Subscribe(opts ...SubscribeOption) *Subscription {
+	s := &Subscription{
+		done: make(chan struct{}),
+		subs: &p.subs,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.ch == nil {
+		s.ch = make(chan Change, 16)
+	}
+	s.C = s.ch
+
+	p.subs.m.Lock()
+	defer p.subs.m.Unlock()
+
+	if p.subs.all == nil {
+		p.subs.all = map[*Subscription]struct{}{}
+	}
+	p.subs.all[s] = struct{}{}
+	p.subs.count.Add(1)
+
+	return s
+}
+
+// subscribers is the set of subscriptions to a projection.
+type subscribers struct {
+	// m protects all, and is held while a change is being sent.
+	m     sync.Mutex
+	all   map[*Subscription]struct{}
+	count atomic.Int64
+
+	// next is the sequence number of the next change to be prepared.
+	next atomic.Uint64
+
+	// q protects turn, pending and delivering.
+	//
+	// They ensure changes are delivered in the order they were made, without
+	// holding the projection's lock while waiting for a slow subscriber. turn
+	// is the sequence number of the next change to be delivered, pending
+	// contains the changes that are waiting for their turn, and delivering is
+	// true while a change is being delivered.
+	q          sync.Mutex
+	turn       uint64
+	pending    map[uint64]*pendingChange
+	delivering bool
+}
+
+// pendingChange is a change that has been prepared for delivery.
+type pendingChange struct {
+	Change
+	seq uint64
+
+	// ctx is the context of the operation that made the change.
+	ctx context.Context
+
+	// turn is closed when it's this change's turn to be delivered, and
+	// abandoned is true if the operation that made the change stopped waiting
+	// for its turn.
+	turn      chan struct{}
+	abandoned bool
+}
+
+// prepare begins the delivery of c, returning nil if there are no
+// subscribers.
+//
+// It must be called while the projection's lock is held. If it returns a
+// non-nil change, [subscribers.deliver] must be called once the projection's
+// lock has been released. It does not acquire s.m, as that may be held by a
+// delivery that's waiting for a subscriber that is itself querying the
+// projection.
+func (s *subscribers) prepare(c Change) *pendingChange {
+	if s.count.Load() == 0 {
+		return nil
+	}
+
+	return &pendingChange{
+		Change: c,
+		seq:    s.next.Add(1) - 1,
+		turn:   make(chan struct{}),
+	}
+}
+
+// deliver sends a change returned by [subscribers.prepare] to each
+// subscription, once all previously prepared changes have been delivered. It
+// does nothing if c is nil.
+//
+// If ctx is canceled while waiting for c's turn, deliver returns immediately.
+// The change is then delivered, in order, by the operation that made the
+// preceding change, but only to those subscriptions that are ready to receive
+// it. It's counted as dropped by any subscription with back-pressure that is
+// not.
+func (s *subscribers) deliver(ctx context.Context, c *pendingChange) {
+	if c == nil {
+		return
+	}
+
+	c.ctx = ctx
+
+	s.q.Lock()
+	if !s.delivering && s.turn == c.seq {
+		s.delivering = true
+		close(c.turn)
+	} else {
+		if s.pending == nil {
+			s.pending = map[uint64]*pendingChange{}
+		}
+		s.pending[c.seq] = c
+	}
+	s.q.Unlock()
+
+	select {
+	case <-c.turn:
+	case <-ctx.Done():
+		s.q.Lock()
+		_, waiting := s.pending[c.seq]
+		c.abandoned = waiting
+		s.q.Unlock()
+
+		if waiting {
+			return
+		}
+
+		// It became c's turn before we could abandon it, so we must deliver
+		// it anyway. The context is canceled, so it does not wait for any
+		// subscriber.
+	}
+
+	s.send(c)
+	s.advance()
+}
+
+// advance passes the turn to the next change once a change has been
+// delivered.
+//
+// Changes that have been abandoned are delivered by the caller. Otherwise, the
+// operation that made the next change is responsible for delivering it.
+func (s *subscribers) advance() {
+	for {
+		s.q.Lock()
+		s.turn++
+
+		c, ok := s.pending[s.turn]
+		if !ok {
+			// The operation that made the next change has not yet called
+			// deliver(), so it delivers the change itself.
+			s.delivering = false
+			s.q.Unlock()
+			return
+		}
+
+		delete(s.pending, s.turn)
+		abandoned := c.abandoned
+		close(c.turn)
+		s.q.Unlock()
+
+		if !abandoned {
+			return
+		}
+
+		s.send(c)
+	}
+}
+
+// send sends c to each subscription.
+func (s *subscribers) send(c *pendingChange) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for sub := range s.all {
+		select {
+		case sub.ch <- c.Change:
+			continue
+		default:
+		}
+
+		if !sub.block {
+			sub.dropped.Add(1)
+			continue
+		}
+
+		select {
+		case sub.ch <- c.Change:
+		case <-sub.done:
+		case <-c.ctx.Done():
+			sub.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package memoryprojection_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dogmatiq/dogma"
+	. "github.com/dogmatiq/enginekit/enginetest/stubs"
+	"github.com/dogmatiq/projectionkit/memoryprojection"
+	. "github.com/dogmatiq/projectionkit/memoryprojection"
+	"github.com/dogmatiq/projectionkit/memoryprojection/internal/fixtures" // can't dot-import due to conflict
+	"github.com/dogmatiq/projectionkit/projectiontest"
+)
+
+func TestProjection_subscriptions(t *testing.T) {
+	type projection = Projection[int, *fixtures.MessageHandler[int]]
+
+	newProjection := func() *projection {
+		return &projection{
+			Handler: &fixtures.MessageHandler[int]{
+				ConfigureFunc: func(c dogma.ProjectionConfigurer) {
+					c.Identity("<projection>", projectiontest.IdentityKey)
+				},
+				HandleEventFunc: func(
+					v int,
+					_ dogma.ProjectionEventScope,
+					_ dogma.Event,
+				) (int, error) {
+					return v + 1, nil
+				},
+			},
+		}
+	}
+
+	// handleEvent applies the event at the given offset to p. It reports
+	// failures using t.Error() so that it may be called from other goroutines.
+	handleEvent := func(ctx context.Context, t *testing.T, p *projection, offset uint64) {
+		t.Helper()
+
+		if _, err := p.HandleEvent(
+			ctx,
+			&ProjectionEventScopeStub{
+				OffsetFunc:           func() uint64 { return offset },
+				CheckpointOffsetFunc: func() uint64 { return offset },
+			},
+			EventA1,
+		); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// receive returns the next change delivered to sub.
+	receive := func(t *testing.T, sub *Subscription) Change {
+		t.Helper()
+
+		select {
+		case c, ok := <-sub.C:
+			if !ok {
+				t.Fatal("subscription channel is closed")
+			}
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for change")
+			return Change{}
+		}
+	}
+
+	// expectNone fails the test if a change is buffered for sub.
+	expectNone := func(t *testing.T, sub *Subscription) {
+		t.Helper()
+
+		select {
+		case c := <-sub.C:
+			t.Fatalf("unexpected change: %+v", c)
+		default:
+		}
+	}
+
+	streamID := (&ProjectionEventScopeStub{}).StreamID()
+
+	t.Run("func Subscribe()", func(t *testing.T) {
+		t.Run("it delivers a change when an event is handled", func(t *testing.T) {
+			p := newProjection()
+			sub := p.Subscribe()
+			defer sub.Close()
+
+			handleEvent(t.Context(), t, p, 0)
+			handleEvent(t.Context(), t, p, 1)
+
+			for _, want := range []Change{
+				{Kind: HandleEventChange, StreamID: streamID, Offset: 1},
+				{Kind: HandleEventChange, StreamID: streamID, Offset: 2},
+			} {
+				if got := receive(t, sub); got != want {
+					t.Fatalf("unexpected change: got %+v, want %+v", got, want)
+				}
+			}
+		})
+
+		t.Run("it delivers a change when the projection is compacted", func(t *testing.T) {
+			p := newProjection()
+			handleEvent(t.Context(), t, p, 0)
+
+			sub := p.Subscribe()
+			defer sub.Close()
+
+			if err := p.Compact(t.Context(), &ProjectionCompactScopeStub{}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := receive(t, sub), (Change{Kind: CompactChange}); got != want {
+				t.Fatalf("unexpected change: got %+v, want %+v", got, want)
+			}
+		})
+
+		t.Run("it delivers a change when the projection is reset", func(t *testing.T) {
+			p := newProjection()
+			sub := p.Subscribe()
+			defer sub.Close()
+
+			if err := p.Reset(t.Context(), &ProjectionResetScopeStub{}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := receive(t, sub), (Change{Kind: ResetChange}); got != want {
+				t.Fatalf("unexpected change: got %+v, want %+v", got, want)
+			}
+		})
+
+		t.Run("it delivers a change when the projection is restored", func(t *testing.T) {
+			p := newProjection()
+			handleEvent(t.Context(), t, p, 0)
+
+			var buf bytes.Buffer
+			if err := p.Snapshot(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			sub := p.Subscribe()
+			defer sub.Close()
+
+			if err := p.Restore(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := receive(t, sub), (Change{Kind: RestoreChange}); got != want {
+				t.Fatalf("unexpected change: got %+v, want %+v", got, want)
+			}
+		})
+
+		t.Run("it does not deliver a change if the projection is unchanged", func(t *testing.T) {
+			p := newProjection()
+			handleEvent(t.Context(), t, p, 0)
+
+			sub := p.Subscribe()
+			defer sub.Close()
+
+			// The event has already been applied.
+			handleEvent(t.Context(), t, p, 0)
+
+			p.Handler.ResetFunc = func(int, dogma.ProjectionResetScope) (int, error) {
+				return 0, errors.New("<error>")
+			}
+
+			if err := p.Reset(t.Context(), &ProjectionResetScopeStub{}); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			expectNone(t, sub)
+		})
+
+		t.Run("it allows the subscriber to query the projection while events are handled concurrently", func(t *testing.T) {
+			p := newProjection()
+			sub := p.Subscribe(WithBufferSize(0), WithBackPressure())
+			defer sub.Close()
+
+			streams := []string{
+				"1b0d6c2a-9f7e-4c5d-8b3a-2e1f0d9c8b7a",
+				"2a3b4c5d-6e7f-4a8b-9c0d-1e2f3a4b5c6d",
+			}
+
+			var wg sync.WaitGroup
+			for _, id := range streams {
+				wg.Go(func() {
+					if _, err := p.HandleEvent(
+						t.Context(),
+						&ProjectionEventScopeStub{
+							StreamIDFunc: func() string { return id },
+						},
+						EventA1,
+					); err != nil {
+						t.Error(err)
+					}
+				})
+			}
+
+			for n := range len(streams) {
+				receive(t, sub)
+
+				got := memoryprojection.Query(p, func(v int) int { return v })
+				if want := n + 1; got < want {
+					t.Fatalf("unexpected value: got %d, want at least %d", got, want)
+				}
+			}
+
+			wg.Wait()
+		})
+	})
+
+	t.Run("func WithBufferSize()", func(t *testing.T) {
+		t.Run("it drops changes that do not fit in the buffer", func(t *testing.T) {
+			p := newProjection()
+			sub := p.Subscribe(WithBufferSize(1))
+			defer sub.Close()
+
+			handleEvent(t.Context(), t, p, 0)
+			handleEvent(t.Context(), t, p, 1)
+
+			if got, want := receive(t, sub).Offset, uint64(1); got != want {
+				t.Fatalf("unexpected offset: got %d, want %d", got, want)
+			}
+
+			expectNone(t, sub)
+
+			if got, want := sub.Dropped(), uint64(1); got != want {
+				t.Fatalf("unexpected number of dropped changes: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it panics if the size is negative", func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+
+			WithBufferSize(-1)
+		})
+	})
+
+	t.Run("func WithBackPressure()", func(t *testing.T) {
+		t.Run("it waits for the subscriber to receive the change", func(t *testing.T) {
+			p := newProjection()
+			sub := p.Subscribe(WithBufferSize(0), WithBackPressure())
+			defer sub.Close()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				handleEvent(t.Context(), t, p, 0)
+			}()
+
+			select {
+			case <-done:
+				t.Fatal("expected HandleEvent() to wait for the subscriber")
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			if got, want := receive(t, sub).Offset, uint64(1); got != want {
+				t.Fatalf("unexpected offset: got %d, want %d", got, want)
+			}
+
+			<-done
+
+			if got := sub.Dropped(); got != 0 {
+				t.Fatalf("unexpected number of dropped changes: got %d, want 0", got)
+			}
+		})
+
+		t.Run("it drops the change if the context is canceled", func(t *testing.T) {
+			p := newProjection()
+			sub := p.Subscribe(WithBufferSize(0), WithBackPressure())
+			defer sub.Close()
+
+			ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+			defer cancel()
+
+			handleEvent(ctx, t, p, 0)
+
+			if got, want := sub.Dropped(), uint64(1); got != want {
+				t.Fatalf("unexpected number of dropped changes: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it stops waiting for earlier changes to be delivered if the context is canceled", func(t *testing.T) {
+			p := newProjection()
+			sub := p.Subscribe(WithBufferSize(0), WithBackPressure())
+			defer sub.Close()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				handleEvent(t.Context(), t, p, 0)
+			}()
+
+			// Wait for the first change to block on the subscriber.
+			time.Sleep(20 * time.Millisecond)
+
+			ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+			defer cancel()
+
+			if _, err := p.HandleEvent(
+				ctx,
+				&ProjectionEventScopeStub{
+					StreamIDFunc: func() string { return "4d3c2b1a-0f9e-4d8c-b7a6-5f4e3d2c1b0a" },
+				},
+				EventA1,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := receive(t, sub).StreamID, streamID; got != want {
+				t.Fatalf("unexpected stream ID: got %q, want %q", got, want)
+			}
+
+			<-done
+
+			// The second change is counted as dropped, as the subscriber was
+			// not ready to receive it.
+			if got, want := sub.Dropped(), uint64(1); got != want {
+				t.Fatalf("unexpected number of dropped changes: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it stops waiting if the subscription is closed", func(t *testing.T) {
+			p := newProjection()
+			sub := p.Subscribe(WithBufferSize(0), WithBackPressure())
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				handleEvent(t.Context(), t, p, 0)
+			}()
+
+			time.Sleep(20 * time.Millisecond)
+			sub.Close()
+			<-done
+		})
+	})
+
+	t.Run("func Subscription.Close()", func(t *testing.T) {
+		t.Run("it closes the channel", func(t *testing.T) {
+			p := newProjection()
+			sub := p.Subscribe()
+			sub.Close()
+			sub.Close() // it's safe to close more than once
+
+			if _, ok := <-sub.C; ok {
+				t.Fatal("expected the channel to be closed")
+			}
+
+			handleEvent(t.Context(), t, p, 0)
+		})
+	})
+}
@@ -0,0 +1,439 @@
+package pgxprojection
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dogmatiq/dogma"
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
+	"github.com/dogmatiq/projectionkit/internal/identity"
+	"github.com/dogmatiq/projectionkit/internal/syncx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// adaptor adapts a [MessageHandler] to the [dogma.ProjectionMessageHandler]
+// interface.
+type adaptor struct {
+	Pool      *pgxpool.Pool
+	Handler   MessageHandler
+	Schema    schema
+	Pipelined bool
+
+	handlerKey       [16]byte
+	createSchemaOnce syncx.SucceedOnce
+}
+
+// New returns a new [dogma.ProjectionMessageHandler] that binds a pgx-specific
+// [MessageHandler] to a PostgreSQL connection pool.
+//
+// The handler stores checkpoint offsets in the "checkpoint" table within the
+// "projection" schema, which is created on demand. Use [WithSchema] and
+// [WithTable] to use different names.
+//
+// The returned handler also implements [projectionkit.CheckpointLister].
+func New(
+	pool *pgxpool.Pool,
+	handler MessageHandler,
+	options ...Option,
+) dogma.ProjectionMessageHandler {
+	a := &adaptor{
+		Pool:    pool,
+		Handler: handler,
+		Schema:  defaultSchema,
+
+		handlerKey: identity.Key(handler),
+	}
+
+	for _, opt := range options {
+		opt(a)
+	}
+
+	return a
+}
+
+// Option is a functional option that changes the behavior of [New].
+type Option func(*adaptor)
+
+// WithSchema is an [Option] that sets the name of the schema that contains the
+// checkpoint table.
+//
+// The schema may be shared by several handlers that use different table names.
+func WithSchema(name string) Option {
+	if name == "" {
+		panic("schema name must not be empty")
+	}
+
+	return func(a *adaptor) {
+		a.Schema.Name = name
+	}
+}
+
+// WithTable is an [Option] that sets the name of the table used to store
+// checkpoint offsets.
+func WithTable(name string) Option {
+	if name == "" {
+		panic("table name must not be empty")
+	}
+
+	return func(a *adaptor) {
+		a.Schema.Table = name
+	}
+}
+
+// WithPipelining is an [Option] that sends the statement that updates the
+// checkpoint offset in the same round-trip as the statements that the handler
+// queues on the [pgx.Batch] passed to [MessageHandler.HandleEvent].
+//
+// By default, the checkpoint offset is updated before the handler is called,
+// such that the handler is not called at all if the checkpoint offset
+// provided by the engine is stale.
+//
+// When pipelining is enabled, the checkpoint offset is not verified until after
+// the handler returns. If it's stale, the transaction is rolled back. Any
+// statements that the handler executes directly on the [pgx.Tx] are executed
+// before the verification, and so may fail with errors caused by re-applying an
+// event, such as unique constraint violations. Handlers that use pipelining
+// should queue all of their writes on the batch.
+func WithPipelining() Option {
+	return func(a *adaptor) {
+		a.Pipelined = true
+	}
+}
+
+// errStaleCheckpoint is returned by the callback of the queued statement that
+// updates the checkpoint offset to indicate that the offset provided by the
+// engine is stale.
+var errStaleCheckpoint = errors.New("checkpoint offset is stale")
+
+func (a *adaptor) Configure(c dogma.ProjectionConfigurer) {
+	a.Handler.Configure(c)
+}
+
+func (a *adaptor) HandleEvent(
+	ctx context.Context,
+	s dogma.ProjectionEventScope,
+	m dogma.Event,
+) (uint64, error) {
+	if err := a.createSchema(ctx); err != nil {
+		return 0, err
+	}
+
+	id := uuidpb.MustParseAsByteArray(s.StreamID())
+
+	ok, err := a.handleEvent(ctx, id, s, m)
+	if err != nil {
+		return 0, err
+	}
+
+	if ok {
+		return s.Offset() + 1, nil
+	}
+
+	return a.queryCheckpointOffset(ctx, id)
+}
+
+// handleEvent handles an event within a new transaction.
+//
+// It returns false if the checkpoint offset provided by the engine is stale.
+func (a *adaptor) handleEvent(
+	ctx context.Context,
+	id [16]byte,
+	s dogma.ProjectionEventScope,
+	m dogma.Event,
+) (bool, error) {
+	tx, err := a.Pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx) // nolint:errcheck
+
+	b := &pgx.Batch{}
+	a.queueCheckpointUpdate(b, id, s)
+
+	if !a.Pipelined {
+		// Send the checkpoint update on its own, before calling the handler.
+		if err := tx.SendBatch(ctx, b).Close(); err != nil {
+			if errors.Is(err, errStaleCheckpoint) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		b = &pgx.Batch{}
+	}
+
+	if err := a.Handler.HandleEvent(ctx, tx, b, s, m); err != nil {
+		return false, err
+	}
+
+	if b.Len() != 0 {
+		if err := tx.SendBatch(ctx, b).Close(); err != nil {
+			if errors.Is(err, errStaleCheckpoint) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// queueCheckpointUpdate queues a statement on b that updates the checkpoint
+// offset of the stream with the given ID to reflect the event in s.
+//
+// The statement's callback returns [errStaleCheckpoint] if the checkpoint
+// offset provided by the engine is stale.
+func (a *adaptor) queueCheckpointUpdate(
+	b *pgx.Batch,
+	id [16]byte,
+	s dogma.ProjectionEventScope,
+) {
+	var (
+		now        = time.Now()
+		recordedAt = nullTime(s.RecordedAt())
+		c          = s.CheckpointOffset()
+		n          = s.Offset() + 1
+		q          *pgx.QueuedQuery
+	)
+
+	// If the "current" checkpoint offset is zero, we assume it's correct and
+	// that there is no existing row for this handler/stream.
+	if c == 0 {
+		q = b.Queue(
+			`INSERT INTO `+a.Schema.CheckpointTable()+` (
+				handler,
+				stream,
+				checkpoint_offset,
+				updated_at,
+				event_recorded_at
+			) VALUES (
+				$1,
+				$2,
+				$3,
+				$4,
+				$5
+			) ON CONFLICT DO NOTHING`,
+			a.handlerKey,
+			id,
+			n,
+			now,
+			recordedAt,
+		)
+	} else {
+		q = b.Queue(
+			`UPDATE `+a.Schema.CheckpointTable()+` SET
+				checkpoint_offset = $1,
+				updated_at = $2,
+				event_recorded_at = $3
+			WHERE handler = $4
+			AND stream = $5
+			AND checkpoint_offset = $6`,
+			n,
+			now,
+			recordedAt,
+			a.handlerKey,
+			id,
+			c,
+		)
+	}
+
+	q.Exec(func(ct pgconn.CommandTag) error {
+		if ct.RowsAffected() == 0 {
+			return errStaleCheckpoint
+		}
+		return nil
+	})
+}
+
+func (a *adaptor) CheckpointOffset(ctx context.Context, id string) (uint64, error) {
+	if err := a.createSchema(ctx); err != nil {
+		return 0, err
+	}
+
+	return a.queryCheckpointOffset(ctx, uuidpb.MustParseAsByteArray(id))
+}
+
+// queryCheckpointOffset returns the checkpoint offset of the stream with the
+// given ID.
+func (a *adaptor) queryCheckpointOffset(ctx context.Context, id [16]byte) (uint64, error) {
+	var cp uint64
+
+	err := a.Pool.QueryRow(
+		ctx,
+		`SELECT checkpoint_offset
+		FROM `+a.Schema.CheckpointTable()+`
+		WHERE handler = $1
+		AND stream = $2`,
+		a.handlerKey,
+		id,
+	).Scan(&cp)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+
+	return cp, err
+}
+
+func (a *adaptor) ReadCheckpoint(ctx context.Context, id string) (projectionkit.Checkpoint, error) {
+	cp := projectionkit.Checkpoint{
+		StreamID: id,
+	}
+
+	if err := a.createSchema(ctx); err != nil {
+		return cp, err
+	}
+
+	var updatedAt, recordedAt pgtype.Timestamptz
+
+	err := a.Pool.QueryRow(
+		ctx,
+		`SELECT
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		FROM `+a.Schema.CheckpointTable()+`
+		WHERE handler = $1
+		AND stream = $2`,
+		a.handlerKey,
+		uuidpb.MustParseAsByteArray(id),
+	).Scan(&cp.Offset, &updatedAt, &recordedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return cp, nil
+	}
+
+	cp.UpdatedAt = updatedAt.Time
+	cp.EventRecordedAt = recordedAt.Time
+
+	return cp, err
+}
+
+func (a *adaptor) ListCheckpoints(
+	ctx context.Context,
+	after string,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	if limit <= 0 {
+		panic("limit must be positive")
+	}
+
+	if err := a.createSchema(ctx); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT
+			stream,
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		FROM ` + a.Schema.CheckpointTable() + `
+		WHERE handler = $1`
+	args := []any{a.handlerKey, limit}
+
+	if after != "" {
+		query += ` AND stream > $3`
+		args = append(args, uuidpb.MustParseAsByteArray(after))
+	}
+
+	query += ` ORDER BY stream LIMIT $2`
+
+	rows, err := a.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []projectionkit.Checkpoint
+
+	for rows.Next() {
+		var (
+			cp                    projectionkit.Checkpoint
+			streamID              [16]byte
+			updatedAt, recordedAt pgtype.Timestamptz
+		)
+
+		if err := rows.Scan(
+			&streamID,
+			&cp.Offset,
+			&updatedAt,
+			&recordedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		cp.StreamID = uuidpb.FromByteArray(streamID).AsString()
+		cp.UpdatedAt = updatedAt.Time
+		cp.EventRecordedAt = recordedAt.Time
+		checkpoints = append(checkpoints, cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+func (a *adaptor) CountCheckpoints(ctx context.Context) (uint64, error) {
+	if err := a.createSchema(ctx); err != nil {
+		return 0, err
+	}
+
+	var n uint64
+
+	err := a.Pool.QueryRow(
+		ctx,
+		`SELECT COUNT(*)
+		FROM `+a.Schema.CheckpointTable()+`
+		WHERE handler = $1`,
+		a.handlerKey,
+	).Scan(&n)
+
+	return n, err
+}
+
+func (a *adaptor) Compact(ctx context.Context, s dogma.ProjectionCompactScope) error {
+	return a.Handler.Compact(ctx, a.Pool, s)
+}
+
+func (a *adaptor) Reset(ctx context.Context, s dogma.ProjectionResetScope) error {
+	if err := a.createSchema(ctx); err != nil {
+		return err
+	}
+
+	return pgx.BeginFunc(ctx, a.Pool, func(tx pgx.Tx) error {
+		if err := a.Handler.Reset(ctx, tx, s); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(
+			ctx,
+			`DELETE FROM `+a.Schema.CheckpointTable()+`
+			WHERE handler = $1`,
+			a.handlerKey,
+		)
+		return err
+	})
+}
+
+// createSchema creates the schema used to store checkpoints, if it has not
+// already been created by this adaptor.
+func (a *adaptor) createSchema(ctx context.Context) error {
+	return a.createSchemaOnce.Do(
+		ctx,
+		func(ctx context.Context) error {
+			return a.Schema.Create(ctx, a.Pool)
+		},
+	)
+}
+
+// nullTime returns t as a [pgtype.Timestamptz], which is NULL if t is the zero
+// value.
+func nullTime(t time.Time) pgtype.Timestamptz {
+	return pgtype.Timestamptz{
+		Time:  t,
+		Valid: !t.IsZero(),
+	}
+}
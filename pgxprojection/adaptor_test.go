@@ -0,0 +1,417 @@
+package pgxprojection_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dogmatiq/dogma"
+	. "github.com/dogmatiq/enginekit/enginetest/stubs"
+	. "github.com/dogmatiq/projectionkit/pgxprojection"
+	"github.com/dogmatiq/projectionkit/pgxprojection/internal/fixtures" // can't dot-import due to conflict
+	"github.com/dogmatiq/projectionkit/projectiontest"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+func TestAdaptor(t *testing.T) {
+	t.Parallel()
+
+	container, err := postgres.Run(
+		t.Context(),
+		"postgres",
+		postgres.BasicWaitStrategies(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := container.Terminate(context.Background()); err != nil {
+			t.Log(err)
+		}
+	})
+
+	dsn, err := container.ConnectionString(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := pgxpool.New(t.Context(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	runTests(t, pool)
+
+	t.Run("with pipelining", func(t *testing.T) {
+		runTests(t, pool, WithPipelining())
+	})
+
+	t.Run("with custom schema and table names", func(t *testing.T) {
+		runTests(
+			t,
+			pool,
+			WithSchema("app-projection"),
+			WithTable(`app "checkpoint"`),
+		)
+	})
+}
+
+func runTests(
+	t *testing.T,
+	pool *pgxpool.Pool,
+	options ...Option,
+) {
+	setup := func(t *testing.T) (deps struct {
+		Handler *fixtures.MessageHandler
+		Adaptor dogma.ProjectionMessageHandler
+	}) {
+		t.Helper()
+
+		if _, err := pool.Exec(
+			t.Context(),
+			`CREATE TABLE IF NOT EXISTS projection_data (value TEXT NOT NULL PRIMARY KEY)`,
+		); err != nil {
+			t.Fatalf("cannot create projection table: %s", err)
+		}
+
+		t.Cleanup(func() {
+			if _, err := pool.Exec(
+				context.Background(),
+				`DROP TABLE IF EXISTS projection_data`,
+			); err != nil {
+				t.Fatalf("cannot drop projection table: %s", err)
+			}
+
+			if err := DropSchema(context.Background(), pool, options...); err != nil {
+				t.Fatalf("cannot drop schema: %s", err)
+			}
+		})
+
+		deps.Handler = &fixtures.MessageHandler{
+			ConfigureFunc: func(c dogma.ProjectionConfigurer) {
+				c.Identity("<projection>", projectiontest.IdentityKey)
+			},
+		}
+
+		deps.Adaptor = New(pool, deps.Handler, options...)
+
+		return deps
+	}
+
+	countRows := func(t *testing.T) int {
+		t.Helper()
+
+		var n int
+		if err := pool.QueryRow(
+			t.Context(),
+			`SELECT COUNT(*) FROM projection_data`,
+		).Scan(&n); err != nil {
+			t.Fatalf("cannot count rows: %s", err)
+		}
+
+		return n
+	}
+
+	projectiontest.Run(
+		t,
+		func(t *testing.T, h *projectiontest.Hooks) dogma.ProjectionMessageHandler {
+			deps := setup(t)
+
+			deps.Handler.HandleEventFunc = func(
+				_ context.Context,
+				_ pgx.Tx,
+				_ *pgx.Batch,
+				s dogma.ProjectionEventScope,
+				m dogma.Event,
+			) error {
+				return h.HandleEvent(s, m)
+			}
+
+			deps.Handler.ResetFunc = func(
+				_ context.Context,
+				_ pgx.Tx,
+				s dogma.ProjectionResetScope,
+			) error {
+				return h.Reset(s)
+			}
+
+			return deps.Adaptor
+		},
+	)
+
+	t.Run("func HandleEvent()", func(t *testing.T) {
+		t.Run("it forwards to the handler", func(t *testing.T) {
+			deps := setup(t)
+			want := errors.New("<error>")
+
+			deps.Handler.HandleEventFunc = func(
+				context.Context,
+				pgx.Tx,
+				*pgx.Batch,
+				dogma.ProjectionEventScope,
+				dogma.Event,
+			) error {
+				return want
+			}
+
+			_, got := deps.Adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{},
+				EventA1,
+			)
+
+			if got != want {
+				t.Fatalf("unexpected error: got %v, want %v", got, want)
+			}
+		})
+
+		t.Run("it executes the statements queued on the batch", func(t *testing.T) {
+			deps := setup(t)
+
+			deps.Handler.HandleEventFunc = func(
+				_ context.Context,
+				_ pgx.Tx,
+				b *pgx.Batch,
+				_ dogma.ProjectionEventScope,
+				_ dogma.Event,
+			) error {
+				b.Queue(`INSERT INTO projection_data VALUES ('<value>')`)
+				return nil
+			}
+
+			cp, err := deps.Adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{},
+				EventA1,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cp != 1 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 1", cp)
+			}
+
+			if n := countRows(t); n != 1 {
+				t.Fatalf("unexpected number of rows: got %d, want 1", n)
+			}
+		})
+
+		t.Run("it does not apply queued statements if the checkpoint offset is stale", func(t *testing.T) {
+			deps := setup(t)
+
+			deps.Handler.HandleEventFunc = func(
+				_ context.Context,
+				_ pgx.Tx,
+				b *pgx.Batch,
+				_ dogma.ProjectionEventScope,
+				_ dogma.Event,
+			) error {
+				b.Queue(`INSERT INTO projection_data VALUES ('<value>')`)
+				return nil
+			}
+
+			cp, err := deps.Adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{
+					CheckpointOffsetFunc: func() uint64 { return 1 },
+				},
+				EventA1,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cp != 0 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 0", cp)
+			}
+
+			if n := countRows(t); n != 0 {
+				t.Fatalf("unexpected number of rows: got %d, want 0", n)
+			}
+		})
+
+		t.Run("it returns an error if a queued statement fails", func(t *testing.T) {
+			deps := setup(t)
+
+			deps.Handler.HandleEventFunc = func(
+				_ context.Context,
+				_ pgx.Tx,
+				b *pgx.Batch,
+				_ dogma.ProjectionEventScope,
+				_ dogma.Event,
+			) error {
+				b.Queue(`INSERT INTO projection_data VALUES (NULL)`)
+				return nil
+			}
+
+			if _, err := deps.Adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{},
+				EventA1,
+			); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			cp, err := deps.Adaptor.CheckpointOffset(
+				t.Context(),
+				(&ProjectionEventScopeStub{}).StreamID(),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cp != 0 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 0", cp)
+			}
+		})
+	})
+
+	t.Run("func Compact()", func(t *testing.T) {
+		t.Run("it forwards to the handler", func(t *testing.T) {
+			deps := setup(t)
+			want := errors.New("<error>")
+
+			deps.Handler.CompactFunc = func(
+				_ context.Context,
+				p *pgxpool.Pool,
+				_ dogma.ProjectionCompactScope,
+			) error {
+				if p != pool {
+					t.Fatalf("unexpected pool: got %p, want %p", p, pool)
+				}
+				return want
+			}
+
+			got := deps.Adaptor.Compact(
+				t.Context(),
+				&ProjectionCompactScopeStub{},
+			)
+
+			if got != want {
+				t.Fatalf("unexpected error: got %v, want %v", got, want)
+			}
+		})
+	})
+
+	t.Run("func CreateSchema()", func(t *testing.T) {
+		t.Run("it can be called when the schema already exists", func(t *testing.T) {
+			setup(t)
+
+			for range 2 {
+				if err := CreateSchema(t.Context(), pool, options...); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	})
+
+	t.Run("func ExportCheckpoints()", func(t *testing.T) {
+		t.Run("it does not create the schema", func(t *testing.T) {
+			if err := DropSchema(t.Context(), pool, options...); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := ExportCheckpoints(t.Context(), pool, &buf, options...); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.Len() != 0 {
+				t.Fatalf("unexpected export: got %q, want nothing", buf.String())
+			}
+
+			var n int
+			if err := pool.QueryRow(
+				t.Context(),
+				`SELECT COUNT(*)
+				FROM information_schema.tables
+				WHERE table_name IN ('checkpoint', 'app "checkpoint"')`,
+			).Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+
+			if n != 0 {
+				t.Fatal("expected the checkpoint table not to be created")
+			}
+		})
+
+		t.Run("it exports the checkpoints that were imported", func(t *testing.T) {
+			deps := setup(t)
+
+			input := `{"handler":"` + projectiontest.IdentityKey + `","stream":"2a3b4c5d-6e7f-4a8b-9c0d-1e2f3a4b5c6d","offset":5}` + "\n"
+
+			if err := ImportCheckpoints(
+				t.Context(),
+				pool,
+				strings.NewReader(input),
+				options...,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			cp, err := deps.Adaptor.CheckpointOffset(t.Context(), "2a3b4c5d-6e7f-4a8b-9c0d-1e2f3a4b5c6d")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cp != 5 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 5", cp)
+			}
+
+			var buf bytes.Buffer
+			if err := ExportCheckpoints(t.Context(), pool, &buf, options...); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := buf.String(); got != input {
+				t.Fatalf("unexpected export: got %q, want %q", got, input)
+			}
+		})
+	})
+
+	t.Run("func ImportCheckpoints()", func(t *testing.T) {
+		t.Run("it deletes the checkpoints of streams with an offset of zero", func(t *testing.T) {
+			deps := setup(t)
+			scope := &ProjectionEventScopeStub{}
+
+			if _, err := deps.Adaptor.HandleEvent(t.Context(), scope, EventA1); err != nil {
+				t.Fatal(err)
+			}
+
+			input := `{"handler":"` + projectiontest.IdentityKey + `","stream":"` + scope.StreamID() + `","offset":0}` + "\n"
+
+			if err := ImportCheckpoints(
+				t.Context(),
+				pool,
+				strings.NewReader(input),
+				options...,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := deps.Adaptor.HandleEvent(t.Context(), scope, EventA1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != 1 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 1", got)
+			}
+		})
+	})
+
+	t.Run("func DropSchema()", func(t *testing.T) {
+		t.Run("it can be called when the schema does not exist", func(t *testing.T) {
+			if err := DropSchema(t.Context(), pool, options...); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+}
@@ -0,0 +1,3 @@
+// Package pgxprojection provides utilities for building PostgreSQL-based
+// projections that use pgx directly, rather than via database/sql.
+package pgxprojection
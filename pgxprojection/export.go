@@ -0,0 +1,159 @@
+package pgxprojection
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ExportCheckpoints writes the checkpoint offsets of all handlers stored in the
+// checkpoint table to w, in the format written by
+// [projectionkit.CheckpointEncoder].
+//
+// The options select the checkpoint table, as per [New]. Nothing is written if
+// the checkpoint table does not exist.
+func ExportCheckpoints(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	w io.Writer,
+	options ...Option,
+) error {
+	s := newSchema(options)
+
+	rows, err := pool.Query(
+		ctx,
+		`SELECT handler, stream, checkpoint_offset
+		FROM `+s.CheckpointTable()+`
+		ORDER BY handler, stream`,
+	)
+	if isUndefinedTable(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	enc := projectionkit.NewCheckpointEncoder(w)
+
+	for rows.Next() {
+		var (
+			handlerKey, streamID [16]byte
+			offset               uint64
+		)
+
+		if err := rows.Scan(&handlerKey, &streamID, &offset); err != nil {
+			return err
+		}
+
+		if err := enc.Encode(projectionkit.ExportedCheckpoint{
+			HandlerKey: uuidpb.FromByteArray(handlerKey).AsString(),
+			StreamID:   uuidpb.FromByteArray(streamID).AsString(),
+			Offset:     offset,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// The error may not be reported until the rows are read.
+	if err := rows.Err(); !isUndefinedTable(err) {
+		return err
+	}
+
+	return nil
+}
+
+// isUndefinedTable returns true if err is an "undefined table" (SQLSTATE 42P01)
+// error.
+func isUndefinedTable(err error) bool {
+	var x *pgconn.PgError
+	return errors.As(err, &x) && x.Code == "42P01"
+}
+
+// ImportCheckpoints reads checkpoint offsets from r, in the format written by
+// [projectionkit.CheckpointEncoder], and stores them in the checkpoint table,
+// replacing any existing checkpoint offsets for the same handlers and streams.
+//
+// The checkpoints are imported within a single transaction. Checkpoints with
+// an offset of zero are deleted. Checkpoints that are not present in r are left
+// unchanged. It must not be used while the affected handlers are running.
+//
+// The options select the checkpoint table, as per [New].
+func ImportCheckpoints(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	r io.Reader,
+	options ...Option,
+) error {
+	s := newSchema(options)
+
+	if err := s.Create(ctx, pool); err != nil {
+		return err
+	}
+
+	dec := projectionkit.NewCheckpointDecoder(r)
+	now := time.Now()
+
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		for {
+			cp, err := dec.Decode()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if cp.Offset == 0 {
+				// A stored offset of zero would prevent the adaptor from
+				// inserting the checkpoint when the stream's first event is
+				// handled.
+				if _, err := tx.Exec(
+					ctx,
+					`DELETE FROM `+s.CheckpointTable()+`
+					WHERE handler = $1
+					AND stream = $2`,
+					uuidpb.MustParseAsByteArray(cp.HandlerKey),
+					uuidpb.MustParseAsByteArray(cp.StreamID),
+				); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if _, err := tx.Exec(
+				ctx,
+				`INSERT INTO `+s.CheckpointTable()+` (
+					handler,
+					stream,
+					checkpoint_offset,
+					updated_at,
+					event_recorded_at
+				) VALUES (
+					$1,
+					$2,
+					$3,
+					$4,
+					NULL
+				) ON CONFLICT (handler, stream) DO UPDATE SET
+					checkpoint_offset = EXCLUDED.checkpoint_offset,
+					updated_at = EXCLUDED.updated_at,
+					event_recorded_at = NULL`,
+				uuidpb.MustParseAsByteArray(cp.HandlerKey),
+				uuidpb.MustParseAsByteArray(cp.StreamID),
+				cp.Offset,
+				now,
+			); err != nil {
+				return err
+			}
+		}
+	})
+}
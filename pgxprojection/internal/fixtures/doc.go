@@ -0,0 +1,2 @@
+// Package fixtures is a set of test fixtures and mocks for pgx projections.
+package fixtures
@@ -0,0 +1,152 @@
+package pgxprojection
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CreateSchema creates the schema and table used to store checkpoints, if they
+// do not already exist.
+//
+// It's not necessary to call CreateSchema before using the handler, as the
+// schema is created on demand.
+//
+// The table has the same structure as the one used by
+// [sqlprojection.PostgresDriver], such that a handler can be moved between the
+// two packages without losing its checkpoints.
+//
+// [sqlprojection.PostgresDriver]: https://pkg.go.dev/github.com/dogmatiq/projectionkit/sqlprojection#PostgresDriver
+func CreateSchema(ctx context.Context, pool *pgxpool.Pool, options ...Option) error {
+	return newSchema(options).Create(ctx, pool)
+}
+
+// DropSchema drops the table used to store checkpoints, if it exists.
+//
+// The schema that contains the table is also dropped once it no longer
+// contains any tables.
+func DropSchema(ctx context.Context, pool *pgxpool.Pool, options ...Option) error {
+	return newSchema(options).Drop(ctx, pool)
+}
+
+// schema describes the location of the table used to store checkpoints.
+type schema struct {
+	Name, Table string
+}
+
+// newSchema returns the schema described by the given options.
+func newSchema(options []Option) schema {
+	a := &adaptor{
+		Schema: defaultSchema,
+	}
+
+	for _, opt := range options {
+		opt(a)
+	}
+
+	return a.Schema
+}
+
+// defaultSchema is the schema used when none is specified.
+var defaultSchema = schema{
+	Name:  "projection",
+	Table: "checkpoint",
+}
+
+// CheckpointTable returns the quoted, schema-qualified name of the checkpoint
+// table.
+func (s schema) CheckpointTable() string {
+	return pgx.Identifier{s.Name, s.Table}.Sanitize()
+}
+
+// VersionTable returns the quoted, schema-qualified name of the table used by
+// sqlprojection to record the schema version.
+func (s schema) VersionTable() string {
+	return pgx.Identifier{s.Name, s.Table + "_version"}.Sanitize()
+}
+
+// Create creates the schema and checkpoint table if they do not already exist.
+func (s schema) Create(ctx context.Context, pool *pgxpool.Pool) error {
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		// Acquire a transaction-scoped advisory lock to prevent concurrent
+		// creation of the same tables. This is the same lock that is used by
+		// sqlprojection's schema migrations.
+		if _, err := tx.Exec(
+			ctx,
+			`SELECT pg_advisory_xact_lock(hashtext($1))`,
+			"projectionkit:"+s.CheckpointTable(),
+		); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(
+			ctx,
+			`CREATE SCHEMA IF NOT EXISTS `+pgx.Identifier{s.Name}.Sanitize(),
+		); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(
+			ctx,
+			`CREATE TABLE IF NOT EXISTS `+s.CheckpointTable()+` (
+				handler           UUID NOT NULL,
+				stream            UUID NOT NULL,
+				checkpoint_offset BIGINT NOT NULL,
+
+				PRIMARY KEY (handler, stream)
+			)`,
+		); err != nil {
+			return err
+		}
+
+		// The table may have been created by an earlier version of
+		// sqlprojection, which did not record timestamps.
+		_, err := tx.Exec(
+			ctx,
+			`ALTER TABLE `+s.CheckpointTable()+`
+				ADD COLUMN IF NOT EXISTS updated_at        TIMESTAMPTZ NULL,
+				ADD COLUMN IF NOT EXISTS event_recorded_at TIMESTAMPTZ NULL`,
+		)
+		return err
+	})
+}
+
+// Drop drops the checkpoint table, and the schema if it's no longer in use.
+func (s schema) Drop(ctx context.Context, pool *pgxpool.Pool) error {
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		// The version table is dropped too, otherwise sqlprojection would
+		// consider the schema to be up-to-date without the checkpoint table.
+		if _, err := tx.Exec(
+			ctx,
+			`DROP TABLE IF EXISTS `+s.CheckpointTable()+`, `+s.VersionTable(),
+		); err != nil {
+			return err
+		}
+
+		// Only drop the schema itself once it's no longer in use, as it may be
+		// shared by handlers that use different table names.
+		var inUse bool
+		if err := tx.QueryRow(
+			ctx,
+			`SELECT EXISTS (
+				SELECT 1
+				FROM information_schema.tables
+				WHERE table_schema = $1
+			)`,
+			s.Name,
+		).Scan(&inUse); err != nil {
+			return err
+		}
+
+		if inUse {
+			return nil
+		}
+
+		_, err := tx.Exec(
+			ctx,
+			`DROP SCHEMA IF EXISTS `+pgx.Identifier{s.Name}.Sanitize()+` CASCADE`,
+		)
+		return err
+	})
+}
@@ -0,0 +1,7 @@
+// Package projectiontest contains a conformance test suite for
+// [dogma.ProjectionMessageHandler] implementations.
+//
+// The suite verifies the optimistic concurrency control (OCC) and checkpoint
+// behavior that the engine relies upon. It's used to test the adaptors in this
+// module, and may be used to certify custom adaptors built on top of them.
+package projectiontest
@@ -0,0 +1,89 @@
+package projectiontest
+
+import (
+	"sync"
+
+	"github.com/dogmatiq/dogma"
+)
+
+// Hooks allows the test suite to observe and influence the application-defined
+// logic wrapped by the handler under test.
+//
+// The suite passes a new Hooks value to the setup function for each test. The
+// handler should call the hooks from within its underlying message handler,
+// such as an sqlprojection.MessageHandler. Tests that depend on a hook are
+// skipped if the handler never calls it.
+type Hooks struct {
+	m           sync.Mutex
+	handleEvent hook
+	reset       hook
+}
+
+// HandleEvent must be called by the handler under test each time it applies
+// an event to its projection data.
+//
+// If it returns a non-nil error, the handler must fail with that error and must
+// not modify any data, including its checkpoint offsets.
+func (h *Hooks) HandleEvent(dogma.ProjectionEventScope, dogma.Event) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.handleEvent.call()
+}
+
+// Reset must be called by the handler under test each time it clears its
+// projection data.
+//
+// If it returns a non-nil error, the handler must fail with that error and must
+// not modify any data, including its checkpoint offsets.
+func (h *Hooks) Reset(dogma.ProjectionResetScope) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.reset.call()
+}
+
+// failHandleEvent causes subsequent calls to [Hooks.HandleEvent] to return
+// err. A nil error restores the default behavior.
+func (h *Hooks) failHandleEvent(err error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.handleEvent.err = err
+}
+
+// failReset causes subsequent calls to [Hooks.Reset] to return err. A nil
+// error restores the default behavior.
+func (h *Hooks) failReset(err error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.reset.err = err
+}
+
+// handleEventCalled returns true if [Hooks.HandleEvent] has been called.
+func (h *Hooks) handleEventCalled() bool {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.handleEvent.calls != 0
+}
+
+// resetCalled returns true if [Hooks.Reset] has been called.
+func (h *Hooks) resetCalled() bool {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.reset.calls != 0
+}
+
+// hook records the calls made to a specific hook.
+type hook struct {
+	calls int
+	err   error
+}
+
+func (h *hook) call() error {
+	h.calls++
+	return h.err
+}
@@ -0,0 +1,850 @@
+package projectiontest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dogmatiq/dogma"
+	"github.com/dogmatiq/enginekit/enginetest/stubs"
+	"github.com/dogmatiq/projectionkit"
+	"github.com/dogmatiq/projectionkit/internal/identity"
+)
+
+// IdentityKey is the identity key that handlers under test must use.
+const IdentityKey = "26902c80-a1b8-43d1-99ae-ea5651656e63"
+
+// Run runs the conformance test suite against a handler implementation.
+//
+// setup is called at the start of each test to create the handler under test.
+// Each handler must have an identity key of [IdentityKey] and must not share
+// projection data or checkpoint offsets with the handlers created for other
+// tests. The handler should call the hooks in h from within its underlying
+// message handler; see [Hooks].
+func Run(
+	t *testing.T,
+	setup func(t *testing.T, h *Hooks) dogma.ProjectionMessageHandler,
+) {
+	t.Run("func Configure()", func(t *testing.T) {
+		t.Run("it returns the expected identity", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+
+			got := identity.Key(handler)
+			want := [16]byte{
+				0x26, 0x90, 0x2c, 0x80,
+				0xa1, 0xb8, 0x43, 0xd1,
+				0x99, 0xae, 0xea, 0x56,
+				0x51, 0x65, 0x6e, 0x63,
+			}
+
+			if got != want {
+				t.Fatalf("unexpected identity: got %v, want %v", got, want)
+			}
+		})
+	})
+
+	t.Run("func HandleEvent()", func(t *testing.T) {
+		t.Run("it returns the new checkpoint offset", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+
+			got, err := handler.HandleEvent(
+				t.Context(),
+				&stubs.ProjectionEventScopeStub{},
+				stubs.EventA1,
+			)
+			if err != nil {
+				t.Fatalf("unable to handle first event: %s", err)
+			}
+
+			if want := uint64(1); got != want {
+				t.Fatalf("unexpected checkpoint offset: got %d, want %d", got, want)
+			}
+
+			got, err = handler.HandleEvent(
+				t.Context(),
+				&stubs.ProjectionEventScopeStub{
+					OffsetFunc:           func() uint64 { return 1 },
+					CheckpointOffsetFunc: func() uint64 { return 1 },
+				},
+				stubs.EventA2,
+			)
+			if err != nil {
+				t.Fatalf("unable to handle second event: %s", err)
+			}
+
+			if want := uint64(2); got != want {
+				t.Fatalf("unexpected checkpoint offset: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it returns the actual checkpoint offset if the provided checkpoint offset is not current", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+			scope := &stubs.ProjectionEventScopeStub{}
+			want := uint64(1)
+
+			got, err := handler.HandleEvent(
+				t.Context(),
+				scope,
+				stubs.EventA1,
+			)
+			if err != nil {
+				t.Fatalf("unable to handle first event: %s", err)
+			}
+
+			if got != want {
+				t.Fatalf("unexpected checkpoint offset: got %d, want %d", got, want)
+			}
+
+			scope.CheckpointOffsetFunc = func() uint64 {
+				return 123
+			}
+
+			got, err = handler.HandleEvent(
+				t.Context(),
+				scope,
+				stubs.EventA2,
+			)
+			if err != nil {
+				t.Fatalf("unable to handle second event: %s", err)
+			}
+
+			if got != want {
+				t.Fatalf("unexpected checkpoint offset: got %d, want %d", got, want)
+			}
+
+			// Ensure that the checkpoint offset was not updated.
+			got, err = handler.CheckpointOffset(
+				t.Context(),
+				scope.StreamID(),
+			)
+			if err != nil {
+				t.Fatalf("unable to load checkpoint offset: %s", err)
+			}
+
+			if got != want {
+				t.Fatalf("unexpected checkpoint offset: got %d, want %d", got, want)
+			}
+		})
+	})
+
+	t.Run("func CheckpointOffset()", func(t *testing.T) {
+		t.Run("it returns the checkpoint offset", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+			scope := &stubs.ProjectionEventScopeStub{}
+
+			want, err := handler.HandleEvent(
+				t.Context(),
+				scope,
+				stubs.EventA1,
+			)
+			if err != nil {
+				t.Fatalf("unable to handle event: %s", err)
+			}
+
+			got, err := handler.CheckpointOffset(
+				t.Context(),
+				scope.StreamID(),
+			)
+			if err != nil {
+				t.Fatalf("unable to load checkpoint offset: %s", err)
+			}
+
+			if got != want {
+				t.Fatalf("unexpected checkpoint offset: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it returns 0 if no events from the stream have been applied", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+
+			got, err := handler.CheckpointOffset(
+				t.Context(),
+				"e108b1d5-f2c2-44f1-884d-a5cdc1d575f0",
+			)
+			if err != nil {
+				t.Fatalf("unable to load checkpoint offset: %s", err)
+			}
+
+			if want := uint64(0); got != want {
+				t.Fatalf("unexpected checkpoint offset: got %d, want %d", got, want)
+			}
+		})
+	})
+
+	t.Run("func ReadCheckpoint()", func(t *testing.T) {
+		t.Run("it returns the checkpoint offset and timestamps", func(t *testing.T) {
+			handler := checkpointReader(t, setup(t, &Hooks{}))
+
+			// Use a time with microsecond precision, as some databases do not
+			// store timestamps with greater precision.
+			recordedAt := time.Date(2025, 1, 2, 3, 4, 5, 6000, time.UTC)
+			scope := &stubs.ProjectionEventScopeStub{
+				RecordedAtFunc: func() time.Time { return recordedAt },
+			}
+
+			before := time.Now().Truncate(time.Second)
+
+			if _, err := handler.HandleEvent(
+				t.Context(),
+				scope,
+				stubs.EventA1,
+			); err != nil {
+				t.Fatalf("unable to handle event: %s", err)
+			}
+
+			after := time.Now().Add(time.Second)
+
+			got, err := handler.ReadCheckpoint(
+				t.Context(),
+				scope.StreamID(),
+			)
+			if err != nil {
+				t.Fatalf("unable to read checkpoint: %s", err)
+			}
+
+			if got.StreamID != scope.StreamID() {
+				t.Fatalf("unexpected stream ID: got %q, want %q", got.StreamID, scope.StreamID())
+			}
+
+			if want := uint64(1); got.Offset != want {
+				t.Fatalf("unexpected checkpoint offset: got %d, want %d", got.Offset, want)
+			}
+
+			if got.UpdatedAt.Before(before) || got.UpdatedAt.After(after) {
+				t.Fatalf("unexpected update time: got %s, want between %s and %s", got.UpdatedAt, before, after)
+			}
+
+			if !got.EventRecordedAt.Equal(recordedAt) {
+				t.Fatalf("unexpected event recorded time: got %s, want %s", got.EventRecordedAt, recordedAt)
+			}
+		})
+
+		t.Run("it returns a zero checkpoint if no events from the stream have been applied", func(t *testing.T) {
+			handler := checkpointReader(t, setup(t, &Hooks{}))
+			id := "e108b1d5-f2c2-44f1-884d-a5cdc1d575f0"
+
+			got, err := handler.ReadCheckpoint(t.Context(), id)
+			if err != nil {
+				t.Fatalf("unable to read checkpoint: %s", err)
+			}
+
+			want := projectionkit.Checkpoint{StreamID: id}
+			if got != want {
+				t.Fatalf("unexpected checkpoint: got %+v, want %+v", got, want)
+			}
+		})
+
+		t.Run("it returns a zero checkpoint after a reset", func(t *testing.T) {
+			handler := checkpointReader(t, setup(t, &Hooks{}))
+			scope := &stubs.ProjectionEventScopeStub{}
+
+			if _, err := handler.HandleEvent(
+				t.Context(),
+				scope,
+				stubs.EventA1,
+			); err != nil {
+				t.Fatalf("unable to handle event: %s", err)
+			}
+
+			if err := handler.Reset(
+				t.Context(),
+				&stubs.ProjectionResetScopeStub{},
+			); err != nil {
+				t.Fatalf("unable to reset projection: %s", err)
+			}
+
+			got, err := handler.ReadCheckpoint(t.Context(), scope.StreamID())
+			if err != nil {
+				t.Fatalf("unable to read checkpoint: %s", err)
+			}
+
+			want := projectionkit.Checkpoint{StreamID: scope.StreamID()}
+			if got != want {
+				t.Fatalf("unexpected checkpoint: got %+v, want %+v", got, want)
+			}
+		})
+	})
+
+	t.Run("func ListCheckpoints()", func(t *testing.T) {
+		t.Run("it returns the checkpoints in order of stream ID", func(t *testing.T) {
+			handler := checkpointLister(t, setup(t, &Hooks{}))
+
+			handleEvent(t, handler, streamA, 0, 0)
+			handleEvent(t, handler, streamB, 0, 0)
+			handleEvent(t, handler, streamB, 1, 1)
+			handleEvent(t, handler, streamC, 0, 0)
+
+			got := listCheckpoints(t, handler, "", 10)
+			want := []struct {
+				StreamID string
+				Offset   uint64
+			}{
+				{streamB, 2},
+				{streamA, 1},
+				{streamC, 1},
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("unexpected number of checkpoints: got %d, want %d", len(got), len(want))
+			}
+
+			for i, cp := range got {
+				if cp.StreamID != want[i].StreamID || cp.Offset != want[i].Offset {
+					t.Fatalf(
+						"unexpected checkpoint at index %d: got %s@%d, want %s@%d",
+						i,
+						cp.StreamID,
+						cp.Offset,
+						want[i].StreamID,
+						want[i].Offset,
+					)
+				}
+			}
+		})
+
+		t.Run("it supports pagination", func(t *testing.T) {
+			handler := checkpointLister(t, setup(t, &Hooks{}))
+
+			handleEvent(t, handler, streamA, 0, 0)
+			handleEvent(t, handler, streamB, 0, 0)
+			handleEvent(t, handler, streamC, 0, 0)
+
+			var got []string
+			after := ""
+
+			for {
+				page := listCheckpoints(t, handler, after, 2)
+
+				for _, cp := range page {
+					got = append(got, cp.StreamID)
+				}
+
+				if len(page) < 2 {
+					break
+				}
+
+				after = page[len(page)-1].StreamID
+			}
+
+			want := []string{streamB, streamA, streamC}
+			if !slices.Equal(got, want) {
+				t.Fatalf("unexpected stream IDs: got %v, want %v", got, want)
+			}
+		})
+
+		t.Run("it returns an empty result if there are no checkpoints", func(t *testing.T) {
+			handler := checkpointLister(t, setup(t, &Hooks{}))
+
+			if got := listCheckpoints(t, handler, "", 10); len(got) != 0 {
+				t.Fatalf("unexpected checkpoints: got %v, want none", got)
+			}
+		})
+
+		t.Run("it does not return checkpoints that have been reset", func(t *testing.T) {
+			handler := checkpointLister(t, setup(t, &Hooks{}))
+
+			handleEvent(t, handler, streamA, 0, 0)
+
+			if err := handler.Reset(
+				t.Context(),
+				&stubs.ProjectionResetScopeStub{},
+			); err != nil {
+				t.Fatalf("unable to reset projection: %s", err)
+			}
+
+			if got := listCheckpoints(t, handler, "", 10); len(got) != 0 {
+				t.Fatalf("unexpected checkpoints: got %v, want none", got)
+			}
+		})
+	})
+
+	t.Run("func CountCheckpoints()", func(t *testing.T) {
+		t.Run("it returns the number of streams with checkpoints", func(t *testing.T) {
+			handler := checkpointLister(t, setup(t, &Hooks{}))
+
+			if got := countCheckpoints(t, handler); got != 0 {
+				t.Fatalf("unexpected count: got %d, want 0", got)
+			}
+
+			handleEvent(t, handler, streamA, 0, 0)
+			handleEvent(t, handler, streamA, 1, 1)
+			handleEvent(t, handler, streamB, 0, 0)
+
+			if got := countCheckpoints(t, handler); got != 2 {
+				t.Fatalf("unexpected count: got %d, want 2", got)
+			}
+		})
+	})
+
+	t.Run("func Compact()", func(t *testing.T) {
+		t.Run("it does not return an error", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+
+			if err := handler.Compact(
+				t.Context(),
+				&stubs.ProjectionCompactScopeStub{},
+			); err != nil {
+				t.Fatalf("unable to compact projection: %s", err)
+			}
+		})
+	})
+
+	t.Run("func Reset()", func(t *testing.T) {
+		t.Run("it resets the checkpoint offsets", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+			scope := &stubs.ProjectionEventScopeStub{}
+
+			if _, err := handler.HandleEvent(
+				t.Context(),
+				scope,
+				stubs.EventA1,
+			); err != nil {
+				t.Fatalf("unable to handle event: %s", err)
+			}
+
+			if err := handler.Reset(
+				t.Context(),
+				&stubs.ProjectionResetScopeStub{},
+			); err != nil {
+				t.Fatalf("unable to reset projection: %s", err)
+			}
+
+			got, err := handler.CheckpointOffset(
+				t.Context(),
+				scope.StreamID(),
+			)
+			if err != nil {
+				t.Fatalf("unable to load checkpoint offset: %s", err)
+			}
+
+			if want := uint64(0); got != want {
+				t.Fatalf("unexpected checkpoint offset: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("can be called when the projection is empty", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+
+			if err := handler.Reset(
+				t.Context(),
+				&stubs.ProjectionResetScopeStub{},
+			); err != nil {
+				t.Fatalf("unable to reset projection: %s", err)
+			}
+		})
+
+		t.Run("can be called when the projection has already been reset", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+
+			if _, err := handler.HandleEvent(
+				t.Context(),
+				&stubs.ProjectionEventScopeStub{},
+				stubs.EventA1,
+			); err != nil {
+				t.Fatalf("unable to handle event: %s", err)
+			}
+
+			if err := handler.Reset(
+				t.Context(),
+				&stubs.ProjectionResetScopeStub{},
+			); err != nil {
+				t.Fatalf("unable to reset projection the first time: %s", err)
+			}
+
+			if err := handler.Reset(
+				t.Context(),
+				&stubs.ProjectionResetScopeStub{},
+			); err != nil {
+				t.Fatalf("unable to reset projection the second time: %s", err)
+			}
+		})
+	})
+
+	t.Run("when the underlying handler fails", func(t *testing.T) {
+		t.Run("func HandleEvent()", func(t *testing.T) {
+			t.Run("it does not update the checkpoint offset", func(t *testing.T) {
+				hooks := &Hooks{}
+				handler := setup(t, hooks)
+				want := errors.New("<error>")
+
+				hooks.failHandleEvent(want)
+
+				_, err := handler.HandleEvent(
+					t.Context(),
+					&stubs.ProjectionEventScopeStub{},
+					stubs.EventA1,
+				)
+
+				if !hooks.handleEventCalled() {
+					t.Skip("handler does not call Hooks.HandleEvent()")
+				}
+
+				if !errors.Is(err, want) {
+					t.Fatalf("unexpected error: got %v, want %v", err, want)
+				}
+
+				if got := checkpointOffset(t, handler, streamA); got != 0 {
+					t.Fatalf("unexpected checkpoint offset: got %d, want 0", got)
+				}
+
+				hooks.failHandleEvent(nil)
+
+				if got := handleEvent(t, handler, streamA, 0, 0); got != 1 {
+					t.Fatalf("unexpected checkpoint offset after retry: got %d, want 1", got)
+				}
+			})
+		})
+
+		t.Run("func Reset()", func(t *testing.T) {
+			t.Run("it does not reset the checkpoint offsets", func(t *testing.T) {
+				hooks := &Hooks{}
+				handler := setup(t, hooks)
+				want := errors.New("<error>")
+
+				handleEvent(t, handler, streamA, 0, 0)
+				hooks.failReset(want)
+
+				err := handler.Reset(
+					t.Context(),
+					&stubs.ProjectionResetScopeStub{},
+				)
+
+				if !hooks.resetCalled() {
+					t.Skip("handler does not call Hooks.Reset()")
+				}
+
+				if !errors.Is(err, want) {
+					t.Fatalf("unexpected error: got %v, want %v", err, want)
+				}
+
+				if got := checkpointOffset(t, handler, streamA); got != 1 {
+					t.Fatalf("unexpected checkpoint offset: got %d, want 1", got)
+				}
+			})
+		})
+	})
+
+	t.Run("when there are multiple streams", func(t *testing.T) {
+		t.Run("it tracks the checkpoint offset of each stream independently", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+
+			handleEvent(t, handler, streamA, 0, 0)
+			handleEvent(t, handler, streamB, 0, 0)
+			handleEvent(t, handler, streamA, 1, 1)
+			handleEvent(t, handler, streamA, 5, 2) // skip over unrouted events
+
+			if got, want := checkpointOffset(t, handler, streamA), uint64(6); got != want {
+				t.Fatalf("unexpected checkpoint offset for stream A: got %d, want %d", got, want)
+			}
+
+			if got, want := checkpointOffset(t, handler, streamB), uint64(1); got != want {
+				t.Fatalf("unexpected checkpoint offset for stream B: got %d, want %d", got, want)
+			}
+		})
+
+		t.Run("it does not apply a checkpoint offset from one stream to another", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+
+			handleEvent(t, handler, streamA, 0, 0)
+
+			if got := handleEvent(t, handler, streamB, 1, 1); got != 0 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 0", got)
+			}
+		})
+
+		t.Run("func Reset()", func(t *testing.T) {
+			t.Run("it resets the checkpoint offsets of all streams", func(t *testing.T) {
+				handler := setup(t, &Hooks{})
+
+				handleEvent(t, handler, streamA, 0, 0)
+				handleEvent(t, handler, streamB, 0, 0)
+
+				if err := handler.Reset(
+					t.Context(),
+					&stubs.ProjectionResetScopeStub{},
+				); err != nil {
+					t.Fatalf("unable to reset projection: %s", err)
+				}
+
+				for _, id := range []string{streamA, streamB} {
+					if got := checkpointOffset(t, handler, id); got != 0 {
+						t.Fatalf("unexpected checkpoint offset for %s: got %d, want 0", id, got)
+					}
+				}
+			})
+		})
+	})
+
+	t.Run("when resets are interleaved with events", func(t *testing.T) {
+		setup := func(t *testing.T) dogma.ProjectionMessageHandler {
+			handler := setup(t, &Hooks{})
+
+			handleEvent(t, handler, streamA, 0, 0)
+			handleEvent(t, handler, streamA, 1, 1)
+
+			if err := handler.Reset(
+				t.Context(),
+				&stubs.ProjectionResetScopeStub{},
+			); err != nil {
+				t.Fatalf("unable to reset projection: %s", err)
+			}
+
+			return handler
+		}
+
+		t.Run("it accepts events from the start of the stream", func(t *testing.T) {
+			handler := setup(t)
+
+			if got := handleEvent(t, handler, streamA, 0, 0); got != 1 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 1", got)
+			}
+		})
+
+		t.Run("it rejects the checkpoint offset from before the reset", func(t *testing.T) {
+			handler := setup(t)
+
+			if got := handleEvent(t, handler, streamA, 2, 2); got != 0 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 0", got)
+			}
+		})
+
+		t.Run("it can be reset again after handling more events", func(t *testing.T) {
+			handler := setup(t)
+
+			handleEvent(t, handler, streamA, 0, 0)
+
+			if err := handler.Reset(
+				t.Context(),
+				&stubs.ProjectionResetScopeStub{},
+			); err != nil {
+				t.Fatalf("unable to reset projection: %s", err)
+			}
+
+			if got := checkpointOffset(t, handler, streamA); got != 0 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 0", got)
+			}
+		})
+	})
+
+	t.Run("when events are delivered concurrently", func(t *testing.T) {
+		t.Run("it handles events from different streams in parallel", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+
+			const (
+				streams = 5
+				events  = 5
+			)
+
+			var g sync.WaitGroup
+
+			for i := range streams {
+				id := fmt.Sprintf("b8e4c6e0-36b5-4b6c-9d4a-%012x", i)
+
+				g.Go(func() {
+					for offset := range uint64(events) {
+						cp, err := handler.HandleEvent(
+							t.Context(),
+							&stubs.ProjectionEventScopeStub{
+								StreamIDFunc:         func() string { return id },
+								OffsetFunc:           func() uint64 { return offset },
+								CheckpointOffsetFunc: func() uint64 { return offset },
+							},
+							stubs.EventA1,
+						)
+						if err != nil {
+							t.Errorf("unable to handle event at offset %d of %s: %s", offset, id, err)
+							return
+						}
+
+						if want := offset + 1; cp != want {
+							t.Errorf("unexpected checkpoint offset for %s: got %d, want %d", id, cp, want)
+							return
+						}
+					}
+				})
+			}
+
+			g.Wait()
+
+			for i := range streams {
+				id := fmt.Sprintf("b8e4c6e0-36b5-4b6c-9d4a-%012x", i)
+
+				if got := checkpointOffset(t, handler, id); got != events {
+					t.Fatalf("unexpected checkpoint offset for %s: got %d, want %d", id, got, events)
+				}
+			}
+		})
+
+		t.Run("it applies a duplicated event at most once", func(t *testing.T) {
+			handler := setup(t, &Hooks{})
+
+			const deliveries = 10
+
+			var (
+				g         sync.WaitGroup
+				m         sync.Mutex
+				successes int
+			)
+
+			for range deliveries {
+				g.Go(func() {
+					cp, err := handler.HandleEvent(
+						t.Context(),
+						&stubs.ProjectionEventScopeStub{},
+						stubs.EventA1,
+					)
+					if err != nil {
+						// Transient errors caused by the conflicting deliveries
+						// are acceptable, as the engine retries them.
+						t.Logf("concurrent delivery failed: %s", err)
+						return
+					}
+
+					if cp != 1 {
+						t.Errorf("unexpected checkpoint offset: got %d, want 1", cp)
+						return
+					}
+
+					m.Lock()
+					successes++
+					m.Unlock()
+				})
+			}
+
+			g.Wait()
+
+			if successes == 0 {
+				t.Fatal("expected at least one delivery to succeed")
+			}
+
+			// A subsequent event must only be accepted at the checkpoint offset
+			// produced by exactly one application of the duplicated event.
+			if got := handleEvent(t, handler, streamA, 1, 1); got != 2 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 2", got)
+			}
+		})
+	})
+}
+
+const (
+	// streamA, streamB and streamC are the stream IDs used by tests that
+	// require multiple streams. streamA is the default stream ID used by
+	// [stubs.ProjectionEventScopeStub].
+	//
+	// Ordered by ID, the streams are B, A, C.
+	streamA = "6d1e805f-1760-409f-b1eb-e14983ec3f68"
+	streamB = "0c1a2b3d-4e5f-4a6b-8c7d-8e9f0a1b2c3d"
+	streamC = "f2e1d0c9-b8a7-4f6e-9d5c-4b3a29181706"
+)
+
+// handleEvent handles an event from the given stream, failing the test if an
+// error occurs. It returns the checkpoint offset reported by the handler.
+func handleEvent(
+	t *testing.T,
+	handler dogma.ProjectionMessageHandler,
+	id string,
+	offset, checkpoint uint64,
+) uint64 {
+	t.Helper()
+
+	cp, err := handler.HandleEvent(
+		t.Context(),
+		&stubs.ProjectionEventScopeStub{
+			StreamIDFunc:         func() string { return id },
+			OffsetFunc:           func() uint64 { return offset },
+			CheckpointOffsetFunc: func() uint64 { return checkpoint },
+		},
+		stubs.EventA1,
+	)
+	if err != nil {
+		t.Fatalf("unable to handle event at offset %d of %s: %s", offset, id, err)
+	}
+
+	return cp
+}
+
+// checkpointOffset returns the checkpoint offset of the given stream, failing
+// the test if an error occurs.
+func checkpointOffset(
+	t *testing.T,
+	handler dogma.ProjectionMessageHandler,
+	id string,
+) uint64 {
+	t.Helper()
+
+	cp, err := handler.CheckpointOffset(t.Context(), id)
+	if err != nil {
+		t.Fatalf("unable to load checkpoint offset of %s: %s", id, err)
+	}
+
+	return cp
+}
+
+// checkpointReader returns handler as a [projectionkit.CheckpointReader], or
+// skips the test if it does not implement that interface.
+func checkpointReader(
+	t *testing.T,
+	handler dogma.ProjectionMessageHandler,
+) projectionkit.CheckpointReader {
+	t.Helper()
+
+	r, ok := handler.(projectionkit.CheckpointReader)
+	if !ok {
+		t.Skip("handler does not implement projectionkit.CheckpointReader")
+	}
+
+	return r
+}
+
+// checkpointLister returns handler as a [projectionkit.CheckpointLister], or
+// skips the test if it does not implement that interface.
+func checkpointLister(
+	t *testing.T,
+	handler dogma.ProjectionMessageHandler,
+) projectionkit.CheckpointLister {
+	t.Helper()
+
+	l, ok := handler.(projectionkit.CheckpointLister)
+	if !ok {
+		t.Skip("handler does not implement projectionkit.CheckpointLister")
+	}
+
+	return l
+}
+
+// listCheckpoints returns a page of checkpoints, failing the test if an error
+// occurs.
+func listCheckpoints(
+	t *testing.T,
+	handler projectionkit.CheckpointLister,
+	after string,
+	limit int,
+) []projectionkit.Checkpoint {
+	t.Helper()
+
+	checkpoints, err := handler.ListCheckpoints(t.Context(), after, limit)
+	if err != nil {
+		t.Fatalf("unable to list checkpoints: %s", err)
+	}
+
+	return checkpoints
+}
+
+// countCheckpoints returns the number of checkpoints, failing the test if an
+// error occurs.
+func countCheckpoints(
+	t *testing.T,
+	handler projectionkit.CheckpointLister,
+) uint64 {
+	t.Helper()
+
+	n, err := handler.CountCheckpoints(t.Context())
+	if err != nil {
+		t.Fatalf("unable to count checkpoints: %s", err)
+	}
+
+	return n
+}
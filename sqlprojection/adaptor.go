@@ -3,38 +3,63 @@ package sqlprojection
 import (
 	"context"
 	"database/sql"
+	"sync"
+	"time"
 
 	"github.com/dogmatiq/dogma"
 	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
 	"github.com/dogmatiq/projectionkit/internal/identity"
 )
 
 // adaptor adapts an sqlprojection.ProjectionMessageHandler to the
 // [dogma.ProjectionMessageHandler] interface.
 type adaptor struct {
-	DB      *sql.DB
-	Driver  Driver
-	Handler MessageHandler
+	DB              *sql.DB
+	Driver          Driver
+	Handler         MessageHandler
+	MaxBatchSize    int
+	MaxBatchLatency time.Duration
+	Retry           retryPolicy
+	TxOptions       *sql.TxOptions
+	EventTxOptions  func(dogma.Event) *sql.TxOptions
 
 	handlerKey [16]byte
+	batchesM   sync.Mutex
+	batches    map[[16]byte]*batch
 }
 
 // New returns a new [dogma.ProjectionMessageHandler] that binds an
 // SQL-specific [MessageHandler] to an SQL database.
+//
+// The returned handler also implements [projectionkit.CheckpointLister].
 func New(
 	db *sql.DB,
 	d Driver,
 	h MessageHandler,
+	options ...Option,
 ) dogma.ProjectionMessageHandler {
-	return &adaptor{
+	checkTableOwner(h)
+
+	a := &adaptor{
 		DB:      db,
 		Driver:  d,
 		Handler: h,
+		Retry:   defaultRetryPolicy,
 
 		handlerKey: identity.Key(h),
 	}
+
+	for _, opt := range options {
+		opt(a)
+	}
+
+	return a
 }
 
+// Option is a functional option that changes the behavior of [New].
+type Option func(*adaptor)
+
 func (a *adaptor) Configure(c dogma.ProjectionConfigurer) {
 	a.Handler.Configure(c)
 }
@@ -44,48 +69,135 @@ func (a *adaptor) HandleEvent(
 	s dogma.ProjectionEventScope,
 	m dogma.Event,
 ) (uint64, error) {
-	tx, err := a.DB.BeginTx(ctx, nil)
-	if err != nil {
+	if a.MaxBatchSize != 0 {
+		return a.handleEventInBatch(ctx, s, m)
+	}
+
+	var ok bool
+
+	// The entire transaction is retried if it fails with a transient error,
+	// such as a serialization failure. A stale checkpoint offset is not an
+	// error, so it's never retried.
+	if err := a.Retry.Do(ctx, a.Driver, func(ctx context.Context) (err error) {
+		ok, err = a.handleEvent(ctx, s, m)
+		return err
+	}); err != nil {
 		return 0, err
 	}
-	defer tx.Rollback() // nolint:errcheck
 
-	id := uuidpb.MustParseAsBytes(s.StreamID())
-	cp := s.Offset() + 1
+	if ok {
+		return s.Offset() + 1, nil
+	}
+
+	return a.Driver.QueryCheckpointOffset(
+		ctx,
+		a.DB,
+		a.handlerKey[:],
+		uuidpb.MustParseAsBytes(s.StreamID()),
+	)
+}
+
+// handleEvent handles an event within a new transaction.
+//
+// It returns false if the checkpoint offset provided by the engine is stale.
+func (a *adaptor) handleEvent(
+	ctx context.Context,
+	s dogma.ProjectionEventScope,
+	m dogma.Event,
+) (bool, error) {
+	tx, release, err := a.beginTx(ctx, a.txOptions(m))
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	defer tx.Rollback() // nolint:errcheck
 
 	ok, err := a.Driver.UpdateCheckpointOffset(
 		ctx,
 		tx,
 		a.handlerKey[:],
-		id,
+		uuidpb.MustParseAsBytes(s.StreamID()),
 		s.CheckpointOffset(),
-		cp,
+		s.Offset()+1,
+		s.RecordedAt(),
 	)
-	if err != nil {
-		return 0, err
+	if !ok || err != nil {
+		return false, err
 	}
 
-	if ok {
-		if err := a.Handler.HandleEvent(ctx, tx, s, m); err != nil {
-			return 0, err
-		}
-		return cp, tx.Commit()
+	if err := a.Handler.HandleEvent(ctx, tx, s, m); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (a *adaptor) CheckpointOffset(ctx context.Context, id string) (uint64, error) {
+	streamID := uuidpb.MustParseAsByteArray(id)
+
+	if err := a.flushBatch(ctx, streamID); err != nil {
+		return 0, err
 	}
 
 	return a.Driver.QueryCheckpointOffset(
 		ctx,
 		a.DB,
 		a.handlerKey[:],
-		id,
+		streamID[:],
 	)
 }
 
-func (a *adaptor) CheckpointOffset(ctx context.Context, id string) (uint64, error) {
-	return a.Driver.QueryCheckpointOffset(
+func (a *adaptor) ReadCheckpoint(ctx context.Context, id string) (projectionkit.Checkpoint, error) {
+	streamID := uuidpb.MustParseAsByteArray(id)
+
+	if err := a.flushBatch(ctx, streamID); err != nil {
+		return projectionkit.Checkpoint{}, err
+	}
+
+	return a.Driver.QueryCheckpoint(
+		ctx,
+		a.DB,
+		a.handlerKey[:],
+		streamID[:],
+	)
+}
+
+func (a *adaptor) ListCheckpoints(
+	ctx context.Context,
+	after string,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	if limit <= 0 {
+		panic("limit must be positive")
+	}
+
+	var streamID []byte
+	if after != "" {
+		streamID = uuidpb.MustParseAsBytes(after)
+	}
+
+	if err := a.flushBatches(ctx); err != nil {
+		return nil, err
+	}
+
+	return a.Driver.QueryCheckpoints(
+		ctx,
+		a.DB,
+		a.handlerKey[:],
+		streamID,
+		limit,
+	)
+}
+
+func (a *adaptor) CountCheckpoints(ctx context.Context) (uint64, error) {
+	if err := a.flushBatches(ctx); err != nil {
+		return 0, err
+	}
+
+	return a.Driver.CountCheckpoints(
 		ctx,
 		a.DB,
 		a.handlerKey[:],
-		uuidpb.MustParseAsBytes(id),
 	)
 }
 
@@ -94,13 +206,28 @@ func (a *adaptor) Compact(ctx context.Context, s dogma.ProjectionCompactScope) e
 }
 
 func (a *adaptor) Reset(ctx context.Context, s dogma.ProjectionResetScope) error {
-	tx, err := a.DB.BeginTx(ctx, nil)
+	// Commit any batches in progress before resetting, otherwise they could
+	// be committed after the reset.
+	if err := a.flushBatches(ctx); err != nil {
+		return err
+	}
+
+	return a.Retry.Do(ctx, a.Driver, func(ctx context.Context) error {
+		return a.reset(ctx, s)
+	})
+}
+
+// reset resets the projection within a new transaction.
+func (a *adaptor) reset(ctx context.Context, s dogma.ProjectionResetScope) error {
+	tx, release, err := a.beginTx(ctx, a.TxOptions)
 	if err != nil {
 		return err
 	}
+	defer release()
 	defer tx.Rollback() // nolint:errcheck
 
-	if err := a.Handler.Reset(ctx, tx, s); err != nil {
+	truncate, err := resetData(ctx, a.DB, a.Driver, tx, a.Handler, s)
+	if err != nil {
 		return err
 	}
 
@@ -112,5 +239,31 @@ func (a *adaptor) Reset(ctx context.Context, s dogma.ProjectionResetScope) error
 		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Tables that can not be truncated within the transaction are truncated
+	// once the checkpoint offsets have been deleted.
+	if truncate != nil {
+		return truncate(ctx)
+	}
+
+	return nil
+}
+
+// beginTx begins a transaction using the given options.
+//
+// The returned function must be called after the transaction has been
+// committed or rolled back.
+func (a *adaptor) beginTx(
+	ctx context.Context,
+	opts *sql.TxOptions,
+) (*sql.Tx, func(), error) {
+	if b, ok := a.Driver.(txBeginner); ok {
+		return b.BeginTx(ctx, a.DB, opts)
+	}
+
+	tx, err := a.DB.BeginTx(ctx, opts)
+	return tx, func() {}, err
 }
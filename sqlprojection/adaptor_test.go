@@ -1,22 +1,37 @@
 package sqlprojection_test
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/dogmatiq/dogma"
+	"github.com/dogmatiq/enginekit/config/runtimeconfig"
 	. "github.com/dogmatiq/enginekit/enginetest/stubs"
-	"github.com/dogmatiq/projectionkit/internal/handlertest"
+	"github.com/dogmatiq/enginekit/message"
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
+	"github.com/dogmatiq/projectionkit/projectiontest"
 	. "github.com/dogmatiq/projectionkit/sqlprojection"
 	"github.com/dogmatiq/projectionkit/sqlprojection/internal/fixtures" // can't dot-import due to conflict
 )
 
+// runTests runs the tests for a specific [Driver].
+//
+// isolationQuery is a query that returns the isolation level of the current
+// transaction, or an empty string if the database does not support isolation
+// levels.
 func runTests(
 	t *testing.T,
 	driverName, dsn string,
 	driver Driver,
+	isolationQuery string,
 ) {
 	db, err := sql.Open(driverName, dsn)
 	if err != nil {
@@ -26,7 +41,7 @@ func runTests(
 		db.Close()
 	})
 
-	setup := func(t *testing.T) (deps struct {
+	setup := func(t *testing.T, options ...Option) (deps struct {
 		Handler *fixtures.MessageHandler
 		Adaptor dogma.ProjectionMessageHandler
 	}) {
@@ -44,21 +59,44 @@ func runTests(
 
 		deps.Handler = &fixtures.MessageHandler{
 			ConfigureFunc: func(c dogma.ProjectionConfigurer) {
-				c.Identity("<projection>", handlertest.IdentityKey)
+				c.Identity("<projection>", projectiontest.IdentityKey)
 			},
 		}
 
-		deps.Adaptor = New(db, driver, deps.Handler)
+		deps.Adaptor = New(db, driver, deps.Handler, options...)
 
 		return deps
 	}
 
-	handlertest.Run(
-		t,
-		func(t *testing.T) dogma.ProjectionMessageHandler {
-			return setup(t).Adaptor
-		},
-	)
+	conformance := func(t *testing.T, options ...Option) {
+		projectiontest.Run(
+			t,
+			func(t *testing.T, h *projectiontest.Hooks) dogma.ProjectionMessageHandler {
+				deps := setup(t, options...)
+
+				deps.Handler.HandleEventFunc = func(
+					_ context.Context,
+					_ *sql.Tx,
+					s dogma.ProjectionEventScope,
+					m dogma.Event,
+				) error {
+					return h.HandleEvent(s, m)
+				}
+
+				deps.Handler.ResetFunc = func(
+					_ context.Context,
+					_ *sql.Tx,
+					s dogma.ProjectionResetScope,
+				) error {
+					return h.Reset(s)
+				}
+
+				return deps.Adaptor
+			},
+		)
+	}
+
+	conformance(t)
 
 	t.Run("func HandleEvent()", func(t *testing.T) {
 		t.Run("it forwards to the handler", func(t *testing.T) {
@@ -84,68 +122,2269 @@ func runTests(
 				t.Fatalf("unexpected error: got %v, want %v", got, want)
 			}
 		})
-	})
 
-	t.Run("func Compact()", func(t *testing.T) {
-		t.Run("it forwards to the handler", func(t *testing.T) {
+		t.Run("it retries the transaction if the driver considers the error retryable", func(t *testing.T) {
 			deps := setup(t)
-			want := errors.New("<error>")
+			retryable := errors.New("<retryable>")
+			attempts := 0
 
-			deps.Handler.CompactFunc = func(
-				_ context.Context,
-				d *sql.DB,
-				_ dogma.ProjectionCompactScope,
+			deps.Handler.HandleEventFunc = func(
+				context.Context,
+				*sql.Tx,
+				dogma.ProjectionEventScope,
+				dogma.Event,
 			) error {
-				if d != db {
-					t.Fatal("received unexpected db instance")
+				attempts++
+				if attempts < 3 {
+					return retryable
 				}
+				return nil
+			}
+
+			adaptor := New(
+				db,
+				retryableErrorDriver{driver, retryable},
+				deps.Handler,
+				WithRetry(5, 0, time.Millisecond),
+			)
+
+			cp, err := adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{},
+				EventA1,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cp != 1 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 1", cp)
+			}
+
+			if attempts != 3 {
+				t.Fatalf("unexpected number of attempts: got %d, want 3", attempts)
+			}
+		})
+
+		t.Run("it does not retry the transaction if the error is not retryable", func(t *testing.T) {
+			deps := setup(t)
+			want := errors.New("<error>")
+			attempts := 0
+
+			deps.Handler.HandleEventFunc = func(
+				context.Context,
+				*sql.Tx,
+				dogma.ProjectionEventScope,
+				dogma.Event,
+			) error {
+				attempts++
 				return want
 			}
 
-			got := deps.Adaptor.Compact(
+			adaptor := New(db, retryableErrorDriver{driver, errors.New("<retryable>")}, deps.Handler)
+
+			if _, err := adaptor.HandleEvent(
 				t.Context(),
-				&ProjectionCompactScopeStub{},
+				&ProjectionEventScopeStub{},
+				EventA1,
+			); err != want {
+				t.Fatalf("unexpected error: got %v, want %v", err, want)
+			}
+
+			if attempts != 1 {
+				t.Fatalf("unexpected number of attempts: got %d, want 1", attempts)
+			}
+		})
+
+		t.Run("it gives up after the maximum number of attempts", func(t *testing.T) {
+			deps := setup(t)
+			retryable := errors.New("<retryable>")
+			attempts := 0
+
+			deps.Handler.HandleEventFunc = func(
+				context.Context,
+				*sql.Tx,
+				dogma.ProjectionEventScope,
+				dogma.Event,
+			) error {
+				attempts++
+				return retryable
+			}
+
+			adaptor := New(
+				db,
+				retryableErrorDriver{driver, retryable},
+				deps.Handler,
+				WithRetry(3, 0, time.Millisecond),
 			)
 
-			if got != want {
-				t.Fatalf("unexpected error: got %v, want %v", got, want)
+			if _, err := adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{},
+				EventA1,
+			); err != retryable {
+				t.Fatalf("unexpected error: got %v, want %v", err, retryable)
+			}
+
+			if attempts != 3 {
+				t.Fatalf("unexpected number of attempts: got %d, want 3", attempts)
+			}
+		})
+
+		t.Run("it does not retry the transaction if the checkpoint offset is stale", func(t *testing.T) {
+			deps := setup(t)
+			attempts := 0
+
+			deps.Handler.HandleEventFunc = func(
+				context.Context,
+				*sql.Tx,
+				dogma.ProjectionEventScope,
+				dogma.Event,
+			) error {
+				attempts++
+				return nil
+			}
+
+			// Treat every error as retryable, so that any attempt to retry
+			// would be observed.
+			adaptor := New(
+				db,
+				alwaysRetryableDriver{driver},
+				deps.Handler,
+				WithRetry(5, 0, time.Millisecond),
+			)
+
+			cp, err := adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{
+					CheckpointOffsetFunc: func() uint64 { return 1 },
+				},
+				EventA1,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cp != 0 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 0", cp)
+			}
+
+			if attempts != 0 {
+				t.Fatalf("unexpected number of attempts: got %d, want 0", attempts)
 			}
 		})
 	})
 
-	t.Run("schema management", func(t *testing.T) {
-		t.Run("func CreateSchema()", func(t *testing.T) {
-			t.Run("it can be called when the schema already exists", func(t *testing.T) {
-				if err := driver.CreateSchema(t.Context(), db); err != nil {
-					t.Fatalf("unable to create schema the first time: %s", err)
-				}
+	t.Run("func Reset()", func(t *testing.T) {
+		t.Run("it retries the transaction if the driver considers the error retryable", func(t *testing.T) {
+			deps := setup(t)
+			retryable := errors.New("<retryable>")
+			attempts := 0
 
-				if err := driver.CreateSchema(t.Context(), db); err != nil {
-					t.Fatalf("unable to create schema the second time: %s", err)
+			deps.Handler.ResetFunc = func(
+				context.Context,
+				*sql.Tx,
+				dogma.ProjectionResetScope,
+			) error {
+				attempts++
+				if attempts < 3 {
+					return retryable
 				}
-			})
+				return nil
+			}
+
+			adaptor := New(
+				db,
+				retryableErrorDriver{driver, retryable},
+				deps.Handler,
+				WithRetry(5, 0, time.Millisecond),
+			)
+
+			if err := adaptor.Reset(
+				t.Context(),
+				&ProjectionResetScopeStub{},
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			if attempts != 3 {
+				t.Fatalf("unexpected number of attempts: got %d, want 3", attempts)
+			}
 		})
 
-		t.Run("func DropSchema()", func(t *testing.T) {
-			t.Run("it can be called when the schema does not exist", func(t *testing.T) {
-				if err := driver.DropSchema(t.Context(), db); err != nil {
+		t.Run("when the handler owns its tables", func(t *testing.T) {
+			t.Run("it truncates the tables instead of calling Reset()", func(t *testing.T) {
+				deps := setup(t)
+				table := createDataTable(t, db, driver)
+
+				handler := &fixtures.TableOwner{
+					MessageHandler: *deps.Handler,
+					TablesFunc: func() []string {
+						return []string{table}
+					},
+				}
+
+				handler.HandleEventFunc = func(
+					ctx context.Context,
+					tx *sql.Tx,
+					_ dogma.ProjectionEventScope,
+					_ dogma.Event,
+				) error {
+					_, err := tx.ExecContext(ctx, `INSERT INTO `+table+` (id) VALUES (1)`)
+					return err
+				}
+
+				handler.ResetFunc = func(
+					context.Context,
+					*sql.Tx,
+					dogma.ProjectionResetScope,
+				) error {
+					t.Fatal("unexpected call")
+					return nil
+				}
+
+				adaptor := New(db, driver, handler)
+				scope := &ProjectionEventScopeStub{}
+
+				if _, err := adaptor.HandleEvent(t.Context(), scope, EventA1); err != nil {
 					t.Fatal(err)
 				}
+
+				if err := adaptor.Reset(
+					t.Context(),
+					&ProjectionResetScopeStub{},
+				); err != nil {
+					t.Fatal(err)
+				}
+
+				if n := countRows(t, db, table); n != 0 {
+					t.Fatalf("unexpected number of rows: got %d, want 0", n)
+				}
+
+				cp, err := adaptor.CheckpointOffset(t.Context(), scope.StreamID())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if cp != 0 {
+					t.Fatalf("unexpected checkpoint offset: got %d, want 0", cp)
+				}
 			})
 
-			t.Run("it can be called when the schema has already been dropped", func(t *testing.T) {
-				if err := driver.CreateSchema(t.Context(), db); err != nil {
-					t.Fatalf("unable to create schema: %s", err)
+			t.Run("it does not reset the projection if a table name is invalid", func(t *testing.T) {
+				deps := setup(t)
+				table := createDataTable(t, db, driver)
+
+				handler := &fixtures.TableOwner{
+					MessageHandler: *deps.Handler,
+					TablesFunc: func() []string {
+						return []string{table, table + "; DELETE FROM " + table}
+					},
 				}
 
-				if err := driver.DropSchema(t.Context(), db); err != nil {
-					t.Fatalf("unable to drop schema the first time: %s", err)
+				handler.HandleEventFunc = func(
+					ctx context.Context,
+					tx *sql.Tx,
+					_ dogma.ProjectionEventScope,
+					_ dogma.Event,
+				) error {
+					_, err := tx.ExecContext(ctx, `INSERT INTO `+table+` (id) VALUES (1)`)
+					return err
 				}
 
-				if err := driver.DropSchema(t.Context(), db); err != nil {
-					t.Fatalf("unable to drop schema the second time: %s", err)
+				adaptor := New(db, driver, handler)
+				scope := &ProjectionEventScopeStub{}
+
+				if _, err := adaptor.HandleEvent(t.Context(), scope, EventA1); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := adaptor.Reset(
+					t.Context(),
+					&ProjectionResetScopeStub{},
+				); err == nil {
+					t.Fatal("expected an error")
+				}
+
+				if n := countRows(t, db, table); n != 1 {
+					t.Fatalf("unexpected number of rows: got %d, want 1", n)
+				}
+
+				cp, err := adaptor.CheckpointOffset(t.Context(), scope.StreamID())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if cp != 1 {
+					t.Fatalf("unexpected checkpoint offset: got %d, want 1", cp)
 				}
 			})
 		})
 	})
+
+	t.Run("transaction options", func(t *testing.T) {
+		serializable := &sql.TxOptions{Isolation: sql.LevelSerializable}
+
+		isolationLevel := func(t *testing.T, ctx context.Context, tx *sql.Tx) string {
+			t.Helper()
+
+			var level string
+			if err := tx.QueryRowContext(ctx, isolationQuery).Scan(&level); err != nil {
+				t.Fatalf("unable to query isolation level: %s", err)
+			}
+
+			return level
+		}
+
+		t.Run("it begins the transaction with the configured options", func(t *testing.T) {
+			if isolationQuery == "" {
+				t.Skip("the database does not support isolation levels")
+			}
+
+			deps := setup(t, WithTxOptions(serializable))
+
+			var level string
+			deps.Handler.HandleEventFunc = func(
+				ctx context.Context,
+				tx *sql.Tx,
+				_ dogma.ProjectionEventScope,
+				_ dogma.Event,
+			) error {
+				level = isolationLevel(t, ctx, tx)
+				return nil
+			}
+
+			if _, err := deps.Adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{},
+				EventA1,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.EqualFold(level, "serializable") {
+				t.Fatalf("unexpected isolation level: got %q, want %q", level, "serializable")
+			}
+		})
+
+		t.Run("it begins the transaction with the options returned by the hook", func(t *testing.T) {
+			if isolationQuery == "" {
+				t.Skip("the database does not support isolation levels")
+			}
+
+			deps := setup(
+				t,
+				WithEventTxOptions(func(m dogma.Event) *sql.TxOptions {
+					if m == EventA1 {
+						return serializable
+					}
+					return nil
+				}),
+			)
+
+			var level string
+			deps.Handler.HandleEventFunc = func(
+				ctx context.Context,
+				tx *sql.Tx,
+				_ dogma.ProjectionEventScope,
+				_ dogma.Event,
+			) error {
+				level = isolationLevel(t, ctx, tx)
+				return nil
+			}
+
+			if _, err := deps.Adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{},
+				EventA1,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.EqualFold(level, "serializable") {
+				t.Fatalf("unexpected isolation level: got %q, want %q", level, "serializable")
+			}
+		})
+
+		t.Run("it begins the reset transaction with the configured options", func(t *testing.T) {
+			if isolationQuery == "" {
+				t.Skip("the database does not support isolation levels")
+			}
+
+			deps := setup(t, WithTxOptions(serializable))
+
+			var level string
+			deps.Handler.ResetFunc = func(
+				ctx context.Context,
+				tx *sql.Tx,
+				_ dogma.ProjectionResetScope,
+			) error {
+				level = isolationLevel(t, ctx, tx)
+				return nil
+			}
+
+			if err := deps.Adaptor.Reset(
+				t.Context(),
+				&ProjectionResetScopeStub{},
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.EqualFold(level, "serializable") {
+				t.Fatalf("unexpected isolation level: got %q, want %q", level, "serializable")
+			}
+		})
+
+		t.Run("it passes the event to the hook", func(t *testing.T) {
+			var events []dogma.Event
+
+			deps := setup(
+				t,
+				WithEventTxOptions(func(m dogma.Event) *sql.TxOptions {
+					events = append(events, m)
+					return nil
+				}),
+			)
+
+			if _, err := deps.Adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{},
+				EventA1,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(events) != 1 || events[0] != EventA1 {
+				t.Fatalf("unexpected events passed to hook: got %v, want [%v]", events, EventA1)
+			}
+		})
+	})
+
+	t.Run("declarative handlers", func(t *testing.T) {
+		setup := func(t *testing.T) *HandlerBuilder {
+			t.Helper()
+
+			if _, err := db.ExecContext(
+				t.Context(),
+				`CREATE TABLE declarative_data (
+					id    VARCHAR(100) NOT NULL PRIMARY KEY,
+					value VARCHAR(100) NOT NULL
+				)`,
+			); err != nil {
+				t.Fatalf("cannot create projection table: %s", err)
+			}
+
+			t.Cleanup(func() {
+				if _, err := db.ExecContext(
+					context.Background(),
+					`DROP TABLE declarative_data`,
+				); err != nil {
+					t.Fatalf("cannot drop projection table: %s", err)
+				}
+			})
+
+			if err := driver.CreateSchema(t.Context(), db); err != nil {
+				t.Fatalf("cannot create schema: %s", err)
+			}
+
+			t.Cleanup(func() {
+				if err := driver.DropSchema(context.Background(), db); err != nil {
+					t.Fatalf("cannot drop schema: %s", err)
+				}
+			})
+
+			return NewHandlerBuilder("<projection>", projectiontest.IdentityKey, driver)
+		}
+
+		values := func(t *testing.T) map[string]string {
+			t.Helper()
+
+			rows, err := db.QueryContext(t.Context(), `SELECT id, value FROM declarative_data`)
+			if err != nil {
+				t.Fatalf("cannot query projection table: %s", err)
+			}
+			defer rows.Close()
+
+			values := map[string]string{}
+			for rows.Next() {
+				var id, value string
+				if err := rows.Scan(&id, &value); err != nil {
+					t.Fatal(err)
+				}
+				values[id] = value
+			}
+
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			return values
+		}
+
+		t.Run("it executes the statements for the event's type", func(t *testing.T) {
+			b := setup(t)
+
+			OnEvent(
+				b,
+				// The placeholder in the comment must not be rewritten.
+				`INSERT INTO declarative_data (id, value) /* ? */ VALUES (?, ?)`,
+				func(m *EventStub[TypeA]) []any {
+					return []any{"a", string(m.Content)}
+				},
+			)
+			OnEvent(
+				b,
+				`INSERT INTO declarative_data (id, value) VALUES ('b', 'constant')`,
+				(func(*EventStub[TypeA]) []any)(nil),
+			)
+			OnEvent(
+				b,
+				`INSERT INTO declarative_data (id, value) VALUES (?, ?)`,
+				func(m *EventStub[TypeB]) []any {
+					return []any{"c", string(m.Content)}
+				},
+			)
+
+			adaptor := New(db, driver, b.Build())
+
+			if _, err := adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{},
+				EventA1,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			got := values(t)
+			if len(got) != 2 || got["a"] != "A1" || got["b"] != "constant" {
+				t.Fatalf("unexpected projection data: %v", got)
+			}
+		})
+
+		t.Run("it routes the event types that have statements", func(t *testing.T) {
+			b := setup(t)
+
+			OnEvent(
+				b,
+				`DELETE FROM declarative_data`,
+				(func(*EventStub[TypeA]) []any)(nil),
+			)
+
+			cfg := runtimeconfig.FromProjection(New(db, driver, b.Build()))
+
+			if !cfg.RouteSet().HasMessageType(message.TypeFor[*EventStub[TypeA]]()) {
+				t.Fatal("expected the handler to route events of type A")
+			}
+
+			if cfg.RouteSet().HasMessageType(message.TypeFor[*EventStub[TypeB]]()) {
+				t.Fatal("did not expect the handler to route events of type B")
+			}
+		})
+
+		t.Run("it executes the reset statements when the projection is reset", func(t *testing.T) {
+			b := setup(t)
+
+			OnEvent(
+				b,
+				`INSERT INTO declarative_data (id, value) VALUES (?, ?)`,
+				func(m *EventStub[TypeA]) []any {
+					return []any{"a", string(m.Content)}
+				},
+			)
+			b.OnReset(`DELETE FROM declarative_data WHERE value <> '?'`)
+
+			adaptor := New(db, driver, b.Build())
+
+			if _, err := adaptor.HandleEvent(
+				t.Context(),
+				&ProjectionEventScopeStub{},
+				EventA1,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := adaptor.Reset(
+				t.Context(),
+				&ProjectionResetScopeStub{},
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := values(t); len(got) != 0 {
+				t.Fatalf("unexpected projection data: %v", got)
+			}
+		})
+
+		t.Run("it does not support reset if there are no reset statements", func(t *testing.T) {
+			b := setup(t)
+
+			adaptor := New(db, driver, b.Build())
+
+			if err := adaptor.Reset(
+				t.Context(),
+				&ProjectionResetScopeStub{},
+			); err != dogma.ErrNotSupported {
+				t.Fatalf("unexpected error: got %v, want %v", err, dogma.ErrNotSupported)
+			}
+		})
+	})
+
+	t.Run("func Dialect()", func(t *testing.T) {
+		dialect := driver.Dialect()
+		table := dialect.QuoteIdentifier("dialect data")
+
+		setup := func(t *testing.T) {
+			t.Helper()
+
+			if _, err := db.ExecContext(
+				t.Context(),
+				`CREATE TABLE `+table+` (
+					id    `+dialect.UUIDColumnType()+` NOT NULL PRIMARY KEY,
+					value VARCHAR(100) NOT NULL DEFAULT ''
+				)`,
+			); err != nil {
+				t.Fatalf("cannot create table: %s", err)
+			}
+
+			t.Cleanup(func() {
+				if _, err := db.ExecContext(
+					context.Background(),
+					`DROP TABLE `+table,
+				); err != nil {
+					t.Fatalf("cannot drop table: %s", err)
+				}
+			})
+		}
+
+		encode := func(t *testing.T, id string) any {
+			t.Helper()
+
+			v, err := dialect.EncodeUUID(id)
+			if err != nil {
+				t.Fatalf("cannot encode UUID: %s", err)
+			}
+
+			return v
+		}
+
+		query := func(t *testing.T, id string) (string, bool) {
+			t.Helper()
+
+			var value string
+			err := db.QueryRowContext(
+				t.Context(),
+				dialect.Rebind(`SELECT value FROM `+table+` WHERE id = ? AND value <> '?'`),
+				encode(t, id),
+			).Scan(&value)
+
+			if err == sql.ErrNoRows {
+				return "", false
+			}
+
+			if err != nil {
+				t.Fatalf("cannot query value: %s", err)
+			}
+
+			return value, true
+		}
+
+		id := "b86d2f2e-8c4c-4e4b-9f0e-9a5cc0ec7b3f"
+
+		t.Run("func Upsert()", func(t *testing.T) {
+			t.Run("it inserts a new row or updates the existing row", func(t *testing.T) {
+				setup(t)
+
+				upsert := dialect.Upsert(table, []string{"id"}, "value")
+
+				for _, want := range []string{"<first>", "<second>"} {
+					if _, err := db.ExecContext(
+						t.Context(),
+						upsert,
+						encode(t, id),
+						want,
+					); err != nil {
+						t.Fatalf("cannot upsert row: %s", err)
+					}
+
+					got, ok := query(t, id)
+					if !ok {
+						t.Fatal("expected row to exist")
+					}
+
+					if got != want {
+						t.Fatalf("unexpected value: got %q, want %q", got, want)
+					}
+				}
+			})
+
+			t.Run("it ignores conflicts when there are no non-key columns", func(t *testing.T) {
+				setup(t)
+
+				if _, err := db.ExecContext(
+					t.Context(),
+					dialect.Rebind(`INSERT INTO `+table+` (id, value) VALUES (?, '<value>')`),
+					encode(t, id),
+				); err != nil {
+					t.Fatalf("cannot insert row: %s", err)
+				}
+
+				if _, err := db.ExecContext(
+					t.Context(),
+					dialect.Upsert(table, []string{"id"}),
+					encode(t, id),
+				); err != nil {
+					t.Fatalf("cannot upsert row: %s", err)
+				}
+
+				if got, _ := query(t, id); got != "<value>" {
+					t.Fatalf("unexpected value: got %q, want %q", got, "<value>")
+				}
+			})
+		})
+
+		t.Run("func DecodeUUID()", func(t *testing.T) {
+			t.Run("it returns the UUID encoded by EncodeUUID()", func(t *testing.T) {
+				setup(t)
+
+				if _, err := db.ExecContext(
+					t.Context(),
+					dialect.Upsert(table, []string{"id"}, "value"),
+					encode(t, id),
+					"<value>",
+				); err != nil {
+					t.Fatalf("cannot insert row: %s", err)
+				}
+
+				var data []byte
+				if err := db.QueryRowContext(
+					t.Context(),
+					`SELECT id FROM `+table,
+				).Scan(&data); err != nil {
+					t.Fatalf("cannot query UUID: %s", err)
+				}
+
+				got, err := dialect.DecodeUUID(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got != id {
+					t.Fatalf("unexpected UUID: got %q, want %q", got, id)
+				}
+			})
+		})
+
+		t.Run("func EncodeUUID()", func(t *testing.T) {
+			t.Run("it returns an error if the UUID is invalid", func(t *testing.T) {
+				if _, err := dialect.EncodeUUID("<invalid>"); err == nil {
+					t.Fatal("expected an error")
+				}
+			})
+		})
+	})
+
+	t.Run("func Compact()", func(t *testing.T) {
+		t.Run("it forwards to the handler", func(t *testing.T) {
+			deps := setup(t)
+			want := errors.New("<error>")
+
+			deps.Handler.CompactFunc = func(
+				_ context.Context,
+				d *sql.DB,
+				_ dogma.ProjectionCompactScope,
+			) error {
+				if d != db {
+					t.Fatal("received unexpected db instance")
+				}
+				return want
+			}
+
+			got := deps.Adaptor.Compact(
+				t.Context(),
+				&ProjectionCompactScopeStub{},
+			)
+
+			if got != want {
+				t.Fatalf("unexpected error: got %v, want %v", got, want)
+			}
+		})
+	})
+
+	t.Run("with batching", func(t *testing.T) {
+		conformance(t, WithBatching(3, 10*time.Millisecond))
+
+		type result struct {
+			Offset uint64
+			Err    error
+		}
+
+		// handleAsync calls HandleEvent() in the background for an event at
+		// the given offset, and returns once the event has been added to a
+		// batch.
+		handleAsync := func(
+			t *testing.T,
+			a dogma.ProjectionMessageHandler,
+			offset uint64,
+			m dogma.Event,
+		) <-chan result {
+			t.Helper()
+
+			// RecordedAt() is called while the event is being added to the
+			// batch, so we wait for it before returning.
+			added := make(chan struct{})
+			var once sync.Once
+
+			done := make(chan result, 1)
+
+			go func() {
+				cp, err := a.HandleEvent(
+					t.Context(),
+					&ProjectionEventScopeStub{
+						OffsetFunc:           func() uint64 { return offset },
+						CheckpointOffsetFunc: func() uint64 { return offset },
+						RecordedAtFunc: func() time.Time {
+							once.Do(func() { close(added) })
+							return time.Now()
+						},
+					},
+					m,
+				)
+				done <- result{cp, err}
+			}()
+
+			<-added
+
+			return done
+		}
+
+		// pipeline calls HandleEvent() concurrently for each of the given
+		// events, as an engine that does not wait for each event to be handled
+		// before delivering the next. The events are added to batches in
+		// order, at consecutive offsets starting at zero.
+		//
+		// release is closed once all of the events have been added.
+		pipeline := func(
+			t *testing.T,
+			a dogma.ProjectionMessageHandler,
+			release chan struct{},
+			events ...dogma.Event,
+		) []result {
+			t.Helper()
+
+			var pending []<-chan result
+			for i, m := range events {
+				pending = append(pending, handleAsync(t, a, uint64(i), m))
+			}
+
+			if release != nil {
+				close(release)
+			}
+
+			var results []result
+			for _, done := range pending {
+				results = append(results, <-done)
+			}
+
+			return results
+		}
+
+		// recordTransactions configures the handler to record the transaction
+		// used to apply each event. The event at offset zero is not applied
+		// until release is closed, such that the events that follow it are
+		// added to batches while its batch is being committed.
+		recordTransactions := func(
+			h *fixtures.MessageHandler,
+			release chan struct{},
+		) *[]*sql.Tx {
+			var transactions []*sql.Tx
+
+			h.HandleEventFunc = func(
+				_ context.Context,
+				tx *sql.Tx,
+				s dogma.ProjectionEventScope,
+				_ dogma.Event,
+			) error {
+				if s.Offset() == 0 {
+					<-release
+				}
+				transactions = append(transactions, tx)
+				return nil
+			}
+
+			return &transactions
+		}
+
+		checkResults := func(t *testing.T, results []result) {
+			t.Helper()
+
+			for i, r := range results {
+				if r.Err != nil {
+					t.Fatal(r.Err)
+				}
+
+				if want := uint64(i + 1); r.Offset != want {
+					t.Fatalf("unexpected checkpoint offset: got %d, want %d", r.Offset, want)
+				}
+			}
+		}
+
+		committedOffset := func(t *testing.T) uint64 {
+			t.Helper()
+
+			cp, err := driver.QueryCheckpointOffset(
+				t.Context(),
+				db,
+				uuidpb.MustParseAsBytes(projectiontest.IdentityKey),
+				uuidpb.MustParseAsBytes((&ProjectionEventScopeStub{}).StreamID()),
+			)
+			if err != nil {
+				t.Fatalf("unable to query checkpoint offset: %s", err)
+			}
+
+			return cp
+		}
+
+		t.Run("it commits the batch immediately if no other batch is being committed", func(t *testing.T) {
+			deps := setup(t, WithBatching(100, time.Hour))
+
+			for offset := range uint64(3) {
+				cp, err := deps.Adaptor.HandleEvent(
+					t.Context(),
+					&ProjectionEventScopeStub{
+						OffsetFunc:           func() uint64 { return offset },
+						CheckpointOffsetFunc: func() uint64 { return offset },
+					},
+					EventA1,
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if want := offset + 1; cp != want {
+					t.Fatalf("unexpected checkpoint offset: got %d, want %d", cp, want)
+				}
+
+				if got := committedOffset(t); got != offset+1 {
+					t.Fatalf("unexpected committed checkpoint offset: got %d, want %d", got, offset+1)
+				}
+			}
+		})
+
+		t.Run("it adds events to a single batch while the previous batch is being committed", func(t *testing.T) {
+			deps := setup(t, WithBatching(100, time.Hour))
+			release := make(chan struct{})
+			transactions := recordTransactions(deps.Handler, release)
+
+			checkResults(t, pipeline(t, deps.Adaptor, release, EventA1, EventA1, EventA1, EventA1))
+
+			if got := committedOffset(t); got != 4 {
+				t.Fatalf("unexpected committed checkpoint offset: got %d, want 4", got)
+			}
+
+			txs := *transactions
+			if txs[0] == txs[1] {
+				t.Fatal("expected the first event to use its own transaction")
+			}
+
+			if txs[1] != txs[2] || txs[2] != txs[3] {
+				t.Fatal("expected the subsequent events to share a transaction")
+			}
+		})
+
+		t.Run("it commits the batch when it reaches the maximum size", func(t *testing.T) {
+			deps := setup(t, WithBatching(2, time.Hour))
+			release := make(chan struct{})
+			transactions := recordTransactions(deps.Handler, release)
+
+			checkResults(t, pipeline(t, deps.Adaptor, release, EventA1, EventA1, EventA1, EventA1, EventA1))
+
+			if got := committedOffset(t); got != 5 {
+				t.Fatalf("unexpected committed checkpoint offset: got %d, want 5", got)
+			}
+
+			txs := *transactions
+			if txs[1] != txs[2] || txs[3] != txs[4] || txs[2] == txs[3] {
+				t.Fatal("expected the subsequent events to be split into batches of the maximum size")
+			}
+		})
+
+		t.Run("it commits the batch when the maximum latency elapses", func(t *testing.T) {
+			deps := setup(t, WithBatching(100, 10*time.Millisecond))
+			release := make(chan struct{})
+			transactions := recordTransactions(deps.Handler, release)
+
+			pending := []<-chan result{
+				handleAsync(t, deps.Adaptor, 0, EventA1),
+				handleAsync(t, deps.Adaptor, 1, EventA1),
+			}
+
+			// Wait for the batch that contains the second event to be closed.
+			time.Sleep(50 * time.Millisecond)
+
+			pending = append(pending, handleAsync(t, deps.Adaptor, 2, EventA1))
+			close(release)
+
+			var results []result
+			for _, done := range pending {
+				results = append(results, <-done)
+			}
+
+			checkResults(t, results)
+
+			if txs := *transactions; txs[1] == txs[2] {
+				t.Fatal("expected events added after the maximum latency to use a separate transaction")
+			}
+		})
+
+		t.Run("it does not report the event as handled until the batch is committed", func(t *testing.T) {
+			deps := setup(t, WithBatching(100, time.Hour))
+			release := make(chan struct{})
+			recordTransactions(deps.Handler, release)
+
+			done := handleAsync(t, deps.Adaptor, 0, EventA1)
+
+			select {
+			case r := <-done:
+				t.Fatalf("unexpected result before the batch was committed: %+v", r)
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			if got := committedOffset(t); got != 0 {
+				t.Fatalf("unexpected committed checkpoint offset: got %d, want 0", got)
+			}
+
+			close(release)
+
+			r := <-done
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+
+			if r.Offset != 1 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 1", r.Offset)
+			}
+		})
+
+		t.Run("it commits the open batch when the checkpoint offset is queried", func(t *testing.T) {
+			deps := setup(t, WithBatching(100, time.Hour))
+			release := make(chan struct{})
+			recordTransactions(deps.Handler, release)
+
+			first := handleAsync(t, deps.Adaptor, 0, EventA1)
+			second := handleAsync(t, deps.Adaptor, 1, EventA1)
+			close(release)
+
+			cp, err := deps.Adaptor.CheckpointOffset(
+				t.Context(),
+				(&ProjectionEventScopeStub{}).StreamID(),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cp != 2 {
+				t.Fatalf("unexpected checkpoint offset: got %d, want 2", cp)
+			}
+
+			checkResults(t, []result{<-first, <-second})
+		})
+
+		t.Run("it applies the batch using the values of the first event's context", func(t *testing.T) {
+			deps := setup(t, WithBatching(100, time.Hour))
+
+			type key struct{}
+			ctx, cancel := context.WithCancel(context.WithValue(t.Context(), key{}, "<value>"))
+			defer cancel()
+
+			deps.Handler.HandleEventFunc = func(
+				ctx context.Context,
+				_ *sql.Tx,
+				_ dogma.ProjectionEventScope,
+				_ dogma.Event,
+			) error {
+				if got := ctx.Value(key{}); got != "<value>" {
+					t.Errorf("unexpected context value: got %v, want <value>", got)
+				}
+				return nil
+			}
+
+			if _, err := deps.Adaptor.HandleEvent(
+				ctx,
+				&ProjectionEventScopeStub{},
+				EventA1,
+			); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		t.Run("it rolls back the entire batch if the handler fails", func(t *testing.T) {
+			deps := setup(t, WithBatching(3, time.Hour))
+			release := make(chan struct{})
+			want := errors.New("<error>")
+
+			deps.Handler.HandleEventFunc = func(
+				_ context.Context,
+				_ *sql.Tx,
+				s dogma.ProjectionEventScope,
+				_ dogma.Event,
+			) error {
+				switch s.Offset() {
+				case 0:
+					<-release
+				case 2:
+					return want
+				}
+				return nil
+			}
+
+			results := pipeline(t, deps.Adaptor, release, EventA1, EventA1, EventA1, EventA1)
+
+			checkResults(t, results[:1])
+
+			for _, r := range results[1:] {
+				if r.Err != want {
+					t.Fatalf("unexpected error: got %v, want %v", r.Err, want)
+				}
+			}
+
+			if got := committedOffset(t); got != 1 {
+				t.Fatalf("unexpected committed checkpoint offset: got %d, want 1", got)
+			}
+		})
+
+		t.Run("it retries the batch if the driver considers the error retryable", func(t *testing.T) {
+			deps := setup(t)
+			release := make(chan struct{})
+			retryable := errors.New("<retryable>")
+			attempts := 0
+
+			deps.Handler.HandleEventFunc = func(
+				_ context.Context,
+				_ *sql.Tx,
+				s dogma.ProjectionEventScope,
+				_ dogma.Event,
+			) error {
+				switch s.Offset() {
+				case 0:
+					<-release
+				case 1:
+					attempts++
+					if attempts < 3 {
+						return retryable
+					}
+				}
+				return nil
+			}
+
+			adaptor := New(
+				db,
+				retryableErrorDriver{driver, retryable},
+				deps.Handler,
+				WithBatching(2, time.Hour),
+				WithRetry(5, 0, time.Millisecond),
+			)
+
+			checkResults(t, pipeline(t, adaptor, release, EventA1, EventA1, EventA1))
+
+			if attempts != 3 {
+				t.Fatalf("unexpected number of attempts: got %d, want 3", attempts)
+			}
+
+			if got := committedOffset(t); got != 3 {
+				t.Fatalf("unexpected committed checkpoint offset: got %d, want 3", got)
+			}
+		})
+
+		t.Run("it commits the batch when the transaction options change", func(t *testing.T) {
+			deps := setup(
+				t,
+				WithBatching(3, time.Hour),
+				WithEventTxOptions(func(m dogma.Event) *sql.TxOptions {
+					if m == EventB1 {
+						return &sql.TxOptions{Isolation: sql.LevelSerializable}
+					}
+					return nil
+				}),
+			)
+			release := make(chan struct{})
+			transactions := recordTransactions(deps.Handler, release)
+
+			checkResults(t, pipeline(t, deps.Adaptor, release, EventA1, EventA1, EventB1, EventB1))
+
+			txs := *transactions
+			if txs[2] != txs[3] {
+				t.Fatal("expected events with the same options to share a transaction")
+			}
+
+			if txs[1] == txs[2] {
+				t.Fatal("expected events with different options to use separate transactions")
+			}
+		})
+	})
+
+	t.Run("groups", func(t *testing.T) {
+		type member struct {
+			Key     string
+			Handler *fixtures.MessageHandler
+		}
+
+		newMember := func(routes ...dogma.ProjectionRoute) member {
+			key := uuidpb.Generate().AsString()
+
+			return member{
+				Key: key,
+				Handler: &fixtures.MessageHandler{
+					ConfigureFunc: func(c dogma.ProjectionConfigurer) {
+						c.Identity("<member-"+key+">", key)
+						c.Routes(routes...)
+					},
+				},
+			}
+		}
+
+		setup := func(t *testing.T, members ...member) dogma.ProjectionMessageHandler {
+			t.Helper()
+
+			if err := driver.CreateSchema(t.Context(), db); err != nil {
+				t.Fatalf("cannot create schema: %s", err)
+			}
+
+			t.Cleanup(func() {
+				if err := driver.DropSchema(context.Background(), db); err != nil {
+					t.Fatalf("cannot drop schema: %s", err)
+				}
+			})
+
+			var handlers []MessageHandler
+			for _, m := range members {
+				handlers = append(handlers, m.Handler)
+			}
+
+			return NewGroup(db, driver, "<group>", projectiontest.IdentityKey, handlers)
+		}
+
+		memberOffset := func(t *testing.T, m member, streamID string) uint64 {
+			t.Helper()
+
+			n, err := driver.QueryCheckpointOffset(
+				t.Context(),
+				db,
+				uuidpb.MustParseAsBytes(m.Key),
+				uuidpb.MustParseAsBytes(streamID),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return n
+		}
+
+		projectiontest.Run(
+			t,
+			func(t *testing.T, h *projectiontest.Hooks) dogma.ProjectionMessageHandler {
+				members := []member{
+					newMember(dogma.HandlesEvent[*EventStub[TypeA]]()),
+					newMember(dogma.HandlesEvent[*EventStub[TypeA]]()),
+				}
+
+				for _, m := range members {
+					m.Handler.HandleEventFunc = func(
+						_ context.Context,
+						_ *sql.Tx,
+						s dogma.ProjectionEventScope,
+						e dogma.Event,
+					) error {
+						return h.HandleEvent(s, e)
+					}
+
+					m.Handler.ResetFunc = func(
+						_ context.Context,
+						_ *sql.Tx,
+						s dogma.ProjectionResetScope,
+					) error {
+						return h.Reset(s)
+					}
+				}
+
+				return setup(t, members...)
+			},
+		)
+
+		t.Run("func Configure()", func(t *testing.T) {
+			t.Run("it routes the events consumed by any member", func(t *testing.T) {
+				group := NewGroup(
+					db,
+					driver,
+					"<group>",
+					projectiontest.IdentityKey,
+					[]MessageHandler{
+						newMember(dogma.HandlesEvent[*EventStub[TypeA]]()).Handler,
+						newMember(
+							dogma.HandlesEvent[*EventStub[TypeA]](),
+							dogma.HandlesEvent[*EventStub[TypeB]](),
+						).Handler,
+					},
+				)
+
+				cfg := runtimeconfig.FromProjection(group)
+
+				if cfg.Identity().GetKey().AsString() != projectiontest.IdentityKey {
+					t.Fatalf("unexpected identity key: got %s, want %s", cfg.Identity().GetKey(), projectiontest.IdentityKey)
+				}
+
+				for _, mt := range []message.Type{
+					message.TypeFor[*EventStub[TypeA]](),
+					message.TypeFor[*EventStub[TypeB]](),
+				} {
+					if !cfg.RouteSet().HasMessageType(mt) {
+						t.Fatalf("expected %s to be routed", mt)
+					}
+				}
+			})
+
+			t.Run("it excludes members that are disabled", func(t *testing.T) {
+				a := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+				b := newMember(dogma.HandlesEvent[*EventStub[TypeB]]())
+
+				configure := b.Handler.ConfigureFunc
+				b.Handler.ConfigureFunc = func(c dogma.ProjectionConfigurer) {
+					configure(c)
+					c.Disable()
+				}
+
+				b.Handler.HandleEventFunc = func(
+					context.Context,
+					*sql.Tx,
+					dogma.ProjectionEventScope,
+					dogma.Event,
+				) error {
+					t.Error("unexpected call to disabled member")
+					return nil
+				}
+
+				group := setup(t, a, b)
+				cfg := runtimeconfig.FromProjection(group)
+
+				if cfg.IsDisabled() {
+					t.Fatal("expected the group to be enabled")
+				}
+
+				if cfg.RouteSet().HasMessageType(message.TypeFor[*EventStub[TypeB]]()) {
+					t.Fatal("expected the disabled member's routes to be excluded")
+				}
+
+				scope := &ProjectionEventScopeStub{}
+				if _, err := group.HandleEvent(t.Context(), scope, EventA1); err != nil {
+					t.Fatal(err)
+				}
+
+				if got := memberOffset(t, b, scope.StreamID()); got != 0 {
+					t.Fatalf("unexpected checkpoint offset for disabled member: got %d, want 0", got)
+				}
+			})
+
+			t.Run("it disables the group if every member is disabled", func(t *testing.T) {
+				m := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+
+				configure := m.Handler.ConfigureFunc
+				m.Handler.ConfigureFunc = func(c dogma.ProjectionConfigurer) {
+					configure(c)
+					c.Disable()
+				}
+
+				group := NewGroup(
+					db,
+					driver,
+					"<group>",
+					projectiontest.IdentityKey,
+					[]MessageHandler{m.Handler},
+				)
+
+				if !runtimeconfig.FromProjection(group).IsDisabled() {
+					t.Fatal("expected the group to be disabled")
+				}
+			})
+		})
+
+		t.Run("func HandleEvent()", func(t *testing.T) {
+			t.Run("it applies the event to every member within the same transaction", func(t *testing.T) {
+				a := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+				b := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+				group := setup(t, a, b)
+
+				var txs []*sql.Tx
+				for _, m := range []member{a, b} {
+					m.Handler.HandleEventFunc = func(
+						_ context.Context,
+						tx *sql.Tx,
+						_ dogma.ProjectionEventScope,
+						_ dogma.Event,
+					) error {
+						txs = append(txs, tx)
+						return nil
+					}
+				}
+
+				scope := &ProjectionEventScopeStub{}
+
+				cp, err := group.HandleEvent(t.Context(), scope, EventA1)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if cp != 1 {
+					t.Fatalf("unexpected checkpoint offset: got %d, want 1", cp)
+				}
+
+				if len(txs) != 2 || txs[0] != txs[1] {
+					t.Fatalf("expected both members to use the same transaction, got %v", txs)
+				}
+
+				for _, m := range []member{a, b} {
+					if n := memberOffset(t, m, scope.StreamID()); n != 1 {
+						t.Fatalf("unexpected checkpoint offset of member: got %d, want 1", n)
+					}
+				}
+			})
+
+			t.Run("it only forwards events to members that consume them", func(t *testing.T) {
+				a := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+				b := newMember(dogma.HandlesEvent[*EventStub[TypeB]]())
+				group := setup(t, a, b)
+
+				b.Handler.HandleEventFunc = func(
+					context.Context,
+					*sql.Tx,
+					dogma.ProjectionEventScope,
+					dogma.Event,
+				) error {
+					t.Fatal("unexpected call")
+					return nil
+				}
+
+				scope := &ProjectionEventScopeStub{}
+
+				if _, err := group.HandleEvent(t.Context(), scope, EventA1); err != nil {
+					t.Fatal(err)
+				}
+
+				if n := memberOffset(t, b, scope.StreamID()); n != 1 {
+					t.Fatalf("unexpected checkpoint offset of non-consuming member: got %d, want 1", n)
+				}
+			})
+
+			t.Run("it does not modify any member if one of them fails", func(t *testing.T) {
+				a := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+				b := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+				group := setup(t, a, b)
+
+				want := errors.New("<error>")
+				b.Handler.HandleEventFunc = func(
+					context.Context,
+					*sql.Tx,
+					dogma.ProjectionEventScope,
+					dogma.Event,
+				) error {
+					return want
+				}
+
+				scope := &ProjectionEventScopeStub{}
+
+				if _, err := group.HandleEvent(t.Context(), scope, EventA1); err != want {
+					t.Fatalf("unexpected error: got %v, want %v", err, want)
+				}
+
+				if n := memberOffset(t, a, scope.StreamID()); n != 0 {
+					t.Fatalf("unexpected checkpoint offset of member: got %d, want 0", n)
+				}
+			})
+
+			t.Run("it catches up members that are behind", func(t *testing.T) {
+				a := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+				b := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+
+				// Apply the first two events to a alone, as though b has since
+				// been added to the group.
+				setup(t, a)
+				existing := New(db, driver, a.Handler)
+
+				for offset := range uint64(2) {
+					if _, err := existing.HandleEvent(
+						t.Context(),
+						&ProjectionEventScopeStub{
+							OffsetFunc:           func() uint64 { return offset },
+							CheckpointOffsetFunc: func() uint64 { return offset },
+						},
+						EventA1,
+					); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				group := NewGroup(db, driver, "<group>", projectiontest.IdentityKey, []MessageHandler{a.Handler, b.Handler})
+
+				var applied []string
+				for _, m := range []member{a, b} {
+					m.Handler.HandleEventFunc = func(
+						context.Context,
+						*sql.Tx,
+						dogma.ProjectionEventScope,
+						dogma.Event,
+					) error {
+						applied = append(applied, m.Key)
+						return nil
+					}
+				}
+
+				streamID := (&ProjectionEventScopeStub{}).StreamID()
+
+				cp, err := group.CheckpointOffset(t.Context(), streamID)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for cp < 3 {
+					offset := cp
+
+					next, err := group.HandleEvent(
+						t.Context(),
+						&ProjectionEventScopeStub{
+							OffsetFunc:           func() uint64 { return offset },
+							CheckpointOffsetFunc: func() uint64 { return offset },
+						},
+						EventA1,
+					)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if next != offset+1 {
+						t.Fatalf("unexpected checkpoint offset: got %d, want %d", next, offset+1)
+					}
+
+					cp = next
+				}
+
+				want := []string{b.Key, b.Key, a.Key, b.Key}
+				if !slices.Equal(applied, want) {
+					t.Fatalf("unexpected members applied: got %v, want %v", applied, want)
+				}
+
+				for _, m := range []member{a, b} {
+					if n := memberOffset(t, m, streamID); n != 3 {
+						t.Fatalf("unexpected checkpoint offset of member: got %d, want 3", n)
+					}
+				}
+			})
+		})
+
+		t.Run("func Reset()", func(t *testing.T) {
+			t.Run("it does not truncate the tables of any member if another does not support reset", func(t *testing.T) {
+				a := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+				b := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+				setup(t, a, b)
+				table := createDataTable(t, db, driver)
+
+				owner := &fixtures.TableOwner{
+					MessageHandler: *a.Handler,
+					TablesFunc: func() []string {
+						return []string{table}
+					},
+				}
+
+				owner.HandleEventFunc = func(
+					ctx context.Context,
+					tx *sql.Tx,
+					_ dogma.ProjectionEventScope,
+					_ dogma.Event,
+				) error {
+					_, err := tx.ExecContext(ctx, `INSERT INTO `+table+` (id) VALUES (1)`)
+					return err
+				}
+
+				b.Handler.ResetFunc = func(
+					context.Context,
+					*sql.Tx,
+					dogma.ProjectionResetScope,
+				) error {
+					return dogma.ErrNotSupported
+				}
+
+				group := NewGroup(
+					db,
+					driver,
+					"<group>",
+					projectiontest.IdentityKey,
+					[]MessageHandler{owner, b.Handler},
+				)
+
+				if _, err := group.HandleEvent(
+					t.Context(),
+					&ProjectionEventScopeStub{},
+					EventA1,
+				); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := group.Reset(
+					t.Context(),
+					&ProjectionResetScopeStub{},
+				); err != dogma.ErrNotSupported {
+					t.Fatalf("unexpected error: got %v, want %v", err, dogma.ErrNotSupported)
+				}
+
+				if n := countRows(t, db, table); n != 1 {
+					t.Fatalf("unexpected number of rows: got %d, want 1", n)
+				}
+			})
+
+			t.Run("it does not reset any member if one does not support it", func(t *testing.T) {
+				a := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+				b := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+				group := setup(t, a, b)
+
+				b.Handler.ResetFunc = func(
+					context.Context,
+					*sql.Tx,
+					dogma.ProjectionResetScope,
+				) error {
+					return dogma.ErrNotSupported
+				}
+
+				scope := &ProjectionEventScopeStub{}
+
+				if _, err := group.HandleEvent(t.Context(), scope, EventA1); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := group.Reset(
+					t.Context(),
+					&ProjectionResetScopeStub{},
+				); err != dogma.ErrNotSupported {
+					t.Fatalf("unexpected error: got %v, want %v", err, dogma.ErrNotSupported)
+				}
+
+				if n := memberOffset(t, a, scope.StreamID()); n != 1 {
+					t.Fatalf("unexpected checkpoint offset of member: got %d, want 1", n)
+				}
+			})
+		})
+
+		t.Run("func Compact()", func(t *testing.T) {
+			t.Run("it compacts every member", func(t *testing.T) {
+				a := newMember()
+				b := newMember()
+				group := setup(t, a, b)
+
+				want := errors.New("<error>")
+				a.Handler.CompactFunc = func(
+					context.Context,
+					*sql.DB,
+					dogma.ProjectionCompactScope,
+				) error {
+					return want
+				}
+
+				called := false
+				b.Handler.CompactFunc = func(
+					context.Context,
+					*sql.DB,
+					dogma.ProjectionCompactScope,
+				) error {
+					called = true
+					return nil
+				}
+
+				if err := group.Compact(
+					t.Context(),
+					&ProjectionCompactScopeStub{},
+				); !errors.Is(err, want) {
+					t.Fatalf("unexpected error: got %v, want %v", err, want)
+				}
+
+				if !called {
+					t.Fatal("expected second member to be compacted")
+				}
+			})
+		})
+
+		t.Run("func ListCheckpoints()", func(t *testing.T) {
+			cases := []struct {
+				Desc   string
+				Driver Driver
+			}{
+				{"with a driver that queries the group's checkpoints directly", driver},
+				{"with a driver that only queries each member's checkpoints", memberOnlyDriver{driver}},
+			}
+
+			for _, c := range cases {
+				t.Run(c.Desc, func(t *testing.T) {
+					t.Run("it returns the lowest checkpoint of any member for each stream", func(t *testing.T) {
+						a := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+						b := newMember(dogma.HandlesEvent[*EventStub[TypeA]]())
+						setup(t, a, b)
+
+						group := NewGroup(
+							db,
+							c.Driver,
+							"<group>",
+							projectiontest.IdentityKey,
+							[]MessageHandler{a.Handler, b.Handler},
+						).(projectionkit.CheckpointLister)
+
+						streams := []string{
+							"1b0d6c2a-9f7e-4c5d-8b3a-2e1f0d9c8b7a",
+							"2a3b4c5d-6e7f-4a8b-9c0d-1e2f3a4b5c6d",
+							"3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e6f",
+						}
+
+						store := func(m member, streamID string, offset uint64) {
+							tx, err := db.BeginTx(t.Context(), nil)
+							if err != nil {
+								t.Fatal(err)
+							}
+							defer tx.Rollback() // nolint:errcheck
+
+							if err := driver.StoreCheckpointOffset(
+								t.Context(),
+								tx,
+								uuidpb.MustParseAsBytes(m.Key),
+								uuidpb.MustParseAsBytes(streamID),
+								offset,
+							); err != nil {
+								t.Fatal(err)
+							}
+
+							if err := tx.Commit(); err != nil {
+								t.Fatal(err)
+							}
+						}
+
+						store(a, streams[0], 5)
+						store(b, streams[0], 3)
+						store(a, streams[1], 2)
+						store(b, streams[1], 4)
+
+						// Only one member has a checkpoint for the third stream, so the
+						// group has not applied any of its events.
+						store(a, streams[2], 1)
+
+						var got []projectionkit.Checkpoint
+						after := ""
+						for {
+							page, err := group.ListCheckpoints(t.Context(), after, 1)
+							if err != nil {
+								t.Fatal(err)
+							}
+
+							got = append(got, page...)
+
+							if len(page) < 1 {
+								break
+							}
+							after = page[len(page)-1].StreamID
+						}
+
+						want := map[string]uint64{
+							streams[0]: 3,
+							streams[1]: 2,
+						}
+
+						if len(got) != len(want) {
+							t.Fatalf("unexpected number of checkpoints: got %d, want %d", len(got), len(want))
+						}
+
+						for _, cp := range got {
+							if cp.Offset != want[cp.StreamID] {
+								t.Fatalf("unexpected offset for stream %s: got %d, want %d", cp.StreamID, cp.Offset, want[cp.StreamID])
+							}
+						}
+
+						n, err := group.CountCheckpoints(t.Context())
+						if err != nil {
+							t.Fatal(err)
+						}
+
+						if n != 2 {
+							t.Fatalf("unexpected number of checkpoints: got %d, want 2", n)
+						}
+					})
+				})
+			}
+		})
+
+		t.Run("func NewGroup()", func(t *testing.T) {
+			t.Run("it panics if members have the same identity key", func(t *testing.T) {
+				defer func() {
+					if recover() == nil {
+						t.Fatal("expected a panic")
+					}
+				}()
+
+				m := newMember()
+				NewGroup(db, driver, "<group>", projectiontest.IdentityKey, []MessageHandler{m.Handler, m.Handler})
+			})
+
+			t.Run("it panics if batching is enabled", func(t *testing.T) {
+				defer func() {
+					if recover() == nil {
+						t.Fatal("expected a panic")
+					}
+				}()
+
+				NewGroup(
+					db,
+					driver,
+					"<group>",
+					projectiontest.IdentityKey,
+					[]MessageHandler{newMember().Handler},
+					WithBatching(10, time.Second),
+				)
+			})
+		})
+	})
+
+	t.Run("checkpoint management", func(t *testing.T) {
+		handlerKey := uuidpb.MustParseAsBytes(projectiontest.IdentityKey)
+		streamID := uuidpb.MustParseAsBytes((&ProjectionEventScopeStub{}).StreamID())
+
+		storeOffset := func(t *testing.T, h []byte, n uint64) {
+			t.Helper()
+
+			tx, err := db.BeginTx(t.Context(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			if err := driver.StoreCheckpointOffset(t.Context(), tx, h, streamID, n); err != nil {
+				t.Fatalf("unable to store checkpoint offset: %s", err)
+			}
+
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		t.Run("func ExportCheckpoints()", func(t *testing.T) {
+			t.Run("it exports the checkpoints of all handlers", func(t *testing.T) {
+				setup(t)
+
+				other := uuidpb.MustParseAsBytes("0a8b7c6d-5e4f-4a3b-9c2d-1e0f9a8b7c6d")
+				storeOffset(t, handlerKey, 1)
+				storeOffset(t, other, 2)
+
+				var buf bytes.Buffer
+				if err := ExportCheckpoints(t.Context(), db, driver, &buf); err != nil {
+					t.Fatal(err)
+				}
+
+				stream := uuidpb.FromByteArray([16]byte(streamID)).AsString()
+				want := `{"handler":"0a8b7c6d-5e4f-4a3b-9c2d-1e0f9a8b7c6d","stream":"` + stream + `","offset":2}` + "\n" +
+					`{"handler":"` + projectiontest.IdentityKey + `","stream":"` + stream + `","offset":1}` + "\n"
+
+				if got := buf.String(); got != want {
+					t.Fatalf("unexpected export:\ngot:\n%s\nwant:\n%s", got, want)
+				}
+			})
+		})
+
+		t.Run("func ImportCheckpoints()", func(t *testing.T) {
+			t.Run("it replaces the checkpoint offsets of the imported streams", func(t *testing.T) {
+				setup(t)
+
+				storeOffset(t, handlerKey, 5)
+
+				var buf bytes.Buffer
+				enc := projectionkit.NewCheckpointEncoder(&buf)
+
+				for _, id := range []string{
+					uuidpb.FromByteArray([16]byte(streamID)).AsString(),
+					"5c2e4a9b-7d1f-4e3a-8b6c-0d9f2e1a3b4c",
+				} {
+					if err := enc.Encode(projectionkit.ExportedCheckpoint{
+						HandlerKey: projectiontest.IdentityKey,
+						StreamID:   id,
+						Offset:     10,
+					}); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				if err := ImportCheckpoints(t.Context(), db, driver, &buf); err != nil {
+					t.Fatal(err)
+				}
+
+				n, err := driver.CountCheckpoints(t.Context(), db, handlerKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if n != 2 {
+					t.Fatalf("unexpected number of checkpoints: got %d, want 2", n)
+				}
+
+				cp, err := driver.QueryCheckpointOffset(t.Context(), db, handlerKey, streamID)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if cp != 10 {
+					t.Fatalf("unexpected checkpoint offset: got %d, want 10", cp)
+				}
+			})
+
+			t.Run("it deletes the checkpoints of streams with an offset of zero", func(t *testing.T) {
+				deps := setup(t)
+
+				if _, err := deps.Adaptor.HandleEvent(
+					t.Context(),
+					&ProjectionEventScopeStub{},
+					EventA1,
+				); err != nil {
+					t.Fatal(err)
+				}
+
+				var buf bytes.Buffer
+				if err := projectionkit.NewCheckpointEncoder(&buf).Encode(
+					projectionkit.ExportedCheckpoint{
+						HandlerKey: projectiontest.IdentityKey,
+						StreamID:   uuidpb.FromByteArray([16]byte(streamID)).AsString(),
+						Offset:     0,
+					},
+				); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := ImportCheckpoints(t.Context(), db, driver, &buf); err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := deps.Adaptor.HandleEvent(
+					t.Context(),
+					&ProjectionEventScopeStub{},
+					EventA1,
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got != 1 {
+					t.Fatalf("unexpected checkpoint offset: got %d, want 1", got)
+				}
+			})
+
+			t.Run("it does not import any checkpoints if the input is invalid", func(t *testing.T) {
+				setup(t)
+
+				input := `{"handler":"` + projectiontest.IdentityKey + `","stream":"5c2e4a9b-7d1f-4e3a-8b6c-0d9f2e1a3b4c","offset":1}` + "\n" +
+					`<invalid>` + "\n"
+
+				if err := ImportCheckpoints(
+					t.Context(),
+					db,
+					driver,
+					strings.NewReader(input),
+				); err == nil {
+					t.Fatal("expected an error")
+				}
+
+				n, err := driver.CountCheckpoints(t.Context(), db, handlerKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if n != 0 {
+					t.Fatalf("unexpected number of checkpoints: got %d, want 0", n)
+				}
+			})
+		})
+
+		t.Run("func QueryHandlers()", func(t *testing.T) {
+			t.Run("it returns the keys of handlers with checkpoints", func(t *testing.T) {
+				setup(t)
+
+				other := uuidpb.MustParseAsBytes("0a8b7c6d-5e4f-4a3b-9c2d-1e0f9a8b7c6d")
+				storeOffset(t, handlerKey, 1)
+				storeOffset(t, other, 1)
+
+				got, err := driver.QueryHandlers(t.Context(), db)
+				if err != nil {
+					t.Fatalf("unable to query handlers: %s", err)
+				}
+
+				want := [][]byte{other, handlerKey}
+				if len(got) != len(want) {
+					t.Fatalf("unexpected number of handlers: got %d, want %d", len(got), len(want))
+				}
+
+				for i := range want {
+					if !bytes.Equal(got[i], want[i]) {
+						t.Fatalf("unexpected handler at index %d: got %x, want %x", i, got[i], want[i])
+					}
+				}
+			})
+		})
+
+		t.Run("func StoreCheckpointOffset()", func(t *testing.T) {
+			t.Run("it replaces the existing checkpoint offset", func(t *testing.T) {
+				setup(t)
+
+				storeOffset(t, handlerKey, 10)
+				storeOffset(t, handlerKey, 5)
+
+				got, err := driver.QueryCheckpointOffset(t.Context(), db, handlerKey, streamID)
+				if err != nil {
+					t.Fatalf("unable to query checkpoint offset: %s", err)
+				}
+
+				if got != 5 {
+					t.Fatalf("unexpected checkpoint offset: got %d, want 5", got)
+				}
+			})
+
+			t.Run("it allows the stream to be handled from the beginning when the offset is zero", func(t *testing.T) {
+				deps := setup(t)
+
+				if _, err := deps.Adaptor.HandleEvent(
+					t.Context(),
+					&ProjectionEventScopeStub{},
+					EventA1,
+				); err != nil {
+					t.Fatal(err)
+				}
+
+				storeOffset(t, handlerKey, 0)
+
+				n, err := driver.CountCheckpoints(t.Context(), db, handlerKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if n != 0 {
+					t.Fatalf("unexpected number of checkpoints: got %d, want 0", n)
+				}
+
+				got, err := deps.Adaptor.HandleEvent(
+					t.Context(),
+					&ProjectionEventScopeStub{},
+					EventA1,
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got != 1 {
+					t.Fatalf("unexpected checkpoint offset: got %d, want 1", got)
+				}
+			})
+		})
+	})
+
+	t.Run("schema management", func(t *testing.T) {
+		t.Run("func CreateSchema()", func(t *testing.T) {
+			t.Run("it can be called when the schema already exists", func(t *testing.T) {
+				if err := driver.CreateSchema(t.Context(), db); err != nil {
+					t.Fatalf("unable to create schema the first time: %s", err)
+				}
+
+				if err := driver.CreateSchema(t.Context(), db); err != nil {
+					t.Fatalf("unable to create schema the second time: %s", err)
+				}
+			})
+		})
+
+		t.Run("func MigrateSchema()", func(t *testing.T) {
+			t.Run("it records the schema version", func(t *testing.T) {
+				if err := driver.MigrateSchema(t.Context(), db); err != nil {
+					t.Fatalf("unable to migrate schema: %s", err)
+				}
+				t.Cleanup(func() {
+					if err := driver.DropSchema(context.Background(), db); err != nil {
+						t.Fatalf("cannot drop schema: %s", err)
+					}
+				})
+
+				v, err := driver.SchemaVersion(t.Context(), db)
+				if err != nil {
+					t.Fatalf("unable to query schema version: %s", err)
+				}
+
+				if v == 0 {
+					t.Fatal("expected schema version to be non-zero")
+				}
+			})
+
+			t.Run("it does not change the version if the schema is already up-to-date", func(t *testing.T) {
+				if err := driver.MigrateSchema(t.Context(), db); err != nil {
+					t.Fatalf("unable to migrate schema the first time: %s", err)
+				}
+				t.Cleanup(func() {
+					if err := driver.DropSchema(context.Background(), db); err != nil {
+						t.Fatalf("cannot drop schema: %s", err)
+					}
+				})
+
+				want, err := driver.SchemaVersion(t.Context(), db)
+				if err != nil {
+					t.Fatalf("unable to query schema version: %s", err)
+				}
+
+				if err := driver.MigrateSchema(t.Context(), db); err != nil {
+					t.Fatalf("unable to migrate schema the second time: %s", err)
+				}
+
+				got, err := driver.SchemaVersion(t.Context(), db)
+				if err != nil {
+					t.Fatalf("unable to query schema version: %s", err)
+				}
+
+				if got != want {
+					t.Fatalf("unexpected schema version: got %d, want %d", got, want)
+				}
+			})
+
+			t.Run("it can be called concurrently", func(t *testing.T) {
+				t.Cleanup(func() {
+					if err := driver.DropSchema(context.Background(), db); err != nil {
+						t.Fatalf("cannot drop schema: %s", err)
+					}
+				})
+
+				var g sync.WaitGroup
+
+				for range 5 {
+					g.Go(func() {
+						if err := driver.MigrateSchema(t.Context(), db); err != nil {
+							t.Errorf("unable to migrate schema: %s", err)
+						}
+					})
+				}
+
+				g.Wait()
+			})
+		})
+
+		t.Run("func SchemaVersion()", func(t *testing.T) {
+			t.Run("it returns zero if the schema does not exist", func(t *testing.T) {
+				v, err := driver.SchemaVersion(t.Context(), db)
+				if err != nil {
+					t.Fatalf("unable to query schema version: %s", err)
+				}
+
+				if v != 0 {
+					t.Fatalf("unexpected schema version: got %d, want 0", v)
+				}
+			})
+
+			t.Run("it returns zero after the schema is dropped", func(t *testing.T) {
+				if err := driver.MigrateSchema(t.Context(), db); err != nil {
+					t.Fatalf("unable to migrate schema: %s", err)
+				}
+
+				if err := driver.DropSchema(t.Context(), db); err != nil {
+					t.Fatalf("unable to drop schema: %s", err)
+				}
+
+				v, err := driver.SchemaVersion(t.Context(), db)
+				if err != nil {
+					t.Fatalf("unable to query schema version: %s", err)
+				}
+
+				if v != 0 {
+					t.Fatalf("unexpected schema version: got %d, want 0", v)
+				}
+			})
+		})
+
+		t.Run("func DropSchema()", func(t *testing.T) {
+			t.Run("it can be called when the schema does not exist", func(t *testing.T) {
+				if err := driver.DropSchema(t.Context(), db); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			t.Run("it can be called when the schema has already been dropped", func(t *testing.T) {
+				if err := driver.CreateSchema(t.Context(), db); err != nil {
+					t.Fatalf("unable to create schema: %s", err)
+				}
+
+				if err := driver.DropSchema(t.Context(), db); err != nil {
+					t.Fatalf("unable to drop schema the first time: %s", err)
+				}
+
+				if err := driver.DropSchema(t.Context(), db); err != nil {
+					t.Fatalf("unable to drop schema the second time: %s", err)
+				}
+			})
+		})
+	})
+}
+
+// retryableErrorDriver is a [Driver] that considers a specific error to be
+// retryable, in addition to those recognized by the underlying driver.
+type retryableErrorDriver struct {
+	Driver
+	Err error
+}
+
+func (d retryableErrorDriver) IsRetryableError(err error) bool {
+	return err == d.Err || d.Driver.IsRetryableError(err)
+}
+
+// memberOnlyDriver is a [Driver] that hides the optional methods that query the
+// checkpoints of a group of handlers.
+type memberOnlyDriver struct {
+	Driver
+}
+
+// alwaysRetryableDriver is a [Driver] that considers every error to be
+// retryable.
+type alwaysRetryableDriver struct {
+	Driver
+}
+
+func (d alwaysRetryableDriver) IsRetryableError(error) bool {
+	return true
+}
+
+// createDataTable creates a table for use as projection data, and returns its
+// quoted name. The table is dropped when the test ends.
+func createDataTable(t *testing.T, db *sql.DB, driver Driver) string {
+	t.Helper()
+
+	table := driver.Dialect().QuoteIdentifier("projection_data")
+
+	if _, err := db.ExecContext(
+		t.Context(),
+		`CREATE TABLE `+table+` (id INTEGER NOT NULL)`,
+	); err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+
+	t.Cleanup(func() {
+		if _, err := db.ExecContext(
+			context.Background(),
+			`DROP TABLE `+table,
+		); err != nil {
+			t.Fatalf("cannot drop table: %s", err)
+		}
+	})
+
+	return table
+}
+
+// countRows returns the number of rows in the given table.
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRowContext(
+		t.Context(),
+		`SELECT COUNT(*) FROM `+table,
+	).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
 }
@@ -0,0 +1,315 @@
+package sqlprojection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/dogmatiq/dogma"
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+)
+
+// WithBatching is an [Option] that applies consecutive events from the same
+// stream within a single transaction.
+//
+// Each call to HandleEvent adds its event to the batch for the event's stream,
+// then waits until the batch has been committed. If no other batch for the
+// stream is being committed, the batch is committed immediately. Otherwise, it
+// remains open, such that events delivered while the previous batch is being
+// committed are applied together, and it's committed once the previous batch
+// is done, once it contains maxSize events, or once maxLatency has elapsed
+// since the first event was added, whichever comes first. An event is never
+// reported to the engine as handled before the batch that contains it has been
+// committed.
+//
+// If the engine waits for each call to HandleEvent to return before delivering
+// the next event from the same stream, each batch contains a single event and
+// is committed without delay.
+//
+// The events are applied when the batch is committed, within a transaction that
+// is retried as per [WithRetry]. If the handler fails to apply any of the
+// events, the entire batch is rolled back and each call to HandleEvent for an
+// event in the batch returns the error.
+func WithBatching(maxSize int, maxLatency time.Duration) Option {
+	if maxSize <= 0 {
+		panic("maximum batch size must be positive")
+	}
+
+	if maxLatency <= 0 {
+		panic("maximum batch latency must be positive")
+	}
+
+	return func(a *adaptor) {
+		a.MaxBatchSize = maxSize
+		a.MaxBatchLatency = maxLatency
+	}
+}
+
+// batch is a set of consecutive events from a single stream that are applied
+// within the same transaction.
+//
+// The fields that describe the batch's events may only be modified while the
+// batch is open, and while the adaptor's batchesM mutex is held.
+type batch struct {
+	// ctx is the context used to commit the batch. It carries the values of
+	// the context of the call to HandleEvent for the first event in the batch,
+	// but it's never canceled, as the batch is shared by several calls.
+	ctx context.Context
+
+	streamID  [16]byte
+	txOptions *sql.TxOptions
+	events    []batchedEvent
+
+	// first is the checkpoint offset expected by the engine before the first
+	// event in the batch, and next is the checkpoint offset after the last
+	// event in the batch.
+	first, next uint64
+
+	// recordedAt is the time at which the last event in the batch was
+	// recorded.
+	recordedAt time.Time
+
+	// open is true while events may be added to the batch.
+	open  bool
+	timer *time.Timer
+
+	// prev is the batch for the same stream that was closed before this batch
+	// was opened, if any. This batch is not committed until prev is done. It's
+	// cleared, while batchesM is held, once prev is done.
+	prev *batch
+
+	// done is closed once the batch has been committed or rolled back, after
+	// which ok and err describe the outcome. ok is false if the checkpoint
+	// offset expected by the engine was stale.
+	done chan struct{}
+	ok   bool
+	err  error
+}
+
+// batchedEvent is an event that has been added to a batch.
+type batchedEvent struct {
+	Scope dogma.ProjectionEventScope
+	Event dogma.Event
+}
+
+// handleEventInBatch handles an event by adding it to the batch for its stream,
+// then waiting for the batch to be committed.
+func (a *adaptor) handleEventInBatch(
+	ctx context.Context,
+	s dogma.ProjectionEventScope,
+	m dogma.Event,
+) (uint64, error) {
+	b := a.addToBatch(ctx, s, m)
+
+	if err := waitForBatch(ctx, b); err != nil {
+		return 0, err
+	}
+
+	if b.ok {
+		return s.Offset() + 1, nil
+	}
+
+	return a.Driver.QueryCheckpointOffset(
+		ctx,
+		a.DB,
+		a.handlerKey[:],
+		b.streamID[:],
+	)
+}
+
+// addToBatch adds an event to the open batch for its stream, opening a new
+// batch if necessary, and returns the batch.
+func (a *adaptor) addToBatch(
+	ctx context.Context,
+	s dogma.ProjectionEventScope,
+	m dogma.Event,
+) *batch {
+	id := uuidpb.MustParseAsByteArray(s.StreamID())
+	opts := a.txOptions(m)
+
+	a.batchesM.Lock()
+	defer a.batchesM.Unlock()
+
+	b := a.batches[id]
+
+	if b != nil && b.open && (s.CheckpointOffset() != b.next || !sameTxOptions(b.txOptions, opts)) {
+		// The engine's checkpoint offset does not follow on from the last event
+		// in the batch, or the event requires different transaction options.
+		// We commit the existing batch then start a new one, which verifies the
+		// engine's checkpoint offset.
+		a.closeBatch(b)
+	}
+
+	if b == nil || !b.open {
+		b = &batch{
+			// The batch is shared by several calls to HandleEvent, so the
+			// commit must not be canceled when any one of them is.
+			ctx:       context.WithoutCancel(ctx),
+			streamID:  id,
+			txOptions: opts,
+			first:     s.CheckpointOffset(),
+			open:      true,
+			prev:      b,
+			done:      make(chan struct{}),
+		}
+
+		if a.batches == nil {
+			a.batches = map[[16]byte]*batch{}
+		}
+		a.batches[id] = b
+	}
+
+	b.events = append(b.events, batchedEvent{s, m})
+	b.next = s.Offset() + 1
+	b.recordedAt = s.RecordedAt()
+
+	switch {
+	case b.prev == nil:
+		// There is no batch being committed ahead of this one, so there is
+		// nothing to gain by waiting for further events.
+		a.closeBatch(b)
+	case len(b.events) >= a.MaxBatchSize:
+		a.closeBatch(b)
+	case b.timer == nil:
+		b.timer = time.AfterFunc(
+			a.MaxBatchLatency,
+			func() {
+				a.batchesM.Lock()
+				defer a.batchesM.Unlock()
+
+				if b.open {
+					a.closeBatch(b)
+				}
+			},
+		)
+	}
+
+	return b
+}
+
+// closeBatch prevents any further events from being added to b, and starts
+// committing it.
+//
+// a.batchesM must be held.
+func (a *adaptor) closeBatch(b *batch) {
+	b.open = false
+
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+
+	go a.commitBatch(b)
+}
+
+// commitBatch applies the events in b within a new transaction, once the
+// previous batch for the same stream is done.
+func (a *adaptor) commitBatch(b *batch) {
+	if b.prev != nil {
+		<-b.prev.done
+	}
+
+	b.err = a.Retry.Do(b.ctx, a.Driver, func(ctx context.Context) (err error) {
+		b.ok, err = a.applyBatch(ctx, b)
+		return err
+	})
+
+	a.batchesM.Lock()
+	b.prev = nil
+
+	if next := a.batches[b.streamID]; next == b {
+		delete(a.batches, b.streamID)
+	} else if next != nil && next.open && next.prev == b {
+		// The batch that has been collecting events while this one was being
+		// committed is committed immediately.
+		next.prev = nil
+		a.closeBatch(next)
+	}
+	a.batchesM.Unlock()
+
+	close(b.done)
+}
+
+// applyBatch applies the events in b within a new transaction.
+//
+// It returns false if the checkpoint offset expected by the engine before the
+// first event in the batch is stale.
+func (a *adaptor) applyBatch(ctx context.Context, b *batch) (bool, error) {
+	tx, release, err := a.beginTx(ctx, b.txOptions)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	defer tx.Rollback() // nolint:errcheck
+
+	ok, err := a.Driver.UpdateCheckpointOffset(
+		ctx,
+		tx,
+		a.handlerKey[:],
+		b.streamID[:],
+		b.first,
+		b.next,
+		b.recordedAt,
+	)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	for _, e := range b.events {
+		if err := a.Handler.HandleEvent(ctx, tx, e.Scope, e.Event); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// waitForBatch waits until b has been committed or rolled back, and returns
+// the error that caused it to be rolled back, if any.
+func waitForBatch(ctx context.Context, b *batch) error {
+	select {
+	case <-b.done:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flushBatch commits the batch in progress for the given stream, if any, and
+// waits until all of the stream's batches have been committed or rolled back.
+func (a *adaptor) flushBatch(ctx context.Context, id [16]byte) error {
+	a.batchesM.Lock()
+	b, ok := a.batches[id]
+	if ok && b.open {
+		a.closeBatch(b)
+	}
+	a.batchesM.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return waitForBatch(ctx, b)
+}
+
+// flushBatches commits all batches in progress, and waits until they have been
+// committed or rolled back.
+func (a *adaptor) flushBatches(ctx context.Context) error {
+	a.batchesM.Lock()
+	batches := slices.Collect(maps.Values(a.batches))
+	for _, b := range batches {
+		if b.open {
+			a.closeBatch(b)
+		}
+	}
+	a.batchesM.Unlock()
+
+	var errs []error
+	for _, b := range batches {
+		errs = append(errs, waitForBatch(ctx, b))
+	}
+
+	return errors.Join(errs...)
+}
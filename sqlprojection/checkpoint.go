@@ -0,0 +1,46 @@
+package sqlprojection
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+)
+
+// nullTime returns t as a [sql.NullTime], which is NULL if t is the zero value.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{
+		Time:  t,
+		Valid: !t.IsZero(),
+	}
+}
+
+// nullUnixNano returns t as the number of nanoseconds since the Unix epoch, or
+// NULL if t is the zero value.
+//
+// It's used by drivers for databases that lack a timestamp type with both
+// sub-second precision and time zone information.
+func nullUnixNano(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{
+		Int64: t.UnixNano(),
+		Valid: true,
+	}
+}
+
+// fromNullUnixNano is the inverse of [nullUnixNano].
+func fromNullUnixNano(v sql.NullInt64) time.Time {
+	if !v.Valid {
+		return time.Time{}
+	}
+
+	return time.Unix(0, v.Int64)
+}
+
+// streamIDString returns the string representation of the binary stream ID s.
+func streamIDString(s []byte) string {
+	return uuidpb.FromByteArray([16]byte(s)).AsString()
+}
@@ -0,0 +1,22 @@
+package sqlprojection
+
+// CockroachDriver is a Driver for CockroachDB.
+//
+// This driver should work with any underlying Go SQL driver that supports
+// PostgreSQL compatible databases and $1-style placeholders.
+//
+// It stores checkpoint offsets in the "checkpoint" table within the
+// "projection" schema. Use [NewCockroachDriver] to use different names.
+var CockroachDriver Driver = NewCockroachDriver()
+
+// NewCockroachDriver returns a new Driver for CockroachDB.
+//
+// It accepts the same options as [NewPostgresDriver]. Unlike the PostgreSQL
+// driver, it does not create any functions within the schema.
+//
+// CockroachDB runs all transactions at the SERIALIZABLE isolation level, and
+// may abort a transaction with a serialization failure (SQLSTATE 40001) when it
+// conflicts with another. Such failures are considered retryable.
+func NewCockroachDriver(options ...PostgresOption) Driver {
+	return newPostgresDriver(true, options)
+}
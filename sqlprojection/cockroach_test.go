@@ -0,0 +1,75 @@
+package sqlprojection_test
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/dogmatiq/projectionkit/sqlprojection"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/testcontainers/testcontainers-go/modules/cockroachdb"
+)
+
+func TestCockroachDriver(t *testing.T) {
+	t.Parallel()
+
+	container, err := cockroachdb.Run(
+		t.Context(),
+		"cockroachdb/cockroach",
+		cockroachdb.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := container.Terminate(context.Background()); err != nil {
+			t.Log(err)
+		}
+	})
+
+	dsn, err := container.ConnectionString(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runTests(
+		t,
+		"pgx", dsn,
+		CockroachDriver,
+		`SHOW transaction_isolation`,
+	)
+
+	// Before the CockroachDB driver was introduced, CockroachDB databases were
+	// managed by the PostgreSQL driver.
+	testBaselineMigration(
+		t,
+		"pgx", dsn,
+		CockroachDriver,
+		postgresBaselineSchema,
+		postgresBaselineInsert,
+	)
+
+	t.Run("with custom schema and table names", func(t *testing.T) {
+		runTests(
+			t,
+			"pgx", dsn,
+			NewCockroachDriver(
+				WithPostgresSchema("app-projection"),
+				WithPostgresTable(`app "checkpoint"`),
+			),
+			`SHOW transaction_isolation`,
+		)
+	})
+
+	t.Run("with a hash-sharded primary key", func(t *testing.T) {
+		runTests(
+			t,
+			"pgx", dsn,
+			NewCockroachDriver(
+				WithPostgresTable("partitioned_checkpoint"),
+				WithPostgresPartitions(4),
+			),
+			`SHOW transaction_isolation`,
+		)
+	})
+}
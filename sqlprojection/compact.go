@@ -0,0 +1,192 @@
+package sqlprojection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// CompactInChunks executes a statement that removes or consolidates projection
+// data repeatedly, each time within its own transaction, until the statement
+// affects fewer rows than the chunk size.
+//
+// It's intended for use within [MessageHandler.Compact] implementations.
+//
+// The chunk size is appended to args, such that the final parameter of query is
+// the maximum number of rows that the statement should affect. For example,
+// using PostgreSQL:
+//
+//	DELETE FROM session
+//	WHERE id IN (
+//		SELECT id FROM session
+//		WHERE expires_at < NOW()
+//		LIMIT $1
+//	)
+//
+// Each chunk must remove the rows it affects from the set matched by the
+// statement, such as by deleting them or by updating the columns on which the
+// statement filters. Otherwise, every chunk affects the same rows and
+// compaction never finishes. Use [WithMaxChunks] to bound the number of chunks
+// regardless.
+//
+// If ctx reaches its deadline, or the maximum number of chunks is reached,
+// compaction stops without error. The chunks that have already been committed
+// are retained, and the remaining data is compacted the next time
+// CompactInChunks is called. ctx is checked before each chunk.
+//
+// It returns the progress made, even if an error occurs.
+func CompactInChunks(
+	ctx context.Context,
+	db *sql.DB,
+	query string,
+	args []any,
+	options ...CompactOption,
+) (CompactProgress, error) {
+	c := compactor{
+		ChunkSize: 1000,
+	}
+
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	args = append(args[:len(args):len(args)], c.ChunkSize)
+
+	var p CompactProgress
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return p, stopCompaction(err)
+		}
+
+		n, err := compactChunk(ctx, db, c.TxOptions, query, args)
+		if err != nil {
+			if ctx.Err() != nil {
+				return p, stopCompaction(ctx.Err())
+			}
+			return p, err
+		}
+
+		p.Chunks++
+		p.RowsAffected += n
+
+		if c.OnProgress != nil {
+			c.OnProgress(p)
+		}
+
+		if n < int64(c.ChunkSize) {
+			return p, nil
+		}
+
+		if c.MaxChunks != 0 && p.Chunks >= c.MaxChunks {
+			return p, nil
+		}
+	}
+}
+
+// CompactProgress describes the progress made by [CompactInChunks].
+type CompactProgress struct {
+	// Chunks is the number of chunks that have been committed.
+	Chunks int
+
+	// RowsAffected is the total number of rows affected by the committed
+	// chunks.
+	RowsAffected int64
+}
+
+// CompactOption is a functional option that changes the behavior of
+// [CompactInChunks].
+type CompactOption func(*compactor)
+
+// WithChunkSize is a [CompactOption] that sets the maximum number of rows
+// affected by each chunk.
+//
+// By default, each chunk affects up to 1000 rows.
+func WithChunkSize(n int) CompactOption {
+	if n <= 0 {
+		panic("chunk size must be positive")
+	}
+
+	return func(c *compactor) {
+		c.ChunkSize = n
+	}
+}
+
+// WithMaxChunks is a [CompactOption] that sets the maximum number of chunks
+// committed by a single call to [CompactInChunks].
+//
+// By default, there is no limit, and compaction continues until a chunk
+// affects fewer rows than the chunk size, or ctx is done.
+func WithMaxChunks(n int) CompactOption {
+	if n <= 0 {
+		panic("maximum number of chunks must be positive")
+	}
+
+	return func(c *compactor) {
+		c.MaxChunks = n
+	}
+}
+
+// WithCompactTxOptions is a [CompactOption] that sets the options used to begin
+// the transaction for each chunk.
+func WithCompactTxOptions(opts *sql.TxOptions) CompactOption {
+	return func(c *compactor) {
+		c.TxOptions = opts
+	}
+}
+
+// WithProgressReporter is a [CompactOption] that sets a function that is
+// called after each chunk is committed.
+func WithProgressReporter(fn func(CompactProgress)) CompactOption {
+	return func(c *compactor) {
+		c.OnProgress = fn
+	}
+}
+
+// compactor is the configuration used by [CompactInChunks].
+type compactor struct {
+	ChunkSize  int
+	MaxChunks  int
+	TxOptions  *sql.TxOptions
+	OnProgress func(CompactProgress)
+}
+
+// compactChunk executes query within a new transaction and returns the number
+// of rows affected.
+func compactChunk(
+	ctx context.Context,
+	db *sql.DB,
+	opts *sql.TxOptions,
+	query string,
+	args []any,
+) (int64, error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
+
+// stopCompaction returns the error to report when compaction stops because its
+// context is done.
+//
+// Reaching the deadline is the expected way for incremental compaction to end,
+// so it's not reported as an error.
+func stopCompaction(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,195 @@
+package sqlprojection_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/dogmatiq/projectionkit/sqlprojection"
+	_ "modernc.org/sqlite"
+)
+
+func TestCompactInChunks(t *testing.T) {
+	const query = `DELETE FROM data WHERE id IN (SELECT id FROM data WHERE id > ? LIMIT ?)`
+
+	setup := func(t *testing.T, rows int) *sql.DB {
+		t.Helper()
+
+		file, err := os.CreateTemp("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		t.Cleanup(func() {
+			os.Remove(file.Name())
+		})
+
+		db, err := sql.Open("sqlite", "file:"+file.Name()+"?mode=rwc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		if _, err := db.ExecContext(
+			t.Context(),
+			`CREATE TABLE data (id INTEGER NOT NULL PRIMARY KEY)`,
+		); err != nil {
+			t.Fatal(err)
+		}
+
+		for id := range rows {
+			if _, err := db.ExecContext(
+				t.Context(),
+				`INSERT INTO data VALUES (?)`,
+				id+1,
+			); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return db
+	}
+
+	countRows := func(t *testing.T, db *sql.DB) int {
+		t.Helper()
+
+		var n int
+		if err := db.QueryRowContext(
+			t.Context(),
+			`SELECT COUNT(*) FROM data`,
+		).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+
+		return n
+	}
+
+	t.Run("it executes the statement until it affects fewer rows than the chunk size", func(t *testing.T) {
+		db := setup(t, 30)
+
+		var reports []CompactProgress
+
+		p, err := CompactInChunks(
+			t.Context(),
+			db,
+			query,
+			[]any{5},
+			WithChunkSize(10),
+			WithProgressReporter(func(p CompactProgress) {
+				reports = append(reports, p)
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := CompactProgress{Chunks: 3, RowsAffected: 25}
+		if p != want {
+			t.Fatalf("unexpected progress: got %+v, want %+v", p, want)
+		}
+
+		if len(reports) != 3 || reports[0].RowsAffected != 10 || reports[2] != want {
+			t.Fatalf("unexpected progress reports: %+v", reports)
+		}
+
+		if n := countRows(t, db); n != 5 {
+			t.Fatalf("unexpected number of rows: got %d, want 5", n)
+		}
+	})
+
+	t.Run("it stops without error when the context deadline is reached", func(t *testing.T) {
+		db := setup(t, 25)
+
+		ctx, cancel := context.WithDeadline(t.Context(), time.Now().Add(-time.Second))
+		defer cancel()
+
+		p, err := CompactInChunks(ctx, db, query, []any{0}, WithChunkSize(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p != (CompactProgress{}) {
+			t.Fatalf("unexpected progress: got %+v, want zero", p)
+		}
+
+		if n := countRows(t, db); n != 25 {
+			t.Fatalf("unexpected number of rows: got %d, want 25", n)
+		}
+	})
+
+	t.Run("it stops without error when the maximum number of chunks is reached", func(t *testing.T) {
+		db := setup(t, 25)
+
+		// The statement does not remove the rows it affects from its own
+		// predicate, so it never affects fewer rows than the chunk size.
+		p, err := CompactInChunks(
+			t.Context(),
+			db,
+			`UPDATE data SET id = id WHERE id IN (SELECT id FROM data WHERE id > ? LIMIT ?)`,
+			[]any{0},
+			WithChunkSize(10),
+			WithMaxChunks(3),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := CompactProgress{Chunks: 3, RowsAffected: 30}
+		if p != want {
+			t.Fatalf("unexpected progress: got %+v, want %+v", p, want)
+		}
+	})
+
+	t.Run("it returns an error if the context is canceled", func(t *testing.T) {
+		db := setup(t, 25)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		if _, err := CompactInChunks(ctx, db, query, []any{0}); !errors.Is(err, context.Canceled) {
+			t.Fatalf("unexpected error: got %v, want %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("it returns an error if the statement fails", func(t *testing.T) {
+		db := setup(t, 25)
+
+		if _, err := CompactInChunks(
+			t.Context(),
+			db,
+			`DELETE FROM nonexistent LIMIT ?`,
+			nil,
+		); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("func WithChunkSize()", func(t *testing.T) {
+		t.Run("it panics if the chunk size is not positive", func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+
+			WithChunkSize(0)
+		})
+	})
+
+	t.Run("func WithMaxChunks()", func(t *testing.T) {
+		t.Run("it panics if the maximum number of chunks is not positive", func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+
+			WithMaxChunks(0)
+		})
+	})
+}
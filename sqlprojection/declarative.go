@@ -0,0 +1,157 @@
+package sqlprojection
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+
+	"github.com/dogmatiq/dogma"
+)
+
+// HandlerBuilder builds a [MessageHandler] that updates the projection by
+// executing parameterized statements in response to each type of event.
+//
+// Statements are written using ?-style placeholders, which are rewritten to
+// the style expected by the [Driver] that is passed to [NewHandlerBuilder]
+// using [Dialect.Rebind].
+type HandlerBuilder struct {
+	driver     Driver
+	name, key  string
+	routes     []dogma.ProjectionRoute
+	statements map[reflect.Type][]eventStatement
+	resets     []string
+}
+
+// eventStatement is a statement executed in response to an event.
+type eventStatement struct {
+	Query string
+	Args  func(dogma.Event) []any
+}
+
+// NewHandlerBuilder returns a [HandlerBuilder] for a handler with the given
+// identity, which executes statements written for use with d.
+func NewHandlerBuilder(name, key string, d Driver) *HandlerBuilder {
+	return &HandlerBuilder{
+		driver:     d,
+		name:       name,
+		key:        key,
+		statements: map[reflect.Type][]eventStatement{},
+	}
+}
+
+// OnEvent configures b to execute query when handling events of type E.
+//
+// args returns the values of the query's parameters for a specific event. It
+// may be nil if the query has no parameters.
+//
+// It may be called multiple times for the same event type, in which case the
+// statements are executed in the order they were added, within the same
+// transaction.
+func OnEvent[E dogma.Event](
+	b *HandlerBuilder,
+	query string,
+	args func(E) []any,
+) {
+	t := reflect.TypeFor[E]()
+
+	if _, ok := b.statements[t]; !ok {
+		b.routes = append(b.routes, dogma.HandlesEvent[E]())
+	}
+
+	st := eventStatement{
+		Query: b.driver.Dialect().Rebind(query),
+	}
+
+	if args != nil {
+		st.Args = func(m dogma.Event) []any {
+			return args(m.(E))
+		}
+	}
+
+	b.statements[t] = append(b.statements[t], st)
+}
+
+// OnReset configures b to execute query when the projection is reset.
+//
+// The query typically deletes all rows from one of the projection's tables.
+// It's executed within the same transaction as the removal of the projection's
+// checkpoint offsets, so it should not use statements that implicitly commit
+// the transaction, such as TRUNCATE on MySQL.
+//
+// If no reset statements are added, the handler does not support being reset.
+func (b *HandlerBuilder) OnReset(query string) {
+	b.resets = append(b.resets, b.driver.Dialect().Rebind(query))
+}
+
+// Build returns a [MessageHandler] that executes the statements added to b.
+//
+// The handler consumes all event types for which statements have been added.
+// Subsequent changes to b do not affect the returned handler.
+func (b *HandlerBuilder) Build() MessageHandler {
+	h := &declarativeHandler{
+		name:       b.name,
+		key:        b.key,
+		routes:     append([]dogma.ProjectionRoute(nil), b.routes...),
+		statements: make(map[reflect.Type][]eventStatement, len(b.statements)),
+		resets:     append([]string(nil), b.resets...),
+	}
+
+	for t, st := range b.statements {
+		h.statements[t] = append([]eventStatement(nil), st...)
+	}
+
+	return h
+}
+
+// declarativeHandler is a [MessageHandler] built by a [HandlerBuilder].
+type declarativeHandler struct {
+	NoCompactBehavior
+
+	name, key  string
+	routes     []dogma.ProjectionRoute
+	statements map[reflect.Type][]eventStatement
+	resets     []string
+}
+
+func (h *declarativeHandler) Configure(c dogma.ProjectionConfigurer) {
+	c.Identity(h.name, h.key)
+	c.Routes(h.routes...)
+}
+
+func (h *declarativeHandler) HandleEvent(
+	ctx context.Context,
+	tx *sql.Tx,
+	_ dogma.ProjectionEventScope,
+	m dogma.Event,
+) error {
+	for _, st := range h.statements[reflect.TypeOf(m)] {
+		var args []any
+		if st.Args != nil {
+			args = st.Args(m)
+		}
+
+		if _, err := tx.ExecContext(ctx, st.Query, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *declarativeHandler) Reset(
+	ctx context.Context,
+	tx *sql.Tx,
+	_ dogma.ProjectionResetScope,
+) error {
+	if len(h.resets) == 0 {
+		return dogma.ErrNotSupported
+	}
+
+	for _, q := range h.resets {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
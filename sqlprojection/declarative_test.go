@@ -0,0 +1,288 @@
+package sqlprojection_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dogmatiq/dogma"
+	"github.com/dogmatiq/enginekit/config/runtimeconfig"
+	. "github.com/dogmatiq/enginekit/enginetest/stubs"
+	"github.com/dogmatiq/enginekit/message"
+	"github.com/dogmatiq/projectionkit/projectiontest"
+	. "github.com/dogmatiq/projectionkit/sqlprojection"
+)
+
+func TestHandlerBuilder(t *testing.T) {
+	t.Parallel()
+
+	// handle applies an event to h within a transaction on a database that
+	// records the statements it executes, and returns those statements.
+	handle := func(t *testing.T, h MessageHandler, m dogma.Event) []recordedStatement {
+		t.Helper()
+
+		rec := &statementRecorder{}
+		db := sql.OpenDB(rec)
+		defer db.Close()
+
+		tx, err := db.BeginTx(t.Context(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback() // nolint:errcheck
+
+		if err := h.HandleEvent(t.Context(), tx, &ProjectionEventScopeStub{}, m); err != nil {
+			t.Fatal(err)
+		}
+
+		return rec.Statements
+	}
+
+	// reset resets h within a transaction on a database that records the
+	// statements it executes, and returns those statements.
+	reset := func(t *testing.T, h MessageHandler) ([]recordedStatement, error) {
+		t.Helper()
+
+		rec := &statementRecorder{}
+		db := sql.OpenDB(rec)
+		defer db.Close()
+
+		tx, err := db.BeginTx(t.Context(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback() // nolint:errcheck
+
+		err = h.Reset(t.Context(), tx, &ProjectionResetScopeStub{})
+		return rec.Statements, err
+	}
+
+	t.Run("func OnEvent()", func(t *testing.T) {
+		t.Run("it executes the statements for an event type in the order they were added", func(t *testing.T) {
+			b := NewHandlerBuilder("<projection>", projectiontest.IdentityKey, SQLiteDriver)
+
+			OnEvent(b, `INSERT INTO a VALUES (?)`, func(m *EventStub[TypeA]) []any {
+				return []any{"a:" + string(m.Content)}
+			})
+			OnEvent(b, `INSERT INTO b VALUES (?)`, func(m *EventStub[TypeB]) []any {
+				return []any{"b:" + string(m.Content)}
+			})
+			OnEvent(b, `INSERT INTO c VALUES (?)`, func(m *EventStub[TypeA]) []any {
+				return []any{"c:" + string(m.Content)}
+			})
+
+			got := handle(t, b.Build(), EventA1)
+			want := []recordedStatement{
+				{`INSERT INTO a VALUES (?)`, []any{"a:A1"}},
+				{`INSERT INTO c VALUES (?)`, []any{"c:A1"}},
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("unexpected statements: got %v, want %v", got, want)
+			}
+		})
+
+		t.Run("it executes the statement without arguments if args is nil", func(t *testing.T) {
+			b := NewHandlerBuilder("<projection>", projectiontest.IdentityKey, SQLiteDriver)
+
+			OnEvent(b, `DELETE FROM a`, (func(*EventStub[TypeA]) []any)(nil))
+
+			got := handle(t, b.Build(), EventA1)
+			want := []recordedStatement{
+				{`DELETE FROM a`, nil},
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("unexpected statements: got %v, want %v", got, want)
+			}
+		})
+
+		t.Run("it rewrites the placeholders for the driver's dialect", func(t *testing.T) {
+			const query = `UPDATE a SET x = ? WHERE y = ? AND z <> '?'`
+
+			cases := []struct {
+				Desc   string
+				Driver Driver
+				Want   string
+			}{
+				{"SQLite", SQLiteDriver, `UPDATE a SET x = ? WHERE y = ? AND z <> '?'`},
+				{"MySQL", MySQLDriver, `UPDATE a SET x = ? WHERE y = ? AND z <> '?'`},
+				{"PostgreSQL", PostgresDriver, `UPDATE a SET x = $1 WHERE y = $2 AND z <> '?'`},
+				{"CockroachDB", CockroachDriver, `UPDATE a SET x = $1 WHERE y = $2 AND z <> '?'`},
+				{"SQL Server", MSSQLDriver, `UPDATE a SET x = @p1 WHERE y = @p2 AND z <> '?'`},
+			}
+
+			for _, c := range cases {
+				t.Run(c.Desc, func(t *testing.T) {
+					b := NewHandlerBuilder("<projection>", projectiontest.IdentityKey, c.Driver)
+
+					OnEvent(b, query, func(*EventStub[TypeA]) []any {
+						return []any{1, 2}
+					})
+					b.OnReset(query)
+
+					h := b.Build()
+
+					got := handle(t, h, EventA1)
+					if len(got) != 1 || got[0].Query != c.Want {
+						t.Fatalf("unexpected event statements: got %v, want %q", got, c.Want)
+					}
+
+					got, err := reset(t, h)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if len(got) != 1 || got[0].Query != c.Want {
+						t.Fatalf("unexpected reset statements: got %v, want %q", got, c.Want)
+					}
+				})
+			}
+		})
+	})
+
+	t.Run("func OnReset()", func(t *testing.T) {
+		t.Run("it executes the reset statements in the order they were added", func(t *testing.T) {
+			b := NewHandlerBuilder("<projection>", projectiontest.IdentityKey, SQLiteDriver)
+
+			b.OnReset(`DELETE FROM a`)
+			b.OnReset(`DELETE FROM b`)
+
+			got, err := reset(t, b.Build())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []recordedStatement{
+				{`DELETE FROM a`, nil},
+				{`DELETE FROM b`, nil},
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("unexpected statements: got %v, want %v", got, want)
+			}
+		})
+
+		t.Run("it does not support reset if there are no reset statements", func(t *testing.T) {
+			b := NewHandlerBuilder("<projection>", projectiontest.IdentityKey, SQLiteDriver)
+
+			OnEvent(b, `DELETE FROM a`, (func(*EventStub[TypeA]) []any)(nil))
+
+			got, err := reset(t, b.Build())
+			if !errors.Is(err, dogma.ErrNotSupported) {
+				t.Fatalf("unexpected error: got %v, want %v", err, dogma.ErrNotSupported)
+			}
+
+			if len(got) != 0 {
+				t.Fatalf("unexpected statements: %v", got)
+			}
+		})
+	})
+
+	t.Run("func Build()", func(t *testing.T) {
+		t.Run("it is not affected by subsequent changes to the builder", func(t *testing.T) {
+			b := NewHandlerBuilder("<projection>", projectiontest.IdentityKey, SQLiteDriver)
+
+			OnEvent(b, `INSERT INTO a VALUES (1)`, (func(*EventStub[TypeA]) []any)(nil))
+			h := b.Build()
+
+			OnEvent(b, `INSERT INTO a VALUES (2)`, (func(*EventStub[TypeA]) []any)(nil))
+			OnEvent(b, `INSERT INTO b VALUES (1)`, (func(*EventStub[TypeB]) []any)(nil))
+			b.OnReset(`DELETE FROM a`)
+
+			got := handle(t, h, EventA1)
+			want := []recordedStatement{
+				{`INSERT INTO a VALUES (1)`, nil},
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("unexpected statements: got %v, want %v", got, want)
+			}
+
+			if got := handle(t, h, EventB1); len(got) != 0 {
+				t.Fatalf("unexpected statements: %v", got)
+			}
+
+			cfg := runtimeconfig.FromProjection(New(nil, SQLiteDriver, h))
+			if cfg.RouteSet().HasMessageType(message.TypeFor[*EventStub[TypeB]]()) {
+				t.Fatal("did not expect the handler to route events of type B")
+			}
+
+			if _, err := reset(t, h); !errors.Is(err, dogma.ErrNotSupported) {
+				t.Fatalf("unexpected error: got %v, want %v", err, dogma.ErrNotSupported)
+			}
+		})
+	})
+}
+
+// recordedStatement is a statement executed via a [statementRecorder].
+type recordedStatement struct {
+	Query string
+	Args  []any
+}
+
+// statementRecorder is a [driver.Connector] for a database that records the
+// statements executed on it, instead of executing them.
+type statementRecorder struct {
+	Statements []recordedStatement
+}
+
+func (r *statementRecorder) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{r}, nil
+}
+
+func (r *statementRecorder) Driver() driver.Driver {
+	return recordingDriver{r}
+}
+
+// recordingDriver is the [driver.Driver] of a [statementRecorder].
+type recordingDriver struct {
+	r *statementRecorder
+}
+
+func (d recordingDriver) Open(string) (driver.Conn, error) {
+	return &recordingConn{d.r}, nil
+}
+
+// recordingConn is a connection to a [statementRecorder].
+type recordingConn struct {
+	r *statementRecorder
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *recordingConn) Commit() error {
+	return nil
+}
+
+func (c *recordingConn) Rollback() error {
+	return nil
+}
+
+func (c *recordingConn) ExecContext(
+	_ context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Result, error) {
+	st := recordedStatement{Query: query}
+	for _, a := range args {
+		st.Args = append(st.Args, a.Value)
+	}
+
+	c.r.Statements = append(c.r.Statements, st)
+
+	return driver.RowsAffected(0), nil
+}
@@ -0,0 +1,424 @@
+package sqlprojection
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+)
+
+// Dialect provides helpers for writing SQL that is portable across the
+// databases supported by the built-in drivers.
+//
+// Use [Driver.Dialect] to obtain the dialect for a specific driver.
+type Dialect interface {
+	// Rebind rewrites the ?-style placeholders in query to the style expected
+	// by the database.
+	//
+	// Question marks within quoted strings, quoted identifiers and comments are
+	// not treated as placeholders, nor are those within dollar-quoted strings
+	// on PostgreSQL. Operators that contain a question mark, such as the
+	// PostgreSQL jsonb ? operator, can not be used in query. Use equivalent
+	// functions, such as jsonb_exists(), instead.
+	Rebind(query string) string
+
+	// QuoteIdentifier returns name quoted for use as an identifier.
+	QuoteIdentifier(name string) string
+
+	// Upsert returns a statement that inserts a row into table, or updates
+	// the existing row if one with the same key already exists.
+	//
+	// The statement's parameters are the values of the key columns followed by
+	// the values of the other columns, in the order given. When a row is
+	// updated, only the non-key columns are changed.
+	//
+	// The table and column names are used verbatim. Use QuoteIdentifier to
+	// quote them if necessary.
+	//
+	// It panics if key is empty.
+	Upsert(table string, key []string, columns ...string) string
+
+	// UUIDColumnType returns the column type used to store UUIDs.
+	UUIDColumnType() string
+
+	// EncodeUUID returns the parameter value used to store the UUID with the
+	// given RFC 9562 string representation in a column of type
+	// UUIDColumnType().
+	EncodeUUID(id string) (any, error)
+
+	// DecodeUUID returns the RFC 9562 string representation of a UUID that
+	// was scanned into a byte slice from a column of type UUIDColumnType().
+	DecodeUUID(data []byte) (string, error)
+}
+
+// postgresDialect is the [Dialect] for PostgreSQL and CockroachDB.
+type postgresDialect struct{}
+
+func (postgresDialect) Rebind(query string) string {
+	return rebind(query, postgresQuoting, func(n int) string {
+		return "$" + strconv.Itoa(n)
+	})
+}
+
+func (postgresDialect) QuoteIdentifier(name string) string {
+	return quotePostgresIdentifier(name)
+}
+
+func (postgresDialect) Upsert(table string, key []string, columns ...string) string {
+	return upsertOnConflict(table, key, columns, "$")
+}
+
+func (postgresDialect) UUIDColumnType() string {
+	return "UUID"
+}
+
+func (postgresDialect) EncodeUUID(id string) (any, error) {
+	// The database converts the string representation to its native UUID type
+	// based on the type of the column.
+	x, err := uuidpb.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return x.AsString(), nil
+}
+
+func (postgresDialect) DecodeUUID(data []byte) (string, error) {
+	x, err := uuidpb.Parse(string(data))
+	if err != nil {
+		return "", err
+	}
+	return x.AsString(), nil
+}
+
+// mysqlDialect is the [Dialect] for MySQL and MariaDB.
+type mysqlDialect struct {
+	binaryUUID
+}
+
+func (mysqlDialect) Rebind(query string) string {
+	return query
+}
+
+func (mysqlDialect) QuoteIdentifier(name string) string {
+	return quoteMySQLIdentifier(name)
+}
+
+// Upsert returns an INSERT ... ON DUPLICATE KEY UPDATE statement.
+//
+// The new values are referenced using the VALUES() function, which is
+// deprecated as of MySQL 8.0.20 in favor of row aliases. Row aliases are not
+// supported by MariaDB or by MySQL versions prior to 8.0.19.
+func (mysqlDialect) Upsert(table string, key []string, columns ...string) string {
+	checkUpsertKey(key)
+
+	var w strings.Builder
+	writeInsert(&w, table, key, columns, "?")
+
+	// MySQL requires at least one assignment, so a no-op assignment is used if
+	// there are no non-key columns.
+	w.WriteString(` ON DUPLICATE KEY UPDATE `)
+	if len(columns) == 0 {
+		w.WriteString(key[0] + ` = ` + key[0])
+	}
+
+	for i, c := range columns {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteString(c + ` = VALUES(` + c + `)`)
+	}
+
+	return w.String()
+}
+
+// sqliteDialect is the [Dialect] for SQLite.
+type sqliteDialect struct {
+	binaryUUID
+}
+
+func (sqliteDialect) Rebind(query string) string {
+	return query
+}
+
+func (sqliteDialect) QuoteIdentifier(name string) string {
+	return quoteSQLiteIdentifier(name)
+}
+
+func (sqliteDialect) Upsert(table string, key []string, columns ...string) string {
+	return upsertOnConflict(table, key, columns, "?")
+}
+
+func (sqliteDialect) UUIDColumnType() string {
+	return "BLOB"
+}
+
+// mssqlDialect is the [Dialect] for Microsoft SQL Server.
+type mssqlDialect struct{}
+
+func (mssqlDialect) Rebind(query string) string {
+	return rebind(query, mssqlQuoting, func(n int) string {
+		return "@p" + strconv.Itoa(n)
+	})
+}
+
+func (mssqlDialect) QuoteIdentifier(name string) string {
+	return quoteMSSQLIdentifier(name)
+}
+
+func (mssqlDialect) Upsert(table string, key []string, columns ...string) string {
+	checkUpsertKey(key)
+
+	all := append(key[:len(key):len(key)], columns...)
+
+	var w strings.Builder
+	w.WriteString(`MERGE INTO ` + table + ` WITH (HOLDLOCK) AS t USING (VALUES (`)
+
+	for i := range all {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteString("@p" + strconv.Itoa(i+1))
+	}
+
+	w.WriteString(`)) AS s (` + strings.Join(all, ", ") + `) ON `)
+
+	for i, k := range key {
+		if i > 0 {
+			w.WriteString(" AND ")
+		}
+		w.WriteString(`t.` + k + ` = s.` + k)
+	}
+
+	if len(columns) != 0 {
+		w.WriteString(` WHEN MATCHED THEN UPDATE SET `)
+		for i, c := range columns {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			w.WriteString(c + ` = s.` + c)
+		}
+	}
+
+	w.WriteString(` WHEN NOT MATCHED THEN INSERT (` + strings.Join(all, ", ") + `) VALUES (`)
+
+	for i, c := range all {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteString(`s.` + c)
+	}
+
+	// SQL Server requires MERGE statements to be terminated by a semicolon.
+	w.WriteString(`);`)
+
+	return w.String()
+}
+
+func (mssqlDialect) UUIDColumnType() string {
+	return "UNIQUEIDENTIFIER"
+}
+
+func (mssqlDialect) EncodeUUID(id string) (any, error) {
+	// The database converts the string representation to its native UUID type
+	// based on the type of the column.
+	x, err := uuidpb.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return x.AsString(), nil
+}
+
+func (mssqlDialect) DecodeUUID(data []byte) (string, error) {
+	if len(data) != 16 {
+		return "", fmt.Errorf("UUID must be 16 bytes, got %d", len(data))
+	}
+
+	// SQL Server stores the first three groups of a UNIQUEIDENTIFIER in
+	// little-endian byte order.
+	var b [16]byte
+	copy(b[:], data)
+	slices.Reverse(b[0:4])
+	slices.Reverse(b[4:6])
+	slices.Reverse(b[6:8])
+
+	return uuidpb.FromByteArray(b).AsString(), nil
+}
+
+// binaryUUID provides the UUID-related methods of a [Dialect] for databases
+// that store UUIDs as 16-byte binary values.
+type binaryUUID struct{}
+
+func (binaryUUID) UUIDColumnType() string {
+	return "BINARY(16)"
+}
+
+func (binaryUUID) EncodeUUID(id string) (any, error) {
+	return uuidpb.ParseAsBytes(id)
+}
+
+func (binaryUUID) DecodeUUID(data []byte) (string, error) {
+	x, err := uuidpb.FromBytes(data)
+	if err != nil {
+		return "", err
+	}
+	return x.AsString(), nil
+}
+
+// upsertOnConflict returns an upsert statement that uses the INSERT ... ON
+// CONFLICT syntax supported by PostgreSQL and SQLite.
+func upsertOnConflict(table string, key, columns []string, placeholder string) string {
+	checkUpsertKey(key)
+
+	var w strings.Builder
+	writeInsert(&w, table, key, columns, placeholder)
+
+	w.WriteString(` ON CONFLICT (` + strings.Join(key, ", ") + `) DO `)
+
+	if len(columns) == 0 {
+		w.WriteString(`NOTHING`)
+		return w.String()
+	}
+
+	w.WriteString(`UPDATE SET `)
+	for i, c := range columns {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteString(c + ` = excluded.` + c)
+	}
+
+	return w.String()
+}
+
+// checkUpsertKey panics if key, the key columns passed to [Dialect.Upsert], is
+// empty.
+func checkUpsertKey(key []string) {
+	if len(key) == 0 {
+		panic("upsert must have at least one key column")
+	}
+}
+
+// writeInsert writes an INSERT statement to w. If placeholder is "$", the
+// parameters are numbered, otherwise placeholder is used for each parameter.
+func writeInsert(w *strings.Builder, table string, key, columns []string, placeholder string) {
+	all := append(key[:len(key):len(key)], columns...)
+
+	w.WriteString(`INSERT INTO ` + table + ` (` + strings.Join(all, ", ") + `) VALUES (`)
+
+	for i := range all {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+
+		w.WriteString(placeholder)
+		if placeholder == "$" {
+			w.WriteString(strconv.Itoa(i + 1))
+		}
+	}
+
+	w.WriteString(`)`)
+}
+
+// quoting describes the database-specific forms of quoting recognized by
+// [rebind], in addition to quoted strings and identifiers.
+type quoting struct {
+	// Brackets is true if text within square brackets is a quoted identifier.
+	Brackets bool
+
+	// DollarQuotes is true if text between two identical $tag$ delimiters is
+	// a string constant.
+	DollarQuotes bool
+}
+
+var (
+	postgresQuoting = quoting{DollarQuotes: true}
+	mssqlQuoting    = quoting{Brackets: true}
+)
+
+// rebind rewrites the ?-style placeholders in query using p, which returns the
+// placeholder for the n'th parameter.
+func rebind(query string, q quoting, p func(n int) string) string {
+	var (
+		w strings.Builder
+		n int
+	)
+
+	for i := 0; i < len(query); {
+		var end int
+
+		switch {
+		case query[i] == '?':
+			n++
+			w.WriteString(p(n))
+			i++
+			continue
+		case query[i] == '\'', query[i] == '"', query[i] == '`':
+			end = skipPast(query, i+1, query[i:i+1])
+		case q.DollarQuotes && query[i] == '$' && !isIdentifierChar(query, i-1):
+			end = i + 1
+			if tag, ok := dollarQuoteTag(query[i:]); ok {
+				end = skipPast(query, i+len(tag), tag)
+			}
+		case q.Brackets && query[i] == '[':
+			end = skipPast(query, i+1, "]")
+			// A closing bracket is escaped by doubling it.
+			for end < len(query) && query[end] == ']' {
+				end = skipPast(query, end+1, "]")
+			}
+		case strings.HasPrefix(query[i:], "--"):
+			end = skipPast(query, i+2, "\n")
+		case strings.HasPrefix(query[i:], "/*"):
+			end = skipPast(query, i+2, "*/")
+		default:
+			end = i + 1
+		}
+
+		w.WriteString(query[i:end])
+		i = end
+	}
+
+	return w.String()
+}
+
+// dollarQuoteTag returns the $tag$ delimiter at the start of s, if any.
+func dollarQuoteTag(s string) (string, bool) {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$':
+			return s[:i+1], true
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= 0x80:
+		case c >= '0' && c <= '9' && i > 1:
+		default:
+			// The tag is not a valid identifier, so s begins with a
+			// positional parameter such as $1, or is not a delimiter at all.
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// isIdentifierChar returns true if the byte at index i of query may form part
+// of an unquoted identifier, in which case a $ at index i+1 is also part of the
+// identifier.
+func isIdentifierChar(query string, i int) bool {
+	if i < 0 {
+		return false
+	}
+
+	c := query[i]
+	return c == '_' || c == '$' || c >= 0x80 ||
+		c >= 'a' && c <= 'z' ||
+		c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9'
+}
+
+// skipPast returns the index immediately after the first occurrence of delim
+// in query at or after index i, or len(query) if there is none.
+func skipPast(query string, i int, delim string) int {
+	if n := strings.Index(query[i:], delim); n != -1 {
+		return i + n + len(delim)
+	}
+	return len(query)
+}
@@ -3,13 +3,35 @@ package sqlprojection
 import (
 	"context"
 	"database/sql"
+	"time"
+
+	"github.com/dogmatiq/projectionkit"
 )
 
 // Driver is an interface for database-specific projection drivers.
 type Driver interface {
 	// CreateSchema creates the schema elements required by the driver.
+	//
+	// It's equivalent to MigrateSchema.
 	CreateSchema(ctx context.Context, db *sql.DB) error
 
+	// MigrateSchema creates the schema elements required by the driver, or
+	// upgrades them to the latest version.
+	//
+	// The schema is not upgraded automatically. MigrateSchema must be called
+	// before an adaptor that uses a newer version of the driver handles any
+	// events.
+	//
+	// It's safe to call MigrateSchema concurrently, including from multiple
+	// processes.
+	MigrateSchema(ctx context.Context, db *sql.DB) error
+
+	// SchemaVersion returns the version of the schema that has been applied to
+	// the database.
+	//
+	// It returns 0 if the schema has not been created.
+	SchemaVersion(ctx context.Context, db *sql.DB) (int, error)
+
 	// DropSchema drops the schema elements required by the driver.
 	DropSchema(ctx context.Context, db *sql.DB) error
 
@@ -21,17 +43,83 @@ type Driver interface {
 		h, s []byte,
 	) (uint64, error)
 
+	// QueryCheckpoint returns the stored checkpoint for a specific handler and
+	// event stream.
+	//
+	// It returns a checkpoint with an offset of zero if there is no stored
+	// checkpoint.
+	QueryCheckpoint(
+		ctx context.Context,
+		db *sql.DB,
+		h, s []byte,
+	) (projectionkit.Checkpoint, error)
+
+	// QueryCheckpoints returns up to limit stored checkpoints for a specific
+	// handler, ordered by stream ID.
+	//
+	// If after is non-nil, only checkpoints for streams with IDs that sort
+	// after it are returned.
+	QueryCheckpoints(
+		ctx context.Context,
+		db *sql.DB,
+		h, after []byte,
+		limit int,
+	) ([]projectionkit.Checkpoint, error)
+
+	// CountCheckpoints returns the number of stored checkpoints for a specific
+	// handler.
+	CountCheckpoints(
+		ctx context.Context,
+		db *sql.DB,
+		h []byte,
+	) (uint64, error)
+
+	// QueryHandlers returns the identity keys of all handlers that have stored
+	// checkpoints, in sorted order.
+	QueryHandlers(
+		ctx context.Context,
+		db *sql.DB,
+	) ([][]byte, error)
+
+	// StoreCheckpointOffset sets the checkpoint offset for a specific handler
+	// and event stream to n, regardless of its current value.
+	//
+	// It's intended for manual repairs, and must not be used while the handler
+	// is running. The time at which the last event was recorded is cleared. If
+	// n is zero, the checkpoint is deleted, such that the stream is handled from
+	// the beginning.
+	StoreCheckpointOffset(
+		ctx context.Context,
+		tx *sql.Tx,
+		h, s []byte,
+		n uint64,
+	) error
+
 	// UpdateCheckpointOffset updates the checkpoint offset for a specific
 	// handler and event stream from c to n.
 	//
+	// t is the time at which the last event applied from the stream was
+	// recorded. The time at which the checkpoint was updated is recorded
+	// automatically.
+	//
 	// It returns false if c is not the current checkpoint offset.
 	UpdateCheckpointOffset(
 		ctx context.Context,
 		tx *sql.Tx,
 		h, s []byte,
 		c, n uint64,
+		t time.Time,
 	) (bool, error)
 
+	// IsRetryableError returns true if err indicates a transient failure, such
+	// that the transaction in which it occurred may succeed if retried from
+	// the beginning.
+	IsRetryableError(err error) bool
+
+	// Dialect returns helpers for writing SQL that is compatible with the
+	// driver's database.
+	Dialect() Dialect
+
 	// DeleteCheckpointOffsets deletes all checkpoint offsets for a specific
 	// handler.
 	DeleteCheckpointOffsets(
@@ -40,3 +128,17 @@ type Driver interface {
 		h []byte,
 	) error
 }
+
+// txBeginner is an optional interface implemented by drivers that control how
+// the adaptor begins its transactions.
+type txBeginner interface {
+	// BeginTx begins a transaction on db using the given options.
+	//
+	// The returned function must be called exactly once, after the transaction
+	// has been committed or rolled back.
+	BeginTx(
+		ctx context.Context,
+		db *sql.DB,
+		opts *sql.TxOptions,
+	) (*sql.Tx, func(), error)
+}
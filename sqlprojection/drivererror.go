@@ -0,0 +1,47 @@
+package sqlprojection
+
+import "reflect"
+
+// driverErrorType identifies an error type declared by a Go SQL driver.
+//
+// Error types are identified by name, rather than by importing the driver's
+// package, which would register the driver with database/sql for every user of
+// this package.
+type driverErrorType struct {
+	PkgPath string
+	Name    string
+}
+
+// findDriverError returns the first error in err's tree that is of one of the
+// given types, or a pointer to one of them.
+//
+// The returned value is the error itself, not a pointer to it.
+func findDriverError(err error, types ...driverErrorType) (reflect.Value, bool) {
+	if err == nil {
+		return reflect.Value{}, false
+	}
+
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	for _, t := range types {
+		if v.Type().PkgPath() == t.PkgPath && v.Type().Name() == t.Name {
+			return v, true
+		}
+	}
+
+	switch x := err.(type) {
+	case interface{ Unwrap() error }:
+		return findDriverError(x.Unwrap(), types...)
+	case interface{ Unwrap() []error }:
+		for _, err := range x.Unwrap() {
+			if v, ok := findDriverError(err, types...); ok {
+				return v, true
+			}
+		}
+	}
+
+	return reflect.Value{}, false
+}
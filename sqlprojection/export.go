@@ -0,0 +1,101 @@
+package sqlprojection
+
+import (
+	"context"
+	"database/sql"
+	"io"
+
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
+)
+
+// exportPageSize is the number of checkpoints that are read at once when
+// exporting checkpoints.
+const exportPageSize = 1000
+
+// ExportCheckpoints writes the checkpoint offsets of all handlers stored in db
+// by d to w, in the format written by [projectionkit.CheckpointEncoder].
+//
+// The checkpoints are not read within a single transaction, so they should
+// not be exported while the affected handlers are running.
+func ExportCheckpoints(ctx context.Context, db *sql.DB, d Driver, w io.Writer) error {
+	enc := projectionkit.NewCheckpointEncoder(w)
+
+	handlers, err := d.QueryHandlers(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range handlers {
+		key, err := uuidpb.FromBytes(h)
+		if err != nil {
+			return err
+		}
+
+		var after []byte
+
+		for {
+			page, err := d.QueryCheckpoints(ctx, db, h, after, exportPageSize)
+			if err != nil {
+				return err
+			}
+
+			for _, cp := range page {
+				if err := enc.Encode(projectionkit.ExportedCheckpoint{
+					HandlerKey: key.AsString(),
+					StreamID:   cp.StreamID,
+					Offset:     cp.Offset,
+				}); err != nil {
+					return err
+				}
+			}
+
+			if len(page) < exportPageSize {
+				break
+			}
+
+			after = uuidpb.MustParseAsBytes(page[len(page)-1].StreamID)
+		}
+	}
+
+	return nil
+}
+
+// ImportCheckpoints reads checkpoint offsets from r, in the format written by
+// [projectionkit.CheckpointEncoder], and stores them in db using d, replacing
+// any existing checkpoint offsets for the same handlers and streams.
+//
+// The checkpoints are imported within a single transaction. Checkpoints with
+// an offset of zero are deleted. Checkpoints that are not present in r are left
+// unchanged. It must not be used while the affected handlers are running.
+func ImportCheckpoints(ctx context.Context, db *sql.DB, d Driver, r io.Reader) error {
+	dec := projectionkit.NewCheckpointDecoder(r)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	for {
+		cp, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := d.StoreCheckpointOffset(
+			ctx,
+			tx,
+			uuidpb.MustParseAsBytes(cp.HandlerKey),
+			uuidpb.MustParseAsBytes(cp.StreamID),
+			cp.Offset,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
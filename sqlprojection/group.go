@@ -0,0 +1,589 @@
+package sqlprojection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/dogmatiq/dogma"
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit"
+)
+
+// NewGroup returns a new [dogma.ProjectionMessageHandler] that binds several
+// SQL-specific [MessageHandler] implementations to an SQL database, such that
+// they behave as a single projection with the given identity.
+//
+// Each event is applied to all of the handlers that consume its type within a
+// single transaction, so the projections' tables are always consistent with
+// each other. The handlers must have distinct identities, and each handler's
+// checkpoint offsets are stored separately under its own identity key.
+//
+// The group's checkpoint offset for each stream is the lowest offset of any of
+// its handlers. If a handler is added to an existing group, the engine
+// re-delivers events from the start of the stream, which are applied only to
+// the handlers that have not already applied them.
+//
+// Handlers that call [dogma.ProjectionConfigurer.Disable] are excluded from the
+// group. If all of the handlers are disabled, the group itself is disabled.
+//
+// It panics if the options include [WithBatching], which is not supported.
+func NewGroup(
+	db *sql.DB,
+	d Driver,
+	name, key string,
+	handlers []MessageHandler,
+	options ...Option,
+) dogma.ProjectionMessageHandler {
+	if len(handlers) == 0 {
+		panic("group must contain at least one handler")
+	}
+
+	a := &adaptor{
+		DB:     db,
+		Driver: d,
+		Retry:  defaultRetryPolicy,
+	}
+
+	for _, opt := range options {
+		opt(a)
+	}
+
+	if a.MaxBatchSize != 0 {
+		panic("batching is not supported by groups")
+	}
+
+	g := &group{
+		adaptor: a,
+		name:    name,
+		key:     key,
+	}
+
+	keys := map[[16]byte]struct{}{}
+	var disabled []groupMember
+
+	for _, h := range handlers {
+		m := newGroupMember(h)
+
+		if _, ok := keys[m.Key]; ok {
+			panic(fmt.Sprintf(
+				"group contains multiple handlers with the same identity key (%s)",
+				uuidpb.FromByteArray(m.Key).AsString(),
+			))
+		}
+		keys[m.Key] = struct{}{}
+
+		if m.Disabled {
+			disabled = append(disabled, m)
+		} else {
+			g.members = append(g.members, m)
+		}
+	}
+
+	if len(g.members) == 0 {
+		// The group retains the routes of its disabled members so that its
+		// configuration remains valid.
+		g.disabled = true
+		g.routes = mergeRoutes(disabled)
+	} else {
+		g.routes = mergeRoutes(g.members)
+	}
+
+	return g
+}
+
+// mergeRoutes returns the routes of a group that consists of the given members.
+//
+// The group consumes each event type that is consumed by any of its members,
+// but each type may only be routed once.
+func mergeRoutes(members []groupMember) []dogma.ProjectionRoute {
+	var routes []dogma.ProjectionRoute
+	types := map[reflect.Type]struct{}{}
+
+	for _, m := range members {
+		for _, r := range m.Routes {
+			if r, ok := r.(dogma.HandlesEventRoute); ok {
+				t := r.Type().GoType()
+				if _, ok := types[t]; ok {
+					continue
+				}
+				types[t] = struct{}{}
+			}
+
+			routes = append(routes, r)
+		}
+	}
+
+	return routes
+}
+
+// group adapts several sqlprojection.ProjectionMessageHandler values to the
+// [dogma.ProjectionMessageHandler] interface.
+type group struct {
+	// adaptor holds the configuration shared by all members of the group. Its
+	// Handler is nil.
+	adaptor *adaptor
+
+	name, key string
+	routes    []dogma.ProjectionRoute
+	disabled  bool
+
+	// members is the list of members that are enabled.
+	members []groupMember
+}
+
+// groupMember is a [MessageHandler] within a group.
+type groupMember struct {
+	Key     [16]byte
+	Handler MessageHandler
+	Routes  []dogma.ProjectionRoute
+
+	// Types is the set of event types that the handler consumes.
+	Types map[reflect.Type]struct{}
+
+	// Disabled is true if the handler is disabled by its configuration.
+	Disabled bool
+}
+
+// newGroupMember returns a groupMember for h.
+func newGroupMember(h MessageHandler) groupMember {
+	checkTableOwner(h)
+
+	var c groupMemberConfigurer
+	h.Configure(&c)
+
+	m := groupMember{
+		Key:      uuidpb.MustParseAsByteArray(c.key),
+		Handler:  h,
+		Routes:   c.routes,
+		Types:    map[reflect.Type]struct{}{},
+		Disabled: c.disabled,
+	}
+
+	for _, r := range c.routes {
+		if r, ok := r.(dogma.HandlesEventRoute); ok {
+			m.Types[r.Type().GoType()] = struct{}{}
+		}
+	}
+
+	return m
+}
+
+// Handles returns true if the member consumes events of the same type as e.
+func (m groupMember) Handles(e dogma.Event) bool {
+	_, ok := m.Types[reflect.TypeOf(e)]
+	return ok
+}
+
+func (g *group) Configure(c dogma.ProjectionConfigurer) {
+	c.Identity(g.name, g.key)
+	c.Routes(g.routes...)
+
+	if g.disabled {
+		c.Disable()
+	}
+}
+
+func (g *group) HandleEvent(
+	ctx context.Context,
+	s dogma.ProjectionEventScope,
+	m dogma.Event,
+) (uint64, error) {
+	var complete bool
+
+	// The entire transaction is retried if it fails with a transient error,
+	// such as a serialization failure.
+	if err := g.adaptor.Retry.Do(ctx, g.adaptor.Driver, func(ctx context.Context) (err error) {
+		complete, err = g.handleEvent(ctx, s, m)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	if complete {
+		return s.Offset() + 1, nil
+	}
+
+	return g.CheckpointOffset(ctx, s.StreamID())
+}
+
+// handleEvent handles an event within a new transaction.
+//
+// It returns true if the event was applied to every member of the group. If the
+// engine's checkpoint offset is stale for some members, the event is applied
+// to the others, which are behind. If it's stale for all members, nothing is
+// applied.
+func (g *group) handleEvent(
+	ctx context.Context,
+	s dogma.ProjectionEventScope,
+	m dogma.Event,
+) (bool, error) {
+	tx, release, err := g.adaptor.beginTx(ctx, g.adaptor.txOptions(m))
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	defer tx.Rollback() // nolint:errcheck
+
+	streamID := uuidpb.MustParseAsBytes(s.StreamID())
+	applied := 0
+
+	for _, mem := range g.members {
+		// The checkpoint offset of every member is updated, regardless of
+		// whether it consumes this type of event, so that the members remain
+		// in lock-step.
+		ok, err := g.adaptor.Driver.UpdateCheckpointOffset(
+			ctx,
+			tx,
+			mem.Key[:],
+			streamID,
+			s.CheckpointOffset(),
+			s.Offset()+1,
+			s.RecordedAt(),
+		)
+		if err != nil {
+			return false, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		applied++
+
+		if mem.Handles(m) {
+			if err := mem.Handler.HandleEvent(ctx, tx, s, m); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if applied == 0 {
+		return false, nil
+	}
+
+	return applied == len(g.members), tx.Commit()
+}
+
+func (g *group) CheckpointOffset(ctx context.Context, id string) (uint64, error) {
+	cp, err := g.ReadCheckpoint(ctx, id)
+	return cp.Offset, err
+}
+
+// ReadCheckpoint returns the group's checkpoint for the given stream.
+//
+// Its offset is the lowest offset of any member of the group, and its times
+// are the earliest times of any member, such that it describes the progress of
+// the member that is furthest behind.
+func (g *group) ReadCheckpoint(ctx context.Context, id string) (projectionkit.Checkpoint, error) {
+	streamID := uuidpb.MustParseAsBytes(id)
+
+	var lowest projectionkit.Checkpoint
+
+	for i, mem := range g.members {
+		cp, err := g.adaptor.Driver.QueryCheckpoint(
+			ctx,
+			g.adaptor.DB,
+			mem.Key[:],
+			streamID,
+		)
+		if err != nil {
+			return projectionkit.Checkpoint{}, err
+		}
+
+		if i == 0 {
+			lowest = cp
+			continue
+		}
+
+		lowest.Offset = min(lowest.Offset, cp.Offset)
+		lowest.UpdatedAt = earliest(lowest.UpdatedAt, cp.UpdatedAt)
+		lowest.EventRecordedAt = earliest(lowest.EventRecordedAt, cp.EventRecordedAt)
+	}
+
+	return lowest, nil
+}
+
+// earliest returns the earlier of a and b, ignoring zero values.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// groupCheckpointQuerier is an optional interface implemented by drivers that
+// can query the checkpoints of a group in a single round-trip.
+type groupCheckpointQuerier interface {
+	// QueryGroupCheckpoints returns up to limit checkpoints, ordered by stream
+	// ID, for the streams for which every one of the given handlers has a
+	// non-zero checkpoint offset, as per [group.ReadCheckpoint].
+	//
+	// If after is non-nil, only checkpoints for streams with IDs that sort
+	// after it are returned.
+	QueryGroupCheckpoints(
+		ctx context.Context,
+		db *sql.DB,
+		handlers [][]byte,
+		after []byte,
+		limit int,
+	) ([]projectionkit.Checkpoint, error)
+
+	// CountGroupCheckpoints returns the number of streams for which every one
+	// of the given handlers has a non-zero checkpoint offset.
+	CountGroupCheckpoints(
+		ctx context.Context,
+		db *sql.DB,
+		handlers [][]byte,
+	) (uint64, error)
+}
+
+// parameterList returns a comma-separated list of the expressions returned by
+// p for parameters 1 to n, for use within an IN clause.
+func parameterList(n int, p func(n int) string) string {
+	var w strings.Builder
+
+	for i := range n {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteString(p(i + 1))
+	}
+
+	return w.String()
+}
+
+// memberKeys returns the identity keys of the group's members.
+func (g *group) memberKeys() [][]byte {
+	keys := make([][]byte, len(g.members))
+	for i, mem := range g.members {
+		keys[i] = mem.Key[:]
+	}
+	return keys
+}
+
+// ListCheckpoints returns the checkpoints of the streams for which every member
+// of the group has a checkpoint, as per [group.ReadCheckpoint].
+//
+// It panics if limit is not positive, as per
+// [projectionkit.CheckpointLister].
+func (g *group) ListCheckpoints(
+	ctx context.Context,
+	after string,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	if limit <= 0 {
+		panic("limit must be positive")
+	}
+
+	if len(g.members) == 0 {
+		return nil, nil
+	}
+
+	if q, ok := g.adaptor.Driver.(groupCheckpointQuerier); ok {
+		var streamID []byte
+		if after != "" {
+			streamID = uuidpb.MustParseAsBytes(after)
+		}
+
+		return q.QueryGroupCheckpoints(
+			ctx,
+			g.adaptor.DB,
+			g.memberKeys(),
+			streamID,
+			limit,
+		)
+	}
+
+	return g.listCheckpoints(ctx, after, limit)
+}
+
+// listCheckpoints returns the checkpoints of the streams for which every member
+// of the group has a checkpoint, using a driver that does not implement
+// [groupCheckpointQuerier].
+//
+// The checkpoints of the first member are listed, and the checkpoints of the
+// other members are queried for each stream in turn.
+func (g *group) listCheckpoints(
+	ctx context.Context,
+	after string,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	first := g.members[0].Key
+	var checkpoints []projectionkit.Checkpoint
+
+	for {
+		var streamID []byte
+		if after != "" {
+			streamID = uuidpb.MustParseAsBytes(after)
+		}
+
+		page, err := g.adaptor.Driver.QueryCheckpoints(
+			ctx,
+			g.adaptor.DB,
+			first[:],
+			streamID,
+			limit,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range page {
+			cp, err := g.ReadCheckpoint(ctx, c.StreamID)
+			if err != nil {
+				return nil, err
+			}
+
+			// A member that has no checkpoint for the stream has not applied
+			// any of its events, so neither has the group.
+			if cp.Offset == 0 {
+				continue
+			}
+
+			checkpoints = append(checkpoints, cp)
+
+			if len(checkpoints) == limit {
+				return checkpoints, nil
+			}
+		}
+
+		if len(page) < limit {
+			return checkpoints, nil
+		}
+
+		after = page[len(page)-1].StreamID
+	}
+}
+
+// CountCheckpoints returns the number of streams for which every member of the
+// group has a checkpoint.
+func (g *group) CountCheckpoints(ctx context.Context) (uint64, error) {
+	if len(g.members) == 0 {
+		return 0, nil
+	}
+
+	if q, ok := g.adaptor.Driver.(groupCheckpointQuerier); ok {
+		return q.CountGroupCheckpoints(ctx, g.adaptor.DB, g.memberKeys())
+	}
+
+	const pageSize = 1000
+
+	var (
+		count uint64
+		after string
+	)
+
+	for {
+		page, err := g.listCheckpoints(ctx, after, pageSize)
+		if err != nil {
+			return 0, err
+		}
+
+		count += uint64(len(page))
+
+		if len(page) < pageSize {
+			return count, nil
+		}
+
+		after = page[len(page)-1].StreamID
+	}
+}
+
+// Compact compacts each member of the group in turn.
+//
+// A failure to compact one member does not prevent the others from being
+// compacted.
+func (g *group) Compact(ctx context.Context, s dogma.ProjectionCompactScope) error {
+	var errs []error
+
+	for _, mem := range g.members {
+		if err := mem.Handler.Compact(ctx, g.adaptor.DB, s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Reset resets every member of the group within a single transaction.
+//
+// If any member does not support being reset, none of them are reset.
+func (g *group) Reset(ctx context.Context, s dogma.ProjectionResetScope) error {
+	return g.adaptor.Retry.Do(ctx, g.adaptor.Driver, func(ctx context.Context) error {
+		return g.reset(ctx, s)
+	})
+}
+
+// reset resets the group within a new transaction.
+func (g *group) reset(ctx context.Context, s dogma.ProjectionResetScope) error {
+	tx, release, err := g.adaptor.beginTx(ctx, g.adaptor.TxOptions)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer tx.Rollback() // nolint:errcheck
+
+	var truncations []func(context.Context) error
+
+	for _, mem := range g.members {
+		truncate, err := resetData(
+			ctx,
+			g.adaptor.DB,
+			g.adaptor.Driver,
+			tx,
+			mem.Handler,
+			s,
+		)
+		if err != nil {
+			return err
+		}
+
+		if truncate != nil {
+			truncations = append(truncations, truncate)
+		}
+	}
+
+	for _, mem := range g.members {
+		if err := g.adaptor.Driver.DeleteCheckpointOffsets(
+			ctx,
+			tx,
+			mem.Key[:],
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Tables that can not be truncated within the transaction are truncated
+	// once the checkpoint offsets have been deleted.
+	for _, truncate := range truncations {
+		if err := truncate(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// groupMemberConfigurer is a [dogma.ProjectionConfigurer] that captures the
+// identity key, routes and disabled state of a group member.
+type groupMemberConfigurer struct {
+	key      string
+	routes   []dogma.ProjectionRoute
+	disabled bool
+}
+
+func (c *groupMemberConfigurer) Identity(_ string, key string) { c.key = key }
+func (c *groupMemberConfigurer) Routes(r ...dogma.ProjectionRoute) {
+	c.routes = append(c.routes, r...)
+}
+func (c *groupMemberConfigurer) Disable(...dogma.DisableOption)                    { c.disabled = true }
+func (c *groupMemberConfigurer) ConcurrencyPreference(dogma.ConcurrencyPreference) {}
@@ -32,7 +32,8 @@ type MessageHandler interface {
 	// access patterns.
 	//
 	// The implementation should perform compaction incrementally to make some
-	// progress even if ctx reaches its deadline.
+	// progress even if ctx reaches its deadline. Use [CompactInChunks] to
+	// execute a statement in bounded chunks, each in its own transaction.
 	//
 	// The engine may call this method at any time, including in parallel with
 	// handling an event.
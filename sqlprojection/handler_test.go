@@ -1,6 +1,8 @@
 package sqlprojection_test
 
 import (
+	"context"
+	"database/sql"
 	"testing"
 
 	"github.com/dogmatiq/dogma"
@@ -31,3 +33,35 @@ func TestNoResetBehavior(t *testing.T) {
 		t.Fatalf("unexpected error: got %v, want %v", err, dogma.ErrNotSupported)
 	}
 }
+
+func TestNoResetBehavior_withTableOwner(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+
+	New(nil, SQLiteDriver, &noResetTableOwner{})
+}
+
+// noResetTableOwner is a [MessageHandler] that implements [TableOwner] but
+// embeds [NoResetBehavior].
+type noResetTableOwner struct {
+	NoCompactBehavior
+	NoResetBehavior
+}
+
+func (*noResetTableOwner) Configure(dogma.ProjectionConfigurer) {}
+
+func (*noResetTableOwner) HandleEvent(
+	context.Context,
+	*sql.Tx,
+	dogma.ProjectionEventScope,
+	dogma.Event,
+) error {
+	return nil
+}
+
+func (*noResetTableOwner) Tables() []string {
+	return []string{"projection_data"}
+}
@@ -51,3 +51,19 @@ func (h *MessageHandler) Reset(ctx context.Context, tx *sql.Tx, s dogma.Projecti
 	}
 	return nil
 }
+
+// TableOwner is a test implementation of sql.MessageHandler that also
+// implements sql.TableOwner.
+type TableOwner struct {
+	MessageHandler
+
+	TablesFunc func() []string
+}
+
+// Tables returns the names of the tables that contain the projection's data.
+func (h *TableOwner) Tables() []string {
+	if h.TablesFunc != nil {
+		return h.TablesFunc()
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package sqlprojection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migration is a single change to a driver's schema.
+//
+// A driver's migrations are applied in order. The schema version is the number
+// of migrations that have been applied.
+//
+// Migrations should be idempotent, as some databases implicitly commit schema
+// changes, in which case a failure may leave a migration partially applied.
+type migration func(ctx context.Context, x execer) error
+
+// execer is the subset of the [sql.Tx] and [sql.Conn] interfaces used to
+// apply migrations.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// versionTable describes the queries used to manipulate the table that records
+// which migrations have been applied.
+type versionTable struct {
+	// Exists is a query that returns a single boolean (or integer) indicating
+	// whether the version table exists. It's executed with ExistsArgs as its
+	// parameters.
+	Exists     string
+	ExistsArgs []any
+
+	// Create is a statement that creates the version table if it does not
+	// already exist.
+	Create string
+
+	// Select is a query that returns the current schema version, or zero if no
+	// migrations have been applied.
+	Select string
+
+	// Insert is a statement that records that the migration with the version
+	// given by the first parameter has been applied.
+	Insert string
+}
+
+// migrate applies the migrations in m that have not already been applied.
+func migrate(
+	ctx context.Context,
+	x execer,
+	v versionTable,
+	m []migration,
+) error {
+	if _, err := x.ExecContext(ctx, v.Create); err != nil {
+		return err
+	}
+
+	current, err := queryVersion(ctx, x, v)
+	if err != nil {
+		return err
+	}
+
+	if current > len(m) {
+		return fmt.Errorf(
+			"schema version %d is newer than the latest version supported by this driver (%d)",
+			current,
+			len(m),
+		)
+	}
+
+	for version := current + 1; version <= len(m); version++ {
+		if err := m[version-1](ctx, x); err != nil {
+			return fmt.Errorf("unable to apply schema migration %d: %w", version, err)
+		}
+
+		if _, err := x.ExecContext(ctx, v.Insert, version); err != nil {
+			return fmt.Errorf("unable to record schema migration %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// schemaVersion returns the current schema version, or zero if the version
+// table does not exist.
+func schemaVersion(
+	ctx context.Context,
+	x execer,
+	v versionTable,
+) (int, error) {
+	var exists bool
+	if err := x.QueryRowContext(ctx, v.Exists, v.ExistsArgs...).Scan(&exists); err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return 0, nil
+	}
+
+	return queryVersion(ctx, x, v)
+}
+
+// queryVersion returns the current schema version, which is the highest version
+// recorded in the version table.
+func queryVersion(
+	ctx context.Context,
+	x execer,
+	v versionTable,
+) (int, error) {
+	var version int
+	err := x.QueryRowContext(ctx, v.Select).Scan(&version)
+	return version, err
+}
+
+// exec returns a [migration] that executes a single statement.
+func exec(query string) migration {
+	return func(ctx context.Context, x execer) error {
+		_, err := x.ExecContext(ctx, query)
+		return err
+	}
+}
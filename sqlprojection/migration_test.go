@@ -0,0 +1,113 @@
+package sqlprojection_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/dogmatiq/dogma"
+	. "github.com/dogmatiq/enginekit/enginetest/stubs"
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit/projectiontest"
+	. "github.com/dogmatiq/projectionkit/sqlprojection"
+	"github.com/dogmatiq/projectionkit/sqlprojection/internal/fixtures"
+)
+
+// testBaselineMigration tests that d migrates a database that contains the
+// schema created by the original, unversioned release of the driver.
+//
+// baseline is the list of statements that create the original schema, and
+// insert is a statement that inserts a checkpoint into the original schema. It
+// is executed with the handler key, stream ID and offset as its parameters.
+func testBaselineMigration(
+	t *testing.T,
+	driverName, dsn string,
+	d Driver,
+	baseline []string,
+	insert string,
+) {
+	t.Run("it migrates the schema created before schema versioning was introduced", func(t *testing.T) {
+		db, err := sql.Open(driverName, dsn)
+		if err != nil {
+			t.Fatalf("cannot open test database: %s", err)
+		}
+		defer db.Close()
+
+		if err := d.DropSchema(t.Context(), db); err != nil {
+			t.Fatalf("cannot drop schema: %s", err)
+		}
+
+		defer d.DropSchema(context.Background(), db) // nolint:errcheck
+
+		for _, q := range baseline {
+			if _, err := db.ExecContext(t.Context(), q); err != nil {
+				t.Fatalf("cannot create baseline schema: %s", err)
+			}
+		}
+
+		handlerKey := uuidpb.MustParseAsBytes(projectiontest.IdentityKey)
+		streamID := (&ProjectionEventScopeStub{}).StreamID()
+
+		if _, err := db.ExecContext(
+			t.Context(),
+			insert,
+			handlerKey,
+			uuidpb.MustParseAsBytes(streamID),
+			10,
+		); err != nil {
+			t.Fatalf("cannot insert checkpoint into baseline schema: %s", err)
+		}
+
+		if v, err := d.SchemaVersion(t.Context(), db); err != nil {
+			t.Fatal(err)
+		} else if v != 0 {
+			t.Fatalf("unexpected schema version before migration: got %d, want 0", v)
+		}
+
+		if err := d.MigrateSchema(t.Context(), db); err != nil {
+			t.Fatalf("cannot migrate schema: %s", err)
+		}
+
+		if v, err := d.SchemaVersion(t.Context(), db); err != nil {
+			t.Fatal(err)
+		} else if v == 0 {
+			t.Fatal("expected the schema version to be recorded")
+		}
+
+		adaptor := New(
+			db,
+			d,
+			&fixtures.MessageHandler{
+				ConfigureFunc: func(c dogma.ProjectionConfigurer) {
+					c.Identity("<projection>", projectiontest.IdentityKey)
+				},
+			},
+		)
+
+		cp, err := adaptor.CheckpointOffset(t.Context(), streamID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cp != 10 {
+			t.Fatalf("unexpected checkpoint offset after migration: got %d, want 10", cp)
+		}
+
+		// Handling an event writes to the columns added by the migrations.
+		cp, err = adaptor.HandleEvent(
+			t.Context(),
+			&ProjectionEventScopeStub{
+				OffsetFunc:           func() uint64 { return 10 },
+				CheckpointOffsetFunc: func() uint64 { return 10 },
+			},
+			EventA1,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cp != 11 {
+			t.Fatalf("unexpected checkpoint offset: got %d, want 11", cp)
+		}
+	})
+}
@@ -0,0 +1,646 @@
+package sqlprojection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dogmatiq/projectionkit"
+)
+
+// MSSQLDriver is a Driver for Microsoft SQL Server.
+//
+// This driver should work with any underlying Go SQL driver that supports SQL
+// Server compatible databases and @p1-style placeholders, such as the
+// "sqlserver" driver provided by github.com/microsoft/go-mssqldb.
+//
+// It stores checkpoint offsets in the "projection_checkpoint" table within the
+// user's default schema. Use [NewMSSQLDriver] to use a different name.
+var MSSQLDriver Driver = NewMSSQLDriver()
+
+// NewMSSQLDriver returns a new Driver for Microsoft SQL Server.
+//
+// This driver should work with any underlying Go SQL driver that supports SQL
+// Server compatible databases and @p1-style placeholders.
+func NewMSSQLDriver(options ...MSSQLOption) Driver {
+	d := &mssqlDriver{
+		table: "projection_checkpoint",
+	}
+
+	for _, opt := range options {
+		opt(d)
+	}
+
+	d.checkpointTable = quoteMSSQLIdentifier(d.table)
+	d.lockName = "projectionkit:" + d.table
+
+	versions := quoteMSSQLIdentifier(d.table + "_version")
+	d.versions = versionTable{
+		Exists:     `SELECT CAST(CASE WHEN OBJECT_ID(@p1, N'U') IS NULL THEN 0 ELSE 1 END AS BIT)`,
+		ExistsArgs: []any{versions},
+		Create: `IF OBJECT_ID(` + quoteMSSQLString(versions) + `, N'U') IS NULL
+			CREATE TABLE ` + versions + ` (
+				version INTEGER NOT NULL PRIMARY KEY
+			)`,
+		Select: `SELECT COALESCE(MAX(version), 0) FROM ` + versions,
+		Insert: `INSERT INTO ` + versions + ` (version) VALUES (@p1)`,
+	}
+
+	return d
+}
+
+// MSSQLOption is a functional option that changes the behavior of
+// [NewMSSQLDriver].
+type MSSQLOption func(*mssqlDriver)
+
+// WithMSSQLTable is a [MSSQLOption] that sets the name of the table used to
+// store checkpoint offsets.
+func WithMSSQLTable(name string) MSSQLOption {
+	if name == "" {
+		panic("table name must not be empty")
+	}
+
+	return func(d *mssqlDriver) {
+		d.table = name
+	}
+}
+
+type mssqlDriver struct {
+	table string
+
+	// checkpointTable is the quoted name of the checkpoint table.
+	checkpointTable string
+
+	// lockName is the name of the application lock used to serialize schema
+	// migrations.
+	lockName string
+
+	// versions describes the table that records the applied migrations.
+	versions versionTable
+}
+
+func (d *mssqlDriver) CreateSchema(ctx context.Context, db *sql.DB) error {
+	return d.MigrateSchema(ctx, db)
+}
+
+func (d *mssqlDriver) MigrateSchema(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	// Acquire a transaction-scoped application lock to prevent concurrent
+	// migrations of the same tables, which would otherwise race to create the
+	// schema elements. sp_getapplock returns a negative value on failure.
+	var status int
+	if err := tx.QueryRowContext(
+		ctx,
+		`DECLARE @status INTEGER;
+		EXEC @status = sp_getapplock
+			@Resource = @p1,
+			@LockMode = 'Exclusive',
+			@LockOwner = 'Transaction',
+			@LockTimeout = @p2;
+		SELECT @status`,
+		d.lockName,
+		mssqlLockTimeout.Milliseconds(),
+	).Scan(&status); err != nil {
+		return err
+	}
+
+	if status < 0 {
+		return fmt.Errorf(
+			"unable to acquire the schema migration lock within %s (status %d)",
+			mssqlLockTimeout,
+			status,
+		)
+	}
+
+	if err := migrate(ctx, tx, d.versions, d.migrations()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *mssqlDriver) SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	return schemaVersion(ctx, db, d.versions)
+}
+
+// migrations returns the migrations that produce the latest version of the
+// driver's schema.
+func (d *mssqlDriver) migrations() []migration {
+	return []migration{
+		// The timestamps are stored as the number of nanoseconds since the Unix
+		// epoch, as SQL Server's DATETIMEOFFSET type is limited to a precision
+		// of 100 nanoseconds.
+		exec(
+			`IF OBJECT_ID(` + quoteMSSQLString(d.checkpointTable) + `, N'U') IS NULL
+			CREATE TABLE ` + d.checkpointTable + ` (
+				handler           BINARY(16) NOT NULL,
+				stream            BINARY(16) NOT NULL,
+				checkpoint_offset BIGINT NOT NULL,
+				updated_at        BIGINT NULL,
+				event_recorded_at BIGINT NULL,
+
+				PRIMARY KEY (handler, stream)
+			)`,
+		),
+	}
+}
+
+// mssqlLockTimeout is the maximum amount of time to wait to acquire the
+// application lock used to serialize schema migrations.
+const mssqlLockTimeout = 1 * time.Minute
+
+func (d *mssqlDriver) DropSchema(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(
+		ctx,
+		`DROP TABLE IF EXISTS `+d.checkpointTable+`, `+quoteMSSQLIdentifier(d.table+"_version"),
+	)
+	return err
+}
+
+func (d *mssqlDriver) QueryCheckpointOffset(
+	ctx context.Context,
+	db *sql.DB,
+	h, s []byte,
+) (uint64, error) {
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT checkpoint_offset
+		FROM `+d.checkpointTable+`
+		WHERE handler = @p1
+		AND stream = @p2`,
+		h,
+		s,
+	)
+
+	var cp uint64
+	err := row.Scan(&cp)
+
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return cp, err
+}
+
+func (d *mssqlDriver) QueryCheckpoint(
+	ctx context.Context,
+	db *sql.DB,
+	h, s []byte,
+) (projectionkit.Checkpoint, error) {
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		FROM `+d.checkpointTable+`
+		WHERE handler = @p1
+		AND stream = @p2`,
+		h,
+		s,
+	)
+
+	cp := projectionkit.Checkpoint{
+		StreamID: streamIDString(s),
+	}
+
+	var updatedAt, recordedAt sql.NullInt64
+	err := row.Scan(&cp.Offset, &updatedAt, &recordedAt)
+
+	if err == sql.ErrNoRows {
+		return cp, nil
+	}
+
+	cp.UpdatedAt = fromNullUnixNano(updatedAt)
+	cp.EventRecordedAt = fromNullUnixNano(recordedAt)
+
+	return cp, err
+}
+
+func (d *mssqlDriver) QueryCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	h, after []byte,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	args := []any{h}
+	filter := ``
+
+	if after != nil {
+		args = append(args, after)
+		filter = ` AND stream > @p2`
+	}
+
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(
+		ctx,
+		`SELECT TOP (@p`+strconv.Itoa(len(args))+`)
+			stream,
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		FROM `+d.checkpointTable+`
+		WHERE handler = @p1`+filter+`
+		ORDER BY stream`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []projectionkit.Checkpoint
+
+	for rows.Next() {
+		var (
+			cp                    projectionkit.Checkpoint
+			stream                []byte
+			updatedAt, recordedAt sql.NullInt64
+		)
+
+		if err := rows.Scan(
+			&stream,
+			&cp.Offset,
+			&updatedAt,
+			&recordedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		cp.StreamID = streamIDString(stream)
+		cp.UpdatedAt = fromNullUnixNano(updatedAt)
+		cp.EventRecordedAt = fromNullUnixNano(recordedAt)
+		checkpoints = append(checkpoints, cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+func (d *mssqlDriver) CountCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	h []byte,
+) (uint64, error) {
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT COUNT_BIG(*)
+		FROM `+d.checkpointTable+`
+		WHERE handler = @p1`,
+		h,
+	)
+
+	var n uint64
+	err := row.Scan(&n)
+	return n, err
+}
+
+func (d *mssqlDriver) QueryGroupCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	handlers [][]byte,
+	after []byte,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	args := make([]any, 0, len(handlers)+3)
+	for _, h := range handlers {
+		args = append(args, h)
+	}
+
+	filter := ``
+	if after != nil {
+		args = append(args, after)
+		filter = ` AND stream > @p` + strconv.Itoa(len(args))
+	}
+
+	args = append(args, len(handlers), limit)
+
+	rows, err := db.QueryContext(
+		ctx,
+		`SELECT TOP (@p`+strconv.Itoa(len(args))+`)
+			stream,
+			MIN(checkpoint_offset),
+			MIN(updated_at),
+			MIN(event_recorded_at)
+		FROM `+d.checkpointTable+`
+		WHERE handler IN (`+parameterList(len(handlers), mssqlParameter)+`)
+		AND checkpoint_offset <> 0`+filter+`
+		GROUP BY stream
+		HAVING COUNT(*) = @p`+strconv.Itoa(len(args)-1)+`
+		ORDER BY stream`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []projectionkit.Checkpoint
+
+	for rows.Next() {
+		var (
+			cp                    projectionkit.Checkpoint
+			stream                []byte
+			updatedAt, recordedAt sql.NullInt64
+		)
+
+		if err := rows.Scan(
+			&stream,
+			&cp.Offset,
+			&updatedAt,
+			&recordedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		cp.StreamID = streamIDString(stream)
+		cp.UpdatedAt = fromNullUnixNano(updatedAt)
+		cp.EventRecordedAt = fromNullUnixNano(recordedAt)
+		checkpoints = append(checkpoints, cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+func (d *mssqlDriver) CountGroupCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	handlers [][]byte,
+) (uint64, error) {
+	args := make([]any, 0, len(handlers)+1)
+	for _, h := range handlers {
+		args = append(args, h)
+	}
+	args = append(args, len(handlers))
+
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT COUNT_BIG(*) FROM (
+			SELECT stream
+			FROM `+d.checkpointTable+`
+			WHERE handler IN (`+parameterList(len(handlers), mssqlParameter)+`)
+			AND checkpoint_offset <> 0
+			GROUP BY stream
+			HAVING COUNT(*) = @p`+strconv.Itoa(len(args))+`
+		) AS g`,
+		args...,
+	)
+
+	var n uint64
+	err := row.Scan(&n)
+	return n, err
+}
+
+// mssqlParameter returns the placeholder for the n'th parameter.
+func mssqlParameter(n int) string {
+	return "@p" + strconv.Itoa(n)
+}
+
+func (d *mssqlDriver) QueryHandlers(
+	ctx context.Context,
+	db *sql.DB,
+) ([][]byte, error) {
+	rows, err := db.QueryContext(
+		ctx,
+		`SELECT DISTINCT handler
+		FROM `+d.checkpointTable+`
+		ORDER BY handler`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var handlers [][]byte
+
+	for rows.Next() {
+		var h []byte
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, h)
+	}
+
+	return handlers, rows.Err()
+}
+
+func (d *mssqlDriver) StoreCheckpointOffset(
+	ctx context.Context,
+	tx *sql.Tx,
+	h, s []byte,
+	n uint64,
+) error {
+	if n == 0 {
+		// A stored offset of zero would prevent UpdateCheckpointOffset() from
+		// inserting the row when the stream's first event is handled.
+		_, err := tx.ExecContext(
+			ctx,
+			`DELETE FROM `+d.checkpointTable+`
+			WHERE handler = @p1
+			AND stream = @p2`,
+			h,
+			s,
+		)
+		return err
+	}
+
+	_, err := tx.ExecContext(
+		ctx,
+		`MERGE INTO `+d.checkpointTable+` WITH (HOLDLOCK) AS t
+		USING (SELECT @p1 AS handler, @p2 AS stream) AS s
+		ON t.handler = s.handler
+		AND t.stream = s.stream
+		WHEN MATCHED THEN UPDATE SET
+			checkpoint_offset = @p3,
+			updated_at = @p4,
+			event_recorded_at = NULL
+		WHEN NOT MATCHED THEN INSERT (
+			handler,
+			stream,
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		) VALUES (
+			s.handler,
+			s.stream,
+			@p3,
+			@p4,
+			NULL
+		);`,
+		h,
+		s,
+		n,
+		nullUnixNano(time.Now()),
+	)
+	return err
+}
+
+func (d *mssqlDriver) UpdateCheckpointOffset(
+	ctx context.Context,
+	tx *sql.Tx,
+	h, s []byte,
+	c, n uint64,
+	t time.Time,
+) (bool, error) {
+	now := time.Now()
+
+	var (
+		res sql.Result
+		err error
+	)
+
+	// If the "current" checkpoint offset is zero, we assumed it's correct and
+	// that there is no existing row for this handler/stream. The HOLDLOCK hint
+	// prevents a concurrent MERGE from inserting the same row between the
+	// match and the insert.
+	if c == 0 {
+		res, err = tx.ExecContext(
+			ctx,
+			`MERGE INTO `+d.checkpointTable+` WITH (HOLDLOCK) AS t
+			USING (SELECT @p1 AS handler, @p2 AS stream) AS s
+			ON t.handler = s.handler
+			AND t.stream = s.stream
+			WHEN NOT MATCHED THEN INSERT (
+				handler,
+				stream,
+				checkpoint_offset,
+				updated_at,
+				event_recorded_at
+			) VALUES (
+				s.handler,
+				s.stream,
+				@p3,
+				@p4,
+				@p5
+			);`,
+			h,
+			s,
+			n,
+			nullUnixNano(now),
+			nullUnixNano(t),
+		)
+	} else {
+		// Otherwise we simply update the existing row.
+		res, err = tx.ExecContext(
+			ctx,
+			`UPDATE `+d.checkpointTable+` SET
+				checkpoint_offset = @p1,
+				updated_at = @p2,
+				event_recorded_at = @p3
+			WHERE handler = @p4
+			AND stream = @p5
+			AND checkpoint_offset = @p6`,
+			n,
+			nullUnixNano(now),
+			nullUnixNano(t),
+			h,
+			s,
+			c,
+		)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	count, err := res.RowsAffected()
+	return count != 0, err
+}
+
+// DeleteCheckpointOffsets deletes all checkpoint offsets for a specific
+// handler.
+func (d *mssqlDriver) DeleteCheckpointOffsets(
+	ctx context.Context,
+	tx *sql.Tx,
+	h []byte,
+) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM `+d.checkpointTable+`
+		WHERE handler = @p1`,
+		h,
+	)
+	return err
+}
+
+// TruncateTables removes all rows from the given tables within tx.
+func (d *mssqlDriver) TruncateTables(
+	ctx context.Context,
+	tx *sql.Tx,
+	tables []string,
+) error {
+	for _, t := range tables {
+		if _, err := tx.ExecContext(ctx, `TRUNCATE TABLE `+t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsRetryableError returns true if err indicates that the transaction was
+// chosen as a deadlock victim (error number 1205), or was aborted due to an
+// update conflict under snapshot isolation (error number 3960). In both cases
+// the transaction has already been rolled back.
+//
+// It supports errors produced by github.com/microsoft/go-mssqldb and its
+// predecessor, github.com/denisenkom/go-mssqldb.
+func (d *mssqlDriver) IsRetryableError(err error) bool {
+	v, ok := findDriverError(err, mssqlErrorTypes...)
+	if !ok {
+		return false
+	}
+
+	x, ok := v.Interface().(interface{ SQLErrorNumber() int32 })
+	if !ok {
+		return false
+	}
+
+	switch x.SQLErrorNumber() {
+	case mssqlErrDeadlock, mssqlErrSnapshotConflict:
+		return true
+	default:
+		return false
+	}
+}
+
+// mssqlErrorTypes are the error types used by the supported SQL Server drivers
+// to report errors returned by the server.
+var mssqlErrorTypes = []driverErrorType{
+	{"github.com/microsoft/go-mssqldb", "Error"},
+	{"github.com/denisenkom/go-mssqldb", "Error"},
+}
+
+const (
+	// mssqlErrDeadlock is the SQL Server error number that indicates that a
+	// transaction was chosen as the victim of a deadlock.
+	mssqlErrDeadlock = 1205
+
+	// mssqlErrSnapshotConflict is the SQL Server error number that indicates
+	// that a snapshot isolation transaction was aborted due to an update
+	// conflict.
+	mssqlErrSnapshotConflict = 3960
+)
+
+func (d *mssqlDriver) Dialect() Dialect {
+	return mssqlDialect{}
+}
+
+// quoteMSSQLIdentifier returns name quoted for use as an identifier in a SQL
+// Server query.
+func quoteMSSQLIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+// quoteMSSQLString returns s quoted for use as a Unicode string literal in a
+// SQL Server query.
+func quoteMSSQLString(s string) string {
+	return "N'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,129 @@
+package sqlprojection_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/dogmatiq/projectionkit/sqlprojection"
+	mssqldriver "github.com/microsoft/go-mssqldb"
+	"github.com/testcontainers/testcontainers-go/modules/mssql"
+)
+
+// mssqlIsolationQuery is a query that returns the isolation level of the
+// current SQL Server transaction.
+const mssqlIsolationQuery = `SELECT
+	CASE transaction_isolation_level
+		WHEN 1 THEN 'READ UNCOMMITTED'
+		WHEN 2 THEN 'READ COMMITTED'
+		WHEN 3 THEN 'REPEATABLE READ'
+		WHEN 4 THEN 'SERIALIZABLE'
+		WHEN 5 THEN 'SNAPSHOT'
+		ELSE 'UNSPECIFIED'
+	END
+	FROM sys.dm_exec_sessions
+	WHERE session_id = @@SPID`
+
+func TestMSSQLDriver(t *testing.T) {
+	t.Parallel()
+
+	container, err := mssql.Run(
+		t.Context(),
+		"mcr.microsoft.com/mssql/server:2022-latest",
+		mssql.WithAcceptEULA(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := container.Terminate(context.Background()); err != nil {
+			t.Log(err)
+		}
+	})
+
+	dsn, err := container.ConnectionString(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runTests(
+		t,
+		"sqlserver", dsn,
+		MSSQLDriver,
+		mssqlIsolationQuery,
+	)
+
+	t.Run("with a custom table name", func(t *testing.T) {
+		runTests(
+			t,
+			"sqlserver", dsn,
+			NewMSSQLDriver(
+				WithMSSQLTable("app [checkpoint]"),
+			),
+			mssqlIsolationQuery,
+		)
+	})
+}
+
+func TestMSSQLDriver_IsRetryableError(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Desc string
+		Err  error
+		Want bool
+	}{
+		{"deadlock victim", mssqldriver.Error{Number: 1205}, true},
+		{"snapshot update conflict", mssqldriver.Error{Number: 3960}, true},
+		{"wrapped deadlock victim", fmt.Errorf("<wrapped>: %w", mssqldriver.Error{Number: 1205}), true},
+		{"primary key violation", mssqldriver.Error{Number: 2627}, false},
+		{"error of another type with the same number", numberedError{Number: 1205}, false},
+		{"other error", fmt.Errorf("<error>"), false},
+	}
+
+	// The cases use the driver's real error type, so they fail if the type is
+	// renamed or moved to a different package.
+	for _, c := range cases {
+		t.Run(c.Desc, func(t *testing.T) {
+			if got := MSSQLDriver.IsRetryableError(c.Err); got != c.Want {
+				t.Fatalf("unexpected result: got %t, want %t", got, c.Want)
+			}
+		})
+	}
+}
+
+func TestMSSQLDriver_Dialect(t *testing.T) {
+	t.Parallel()
+
+	dialect := MSSQLDriver.Dialect()
+
+	t.Run("func Rebind()", func(t *testing.T) {
+		got := dialect.Rebind(`SELECT [a?]]b] FROM t WHERE x = ? AND y = '?' AND z = ?`)
+		want := `SELECT [a?]]b] FROM t WHERE x = @p1 AND y = '?' AND z = @p2`
+
+		if got != want {
+			t.Fatalf("unexpected query: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("func DecodeUUID()", func(t *testing.T) {
+		// The byte order used by SQL Server for UNIQUEIDENTIFIER values.
+		data := []byte{
+			0x2e, 0x2f, 0x6d, 0xb8,
+			0x4c, 0x8c,
+			0x4b, 0x4e,
+			0x9f, 0x0e, 0x9a, 0x5c, 0xc0, 0xec, 0x7b, 0x3f,
+		}
+
+		got, err := dialect.DecodeUUID(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := "b86d2f2e-8c4c-4e4b-9f0e-9a5cc0ec7b3f"
+		if got != want {
+			t.Fatalf("unexpected UUID: got %q, want %q", got, want)
+		}
+	})
+}
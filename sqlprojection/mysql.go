@@ -3,36 +3,224 @@ package sqlprojection
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dogmatiq/projectionkit"
 )
 
 // MySQLDriver is a Driver for MySQL.
 //
 // This driver should work with any underlying Go SQL driver that supports MySQL
 // compatible databases and ?-style placeholders.
-var MySQLDriver Driver = mysqlDriver{}
+//
+// It stores checkpoint offsets in the "projection_checkpoint" table. Use
+// [NewMySQLDriver] to use a different name.
+var MySQLDriver Driver = NewMySQLDriver()
 
-type mysqlDriver struct{}
+// NewMySQLDriver returns a new Driver for MySQL.
+//
+// This driver should work with any underlying Go SQL driver that supports MySQL
+// compatible databases and ?-style placeholders.
+func NewMySQLDriver(options ...MySQLOption) Driver {
+	d := &mysqlDriver{
+		table: "projection_checkpoint",
+	}
 
-func (mysqlDriver) CreateSchema(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(
+	for _, opt := range options {
+		opt(d)
+	}
+
+	d.checkpointTable = quoteMySQLIdentifier(d.table)
+
+	d.versions = versionTable{
+		Exists: `SELECT EXISTS (
+			SELECT 1
+			FROM information_schema.tables
+			WHERE table_schema = DATABASE()
+			AND table_name = ?
+		)`,
+		ExistsArgs: []any{d.table + "_version"},
+		Create: `CREATE TABLE IF NOT EXISTS ` + quoteMySQLIdentifier(d.table+"_version") + ` (
+			version INTEGER NOT NULL PRIMARY KEY
+		) ENGINE=InnoDB`,
+		Select: `SELECT COALESCE(MAX(version), 0) FROM ` + quoteMySQLIdentifier(d.table+"_version"),
+		Insert: `INSERT INTO ` + quoteMySQLIdentifier(d.table+"_version") + ` (version) VALUES (?)`,
+	}
+
+	return d
+}
+
+// MySQLOption is a functional option that changes the behavior of
+// [NewMySQLDriver].
+type MySQLOption func(*mysqlDriver)
+
+// WithMySQLTable is a [MySQLOption] that sets the name of the table used to
+// store checkpoint offsets.
+func WithMySQLTable(name string) MySQLOption {
+	if name == "" {
+		panic("table name must not be empty")
+	}
+
+	return func(d *mysqlDriver) {
+		d.table = name
+	}
+}
+
+// WithMySQLPartitions is a [MySQLOption] that partitions the checkpoint table
+// into n partitions by hashing the handler's identity key.
+//
+// The partitions are created along with the checkpoint table. The option has
+// no effect if the table already exists; existing tables are never
+// re-partitioned.
+//
+// All checkpoints for a given handler are stored in the same partition.
+func WithMySQLPartitions(n int) MySQLOption {
+	if n <= 0 {
+		panic("number of partitions must be positive")
+	}
+
+	return func(d *mysqlDriver) {
+		d.partitions = n
+	}
+}
+
+type mysqlDriver struct {
+	table string
+
+	// partitions is the number of partitions in the checkpoint table, or zero
+	// if it's not partitioned.
+	partitions int
+
+	// checkpointTable is the quoted name of the checkpoint table.
+	checkpointTable string
+
+	// versions describes the table that records the applied migrations.
+	versions versionTable
+}
+
+func (d *mysqlDriver) CreateSchema(ctx context.Context, db *sql.DB) error {
+	return d.MigrateSchema(ctx, db)
+}
+
+func (d *mysqlDriver) MigrateSchema(ctx context.Context, db *sql.DB) error {
+	// MySQL implicitly commits most schema changes, so there is no benefit to
+	// performing the migrations within a transaction. Instead, we acquire a
+	// named lock to prevent concurrent migrations of the same tables. Named
+	// locks are bound to a specific connection.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var ok sql.NullBool
+	if err := conn.QueryRowContext(
 		ctx,
-		`CREATE TABLE IF NOT EXISTS projection_checkpoint (
-			handler           BINARY(16) NOT NULL,
-			stream            BINARY(16) NOT NULL,
-			checkpoint_offset BIGINT UNSIGNED NOT NULL,
+		`SELECT GET_LOCK(`+mysqlLockName+`, ?)`,
+		d.table,
+		int(mysqlLockTimeout.Seconds()),
+	).Scan(&ok); err != nil {
+		return err
+	}
 
-			PRIMARY KEY (handler, stream)
-		) ENGINE=InnoDB;`,
+	if !ok.Bool {
+		return fmt.Errorf(
+			"unable to acquire the schema migration lock within %s",
+			mysqlLockTimeout,
+		)
+	}
+
+	defer conn.ExecContext( // nolint:errcheck
+		context.WithoutCancel(ctx),
+		`DO RELEASE_LOCK(`+mysqlLockName+`)`,
+		d.table,
 	)
-	return err
+
+	return migrate(ctx, conn, d.versions, d.migrations())
+}
+
+func (d *mysqlDriver) SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	return schemaVersion(ctx, db, d.versions)
+}
+
+// migrations returns the migrations that produce the latest version of the
+// driver's schema.
+func (d *mysqlDriver) migrations() []migration {
+	// KEY partitioning is used instead of HASH partitioning, as the latter
+	// requires an integer expression.
+	partitionBy := ``
+	if d.partitions != 0 {
+		partitionBy = ` PARTITION BY KEY (handler) PARTITIONS ` + strconv.Itoa(d.partitions)
+	}
+
+	return []migration{
+		exec(
+			`CREATE TABLE IF NOT EXISTS ` + d.checkpointTable + ` (
+				handler           BINARY(16) NOT NULL,
+				stream            BINARY(16) NOT NULL,
+				checkpoint_offset BIGINT UNSIGNED NOT NULL,
+
+				PRIMARY KEY (handler, stream)
+			) ENGINE=InnoDB` + partitionBy,
+		),
+		// MySQL does not support ADD COLUMN IF NOT EXISTS, so we check for the
+		// columns explicitly. Both columns are added by a single (atomic)
+		// statement, so it's sufficient to check for one of them.
+		func(ctx context.Context, x execer) error {
+			var exists bool
+			if err := x.QueryRowContext(
+				ctx,
+				`SELECT EXISTS (
+					SELECT 1
+					FROM information_schema.columns
+					WHERE table_schema = DATABASE()
+					AND table_name = ?
+					AND column_name = 'updated_at'
+				)`,
+				d.table,
+			).Scan(&exists); err != nil || exists {
+				return err
+			}
+
+			// The timestamps are stored as the number of nanoseconds since
+			// the Unix epoch, as MySQL's DATETIME type has no time zone
+			// information and is limited to microsecond precision.
+			_, err := x.ExecContext(
+				ctx,
+				`ALTER TABLE `+d.checkpointTable+`
+					ADD COLUMN updated_at        BIGINT NULL,
+					ADD COLUMN event_recorded_at BIGINT NULL`,
+			)
+			return err
+		},
+	}
 }
 
-func (mysqlDriver) DropSchema(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(ctx, `DROP TABLE IF EXISTS projection_checkpoint`)
+// mysqlLockTimeout is the maximum amount of time to wait to acquire the named
+// lock used to serialize schema migrations.
+const mysqlLockTimeout = 1 * time.Minute
+
+// mysqlLockName is an SQL expression that evaluates to the name of the lock
+// used to serialize schema migrations of the table named by its parameter.
+//
+// Named locks are server-wide, so the name includes the current database to
+// avoid contention between tables with the same name in different databases.
+// MySQL limits lock names to 64 characters, so we use a hash of the qualified
+// table name instead of the name itself.
+const mysqlLockName = `CONCAT('projectionkit:', SHA1(CONCAT(COALESCE(DATABASE(), ''), '.', ?)))`
+
+func (d *mysqlDriver) DropSchema(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(
+		ctx,
+		`DROP TABLE IF EXISTS `+d.checkpointTable+`, `+quoteMySQLIdentifier(d.table+"_version"),
+	)
 	return err
 }
 
-func (mysqlDriver) QueryCheckpointOffset(
+func (d *mysqlDriver) QueryCheckpointOffset(
 	ctx context.Context,
 	db *sql.DB,
 	h, s []byte,
@@ -40,7 +228,7 @@ func (mysqlDriver) QueryCheckpointOffset(
 	row := db.QueryRowContext(
 		ctx,
 		`SELECT checkpoint_offset
-		FROM projection_checkpoint
+		FROM `+d.checkpointTable+`
 		WHERE handler = ?
 		AND stream = ?`,
 		h,
@@ -57,22 +245,303 @@ func (mysqlDriver) QueryCheckpointOffset(
 	return cp, err
 }
 
-func (mysqlDriver) UpdateCheckpointOffset(
+func (d *mysqlDriver) QueryCheckpoint(
+	ctx context.Context,
+	db *sql.DB,
+	h, s []byte,
+) (projectionkit.Checkpoint, error) {
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		FROM `+d.checkpointTable+`
+		WHERE handler = ?
+		AND stream = ?`,
+		h,
+		s,
+	)
+
+	cp := projectionkit.Checkpoint{
+		StreamID: streamIDString(s),
+	}
+
+	var updatedAt, recordedAt sql.NullInt64
+	err := row.Scan(&cp.Offset, &updatedAt, &recordedAt)
+
+	if err == sql.ErrNoRows {
+		return cp, nil
+	}
+
+	cp.UpdatedAt = fromNullUnixNano(updatedAt)
+	cp.EventRecordedAt = fromNullUnixNano(recordedAt)
+
+	return cp, err
+}
+
+func (d *mysqlDriver) QueryCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	h, after []byte,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	query := `SELECT
+			stream,
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		FROM ` + d.checkpointTable + `
+		WHERE handler = ?`
+	args := []any{h}
+
+	if after != nil {
+		query += ` AND stream > ?`
+		args = append(args, after)
+	}
+
+	query += ` ORDER BY stream LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []projectionkit.Checkpoint
+
+	for rows.Next() {
+		var (
+			cp                    projectionkit.Checkpoint
+			stream                []byte
+			updatedAt, recordedAt sql.NullInt64
+		)
+
+		if err := rows.Scan(
+			&stream,
+			&cp.Offset,
+			&updatedAt,
+			&recordedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		cp.StreamID = streamIDString(stream)
+		cp.UpdatedAt = fromNullUnixNano(updatedAt)
+		cp.EventRecordedAt = fromNullUnixNano(recordedAt)
+		checkpoints = append(checkpoints, cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+func (d *mysqlDriver) CountCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	h []byte,
+) (uint64, error) {
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*)
+		FROM `+d.checkpointTable+`
+		WHERE handler = ?`,
+		h,
+	)
+
+	var n uint64
+	err := row.Scan(&n)
+	return n, err
+}
+
+func (d *mysqlDriver) QueryGroupCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	handlers [][]byte,
+	after []byte,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	args := make([]any, 0, len(handlers)+3)
+	for _, h := range handlers {
+		args = append(args, h)
+	}
+
+	query := `SELECT
+			stream,
+			MIN(checkpoint_offset),
+			MIN(updated_at),
+			MIN(event_recorded_at)
+		FROM ` + d.checkpointTable + `
+		WHERE handler IN (` + parameterList(len(handlers), func(int) string { return "?" }) + `)
+		AND checkpoint_offset <> 0`
+
+	if after != nil {
+		query += ` AND stream > ?`
+		args = append(args, after)
+	}
+
+	query += ` GROUP BY stream HAVING COUNT(*) = ? ORDER BY stream LIMIT ?`
+	args = append(args, len(handlers), limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []projectionkit.Checkpoint
+
+	for rows.Next() {
+		var (
+			cp                    projectionkit.Checkpoint
+			stream                []byte
+			updatedAt, recordedAt sql.NullInt64
+		)
+
+		if err := rows.Scan(
+			&stream,
+			&cp.Offset,
+			&updatedAt,
+			&recordedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		cp.StreamID = streamIDString(stream)
+		cp.UpdatedAt = fromNullUnixNano(updatedAt)
+		cp.EventRecordedAt = fromNullUnixNano(recordedAt)
+		checkpoints = append(checkpoints, cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+func (d *mysqlDriver) CountGroupCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	handlers [][]byte,
+) (uint64, error) {
+	args := make([]any, 0, len(handlers)+1)
+	for _, h := range handlers {
+		args = append(args, h)
+	}
+	args = append(args, len(handlers))
+
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM (
+			SELECT stream
+			FROM `+d.checkpointTable+`
+			WHERE handler IN (`+parameterList(len(handlers), func(int) string { return "?" })+`)
+			AND checkpoint_offset <> 0
+			GROUP BY stream
+			HAVING COUNT(*) = ?
+		) AS g`,
+		args...,
+	)
+
+	var n uint64
+	err := row.Scan(&n)
+	return n, err
+}
+
+func (d *mysqlDriver) QueryHandlers(
+	ctx context.Context,
+	db *sql.DB,
+) ([][]byte, error) {
+	rows, err := db.QueryContext(
+		ctx,
+		`SELECT DISTINCT handler
+		FROM `+d.checkpointTable+`
+		ORDER BY handler`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var handlers [][]byte
+
+	for rows.Next() {
+		var h []byte
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, h)
+	}
+
+	return handlers, rows.Err()
+}
+
+func (d *mysqlDriver) StoreCheckpointOffset(
+	ctx context.Context,
+	tx *sql.Tx,
+	h, s []byte,
+	n uint64,
+) error {
+	if n == 0 {
+		// A stored offset of zero would prevent UpdateCheckpointOffset() from
+		// inserting the row when the stream's first event is handled.
+		_, err := tx.ExecContext(
+			ctx,
+			`DELETE FROM `+d.checkpointTable+`
+			WHERE handler = ?
+			AND stream = ?`,
+			h,
+			s,
+		)
+		return err
+	}
+
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO `+d.checkpointTable+` (
+			handler,
+			stream,
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		) VALUES (
+			?,
+			?,
+			?,
+			?,
+			NULL
+		) ON DUPLICATE KEY UPDATE
+			checkpoint_offset = VALUES(checkpoint_offset),
+			updated_at = VALUES(updated_at),
+			event_recorded_at = NULL`,
+		h,
+		s,
+		n,
+		nullUnixNano(time.Now()),
+	)
+	return err
+}
+
+func (d *mysqlDriver) UpdateCheckpointOffset(
 	ctx context.Context,
 	tx *sql.Tx,
 	h, s []byte,
 	c, n uint64,
+	t time.Time,
 ) (bool, error) {
+	now := time.Now()
+
 	// If the "current" checkpoint offset is zero, we assumed it's correct and
 	// that there is no existing row for this handler/stream.
 	if c == 0 {
 		res, err := tx.ExecContext(
 			ctx,
-			`INSERT INTO projection_checkpoint (
+			`INSERT INTO `+d.checkpointTable+` (
 				handler,
 				stream,
-				checkpoint_offset
+				checkpoint_offset,
+				updated_at,
+				event_recorded_at
 			) VALUES (
+				?,
+				?,
 				?,
 				?,
 				?
@@ -81,6 +550,8 @@ func (mysqlDriver) UpdateCheckpointOffset(
 			h,
 			s,
 			n,
+			nullUnixNano(now),
+			nullUnixNano(t),
 		)
 		if err != nil {
 			return false, err
@@ -99,12 +570,16 @@ func (mysqlDriver) UpdateCheckpointOffset(
 	// Otherwise we simply update the existing row.
 	res, err = tx.ExecContext(
 		ctx,
-		`UPDATE projection_checkpoint SET
-			checkpoint_offset = ?
+		`UPDATE `+d.checkpointTable+` SET
+			checkpoint_offset = ?,
+			updated_at = ?,
+			event_recorded_at = ?
 		WHERE handler = ?
 		AND stream = ?
 		AND checkpoint_offset = ?`,
 		n,
+		nullUnixNano(now),
+		nullUnixNano(t),
 		h,
 		s,
 		c,
@@ -120,16 +595,79 @@ func (mysqlDriver) UpdateCheckpointOffset(
 
 // DeleteCheckpointOffsets deletes all checkpoint offsets for a specific
 // handler.
-func (mysqlDriver) DeleteCheckpointOffsets(
+func (d *mysqlDriver) DeleteCheckpointOffsets(
 	ctx context.Context,
 	tx *sql.Tx,
 	h []byte,
 ) error {
 	_, err := tx.ExecContext(
 		ctx,
-		`DELETE FROM projection_checkpoint
+		`DELETE FROM `+d.checkpointTable+`
 		WHERE handler = ?`,
 		h,
 	)
 	return err
 }
+
+// TruncateTablesNonTransactionally removes all rows from the given tables
+// using db.
+//
+// MySQL implicitly commits the active transaction before truncating a table, so
+// the tables can not be truncated within a transaction.
+func (d *mysqlDriver) TruncateTablesNonTransactionally(
+	ctx context.Context,
+	db *sql.DB,
+	tables []string,
+) error {
+	for _, t := range tables {
+		if _, err := db.ExecContext(ctx, `TRUNCATE TABLE `+t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsRetryableError returns true if err is an InnoDB deadlock error (error
+// number 1213), in which case the transaction has already been rolled back.
+//
+// It supports errors produced by github.com/go-sql-driver/mysql.
+func (d *mysqlDriver) IsRetryableError(err error) bool {
+	n, ok := mysqlErrorNumber(err)
+	return ok && n == mysqlErrLockDeadlock
+}
+
+// mysqlErrorType is the error type used by github.com/go-sql-driver/mysql to
+// report errors returned by the server.
+var mysqlErrorType = driverErrorType{"github.com/go-sql-driver/mysql", "MySQLError"}
+
+// mysqlErrorNumber returns the MySQL error number of the first error in err's
+// tree that is of type [mysqlErrorType].
+//
+// The error type does not have a method that exposes the error number, so it's
+// read from its Number field.
+func mysqlErrorNumber(err error) (uint64, bool) {
+	v, ok := findDriverError(err, mysqlErrorType)
+	if !ok {
+		return 0, false
+	}
+
+	if f := v.FieldByName("Number"); f.IsValid() && f.CanUint() {
+		return f.Uint(), true
+	}
+
+	return 0, false
+}
+
+// mysqlErrLockDeadlock is the MySQL error number that indicates that a
+// transaction was rolled back to resolve a deadlock.
+const mysqlErrLockDeadlock = 1213
+
+func (d *mysqlDriver) Dialect() Dialect {
+	return mysqlDialect{}
+}
+
+// quoteMySQLIdentifier returns name quoted for use as an identifier in a MySQL
+// query.
+func quoteMySQLIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
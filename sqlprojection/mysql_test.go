@@ -2,14 +2,34 @@ package sqlprojection_test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"testing"
 
 	. "github.com/dogmatiq/projectionkit/sqlprojection"
-	_ "github.com/go-sql-driver/mysql"
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/testcontainers/testcontainers-go/modules/mariadb"
 	"github.com/testcontainers/testcontainers-go/modules/mysql"
 )
 
+// mysqlBaselineSchema is the schema created by the original, unversioned
+// release of the MySQL driver.
+var mysqlBaselineSchema = []string{
+	`CREATE TABLE IF NOT EXISTS projection_checkpoint (
+		handler           BINARY(16) NOT NULL,
+		stream            BINARY(16) NOT NULL,
+		checkpoint_offset BIGINT UNSIGNED NOT NULL,
+
+		PRIMARY KEY (handler, stream)
+	) ENGINE=InnoDB`,
+}
+
+// mysqlBaselineInsert inserts a checkpoint into [mysqlBaselineSchema].
+const mysqlBaselineInsert = `INSERT INTO projection_checkpoint
+	(handler, stream, checkpoint_offset)
+	VALUES (?, ?, ?)`
+
 func TestMySQLDriver_withMySQL(t *testing.T) {
 	t.Parallel()
 
@@ -36,7 +56,31 @@ func TestMySQLDriver_withMySQL(t *testing.T) {
 		t,
 		"mysql", dsn,
 		MySQLDriver,
+		`SELECT @@transaction_isolation`,
+	)
+
+	testBaselineMigration(
+		t,
+		"mysql", dsn,
+		MySQLDriver,
+		mysqlBaselineSchema,
+		mysqlBaselineInsert,
 	)
+
+	t.Run("with a custom table name", func(t *testing.T) {
+		runTests(
+			t,
+			"mysql", dsn,
+			NewMySQLDriver(
+				WithMySQLTable("app-checkpoint"),
+			),
+			`SELECT @@transaction_isolation`,
+		)
+	})
+
+	t.Run("with partitioning", func(t *testing.T) {
+		runMySQLPartitionTests(t, dsn)
+	})
 }
 
 func TestMySQLDriver_withMariaDB(t *testing.T) {
@@ -65,5 +109,128 @@ func TestMySQLDriver_withMariaDB(t *testing.T) {
 		t,
 		"mysql", dsn,
 		MySQLDriver,
+		`SELECT @@transaction_isolation`,
+	)
+
+	testBaselineMigration(
+		t,
+		"mysql", dsn,
+		MySQLDriver,
+		mysqlBaselineSchema,
+		mysqlBaselineInsert,
+	)
+
+	t.Run("with a custom table name", func(t *testing.T) {
+		runTests(
+			t,
+			"mysql", dsn,
+			NewMySQLDriver(
+				WithMySQLTable("app-checkpoint"),
+			),
+			`SELECT @@transaction_isolation`,
+		)
+	})
+
+	t.Run("with partitioning", func(t *testing.T) {
+		runMySQLPartitionTests(t, dsn)
+	})
+}
+
+// runMySQLPartitionTests runs the tests for a MySQL driver that uses a
+// partitioned checkpoint table.
+func runMySQLPartitionTests(t *testing.T, dsn string) {
+	driver := NewMySQLDriver(
+		WithMySQLTable("partitioned_checkpoint"),
+		WithMySQLPartitions(4),
+	)
+
+	runTests(
+		t,
+		"mysql", dsn,
+		driver,
+		`SELECT @@transaction_isolation`,
 	)
+
+	t.Run("it creates the partitions", func(t *testing.T) {
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if err := driver.CreateSchema(t.Context(), db); err != nil {
+			t.Fatal(err)
+		}
+		defer driver.DropSchema(context.Background(), db) // nolint:errcheck
+
+		var count int
+		if err := db.QueryRowContext(
+			t.Context(),
+			`SELECT COUNT(*)
+			FROM information_schema.partitions
+			WHERE table_schema = DATABASE()
+			AND table_name = 'partitioned_checkpoint'
+			AND partition_name IS NOT NULL`,
+		).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+
+		if count != 4 {
+			t.Fatalf("unexpected number of partitions: got %d, want 4", count)
+		}
+	})
+}
+
+func TestMySQLDriver_IsRetryableError(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Desc string
+		Err  error
+		Want bool
+	}{
+		{"deadlock", &mysqldriver.MySQLError{Number: 1213}, true},
+		{"wrapped deadlock", fmt.Errorf("<wrapped>: %w", &mysqldriver.MySQLError{Number: 1213}), true},
+		{"joined deadlock", errors.Join(errors.New("<error>"), &mysqldriver.MySQLError{Number: 1213}), true},
+		{"duplicate entry", &mysqldriver.MySQLError{Number: 1062}, false},
+		{"error of another type with the same number", &numberedError{Number: 1213}, false},
+		{"other error", fmt.Errorf("<error>"), false},
+	}
+
+	// The cases use the driver's real error type, so they fail if the type is
+	// renamed or moved to a different package.
+	for _, c := range cases {
+		t.Run(c.Desc, func(t *testing.T) {
+			if got := MySQLDriver.IsRetryableError(c.Err); got != c.Want {
+				t.Fatalf("unexpected result: got %t, want %t", got, c.Want)
+			}
+		})
+	}
+}
+
+func TestMySQLDriver_Dialect(t *testing.T) {
+	t.Parallel()
+
+	dialect := MySQLDriver.Dialect()
+
+	t.Run("func Upsert()", func(t *testing.T) {
+		t.Run("it panics if there are no key columns", func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+
+			dialect.Upsert("t", nil)
+		})
+	})
 }
+
+// numberedError is an error that has the same shape as the errors returned by
+// the MySQL and SQL Server drivers, but is not one of their types.
+type numberedError struct {
+	Number int32
+}
+
+func (e numberedError) Error() string         { return "<error>" }
+func (e numberedError) SQLErrorNumber() int32 { return e.Number }
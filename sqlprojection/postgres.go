@@ -3,63 +3,349 @@ package sqlprojection
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dogmatiq/projectionkit"
 )
 
 // PostgresDriver is a Driver for PostgreSQL.
 //
 // This driver should work with any underlying Go SQL driver that supports
 // PostgreSQL compatible databases and $1-style placeholders.
-var PostgresDriver Driver = postgresDriver{}
+//
+// It stores checkpoint offsets in the "checkpoint" table within the
+// "projection" schema. Use [NewPostgresDriver] to use different names.
+var PostgresDriver Driver = NewPostgresDriver()
+
+// NewPostgresDriver returns a new Driver for PostgreSQL.
+//
+// This driver should work with any underlying Go SQL driver that supports
+// PostgreSQL compatible databases and $1-style placeholders.
+func NewPostgresDriver(options ...PostgresOption) Driver {
+	return newPostgresDriver(false, options)
+}
+
+// newPostgresDriver returns a new driver for PostgreSQL, or for CockroachDB if
+// cockroach is true.
+func newPostgresDriver(cockroach bool, options []PostgresOption) *postgresDriver {
+	d := &postgresDriver{
+		schema:    "projection",
+		table:     "checkpoint",
+		cockroach: cockroach,
+	}
+
+	for _, opt := range options {
+		opt(d)
+	}
+
+	d.checkpointTable = d.ident(d.table)
+	d.byteaToUUID = d.ident("bytea_to_uuid")
+	d.versions = versionTable{
+		Exists: `SELECT EXISTS (
+			SELECT 1
+			FROM information_schema.tables
+			WHERE table_schema = $1
+			AND table_name = $2
+		)`,
+		ExistsArgs: []any{d.schema, d.table + "_version"},
+		Create: `CREATE TABLE IF NOT EXISTS ` + d.ident(d.table+"_version") + ` (
+			version INTEGER NOT NULL PRIMARY KEY
+		)`,
+		Select: `SELECT COALESCE(MAX(version), 0) FROM ` + d.ident(d.table+"_version"),
+		Insert: `INSERT INTO ` + d.ident(d.table+"_version") + ` (version) VALUES ($1)`,
+	}
 
-type postgresDriver struct{}
+	return d
+}
 
-func (postgresDriver) CreateSchema(ctx context.Context, db *sql.DB) error {
+// PostgresOption is a functional option that changes the behavior of
+// [NewPostgresDriver].
+type PostgresOption func(*postgresDriver)
+
+// WithPostgresSchema is a [PostgresOption] that sets the name of the schema
+// that contains the driver's tables and functions.
+//
+// The schema may be shared by several drivers that use different table names.
+// It's dropped by [Driver.DropSchema] when it no longer contains any tables.
+func WithPostgresSchema(name string) PostgresOption {
+	if name == "" {
+		panic("schema name must not be empty")
+	}
+
+	return func(d *postgresDriver) {
+		d.schema = name
+	}
+}
+
+// WithPostgresTable is a [PostgresOption] that sets the name of the table used
+// to store checkpoint offsets.
+func WithPostgresTable(name string) PostgresOption {
+	if name == "" {
+		panic("table name must not be empty")
+	}
+
+	return func(d *postgresDriver) {
+		d.table = name
+	}
+}
+
+// WithPostgresPartitions is a [PostgresOption] that partitions the checkpoint
+// table into n partitions by hashing the handler's identity key.
+//
+// The partitions are created along with the checkpoint table. The option has
+// no effect if the table already exists; existing tables are never
+// re-partitioned.
+//
+// All checkpoints for a given handler are stored in the same partition. When
+// used with [NewCockroachDriver], which does not support hash partitioning, the
+// table's primary key is instead hash-sharded into n buckets.
+func WithPostgresPartitions(n int) PostgresOption {
+	if n <= 0 {
+		panic("number of partitions must be positive")
+	}
+
+	return func(d *postgresDriver) {
+		d.partitions = n
+	}
+}
+
+type postgresDriver struct {
+	schema, table string
+
+	// partitions is the number of partitions in the checkpoint table, or zero
+	// if it's not partitioned.
+	partitions int
+
+	// cockroach indicates that the driver is used with CockroachDB, which
+	// does not support user-defined SQL functions or advisory locks.
+	cockroach bool
+
+	// checkpointTable and byteaToUUID are the quoted, schema-qualified names of
+	// the checkpoint table and the UUID conversion function, respectively.
+	checkpointTable string
+	byteaToUUID     string
+
+	// versions describes the table that records the applied migrations.
+	versions versionTable
+}
+
+// ident returns the quoted, schema-qualified form of the given identifier.
+func (d *postgresDriver) ident(name string) string {
+	return quotePostgresIdentifier(d.schema) + "." + quotePostgresIdentifier(name)
+}
+
+// uuid returns an expression that converts the BYTEA parameter p to a UUID.
+func (d *postgresDriver) uuid(p string) string {
+	if d.cockroach {
+		return p + "::BYTES::UUID"
+	}
+	return d.byteaToUUID + "(" + p + ")"
+}
+
+// uuidParameter returns an expression that converts the n'th parameter from a
+// BYTEA to a UUID.
+func (d *postgresDriver) uuidParameter(n int) string {
+	return d.uuid("$" + strconv.Itoa(n))
+}
+
+// uuidBytes returns an expression that converts the UUID column c to a BYTEA.
+func (d *postgresDriver) uuidBytes(c string) string {
+	if d.cockroach {
+		return c + "::BYTES"
+	}
+	return "uuid_send(" + c + ")"
+}
+
+func (d *postgresDriver) CreateSchema(ctx context.Context, db *sql.DB) error {
+	return d.MigrateSchema(ctx, db)
+}
+
+func (d *postgresDriver) MigrateSchema(ctx context.Context, db *sql.DB) error {
+	if d.cockroach {
+		// CockroachDB does not support advisory locks. Instead, we rely on its
+		// serializable transactions to abort all but one of any concurrent
+		// migrations, and retry the others.
+		return defaultRetryPolicy.Do(ctx, d, func(ctx context.Context) error {
+			return d.migrateSchema(ctx, db)
+		})
+	}
+
+	return d.migrateSchema(ctx, db)
+}
+
+// migrateSchema applies the migrations within a single transaction.
+func (d *postgresDriver) migrateSchema(ctx context.Context, db *sql.DB) error {
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback() // nolint:errcheck
 
+	if !d.cockroach {
+		// Acquire a transaction-scoped advisory lock to prevent concurrent
+		// migrations of the same tables, which would otherwise race to create
+		// the schema elements.
+		if _, err := tx.ExecContext(
+			ctx,
+			`SELECT pg_advisory_xact_lock(hashtext($1))`,
+			"projectionkit:"+d.checkpointTable,
+		); err != nil {
+			return err
+		}
+	}
+
 	if _, err := tx.ExecContext(
 		ctx,
-		`CREATE SCHEMA IF NOT EXISTS projection`,
+		`CREATE SCHEMA IF NOT EXISTS `+quotePostgresIdentifier(d.schema),
 	); err != nil {
 		return err
 	}
 
-	// We define a function to convert from BYTEA to UUID on the server-side so
-	// we are only sending 16 byte raw UUIDs over the write (instead of 36 byte
-	// hex-encoded strings).
-	if _, err = tx.ExecContext(
-		ctx,
-		`CREATE OR REPLACE FUNCTION projection.bytea_to_uuid (BYTEA) RETURNS UUID AS $$
-			SELECT ENCODE($1, 'hex')::UUID;
-		$$ LANGUAGE SQL IMMUTABLE;`); err != nil {
+	if err := migrate(ctx, tx, d.versions, d.migrations()); err != nil {
 		return err
 	}
 
-	if _, err = tx.ExecContext(
+	return tx.Commit()
+}
+
+func (d *postgresDriver) SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	return schemaVersion(ctx, db, d.versions)
+}
+
+// migrations returns the migrations that produce the latest version of the
+// driver's schema.
+func (d *postgresDriver) migrations() []migration {
+	var migrations []migration
+
+	if !d.cockroach {
+		// We define a function to convert from BYTEA to UUID on the server-side
+		// so we are only sending 16 byte raw UUIDs over the write (instead of
+		// 36 byte hex-encoded strings). CockroachDB can cast BYTES to UUID
+		// directly.
+		migrations = append(
+			migrations,
+			exec(
+				`CREATE OR REPLACE FUNCTION `+d.byteaToUUID+` (BYTEA) RETURNS UUID AS $$
+					SELECT ENCODE($1, 'hex')::UUID;
+				$$ LANGUAGE SQL IMMUTABLE;`,
+			),
+		)
+	}
+
+	return append(
+		migrations,
+		d.createCheckpointTable,
+		exec(
+			`ALTER TABLE `+d.checkpointTable+`
+				ADD COLUMN IF NOT EXISTS updated_at        TIMESTAMPTZ NULL,
+				ADD COLUMN IF NOT EXISTS event_recorded_at TIMESTAMPTZ NULL`,
+		),
+	)
+}
+
+// createCheckpointTable is a [migration] that creates the checkpoint table
+// and its partitions, if any.
+func (d *postgresDriver) createCheckpointTable(ctx context.Context, x execer) error {
+	primaryKey := `PRIMARY KEY (handler, stream)`
+	partitionBy := ``
+
+	if d.partitions != 0 {
+		if d.cockroach {
+			primaryKey += ` USING HASH WITH (bucket_count = ` + strconv.Itoa(d.partitions) + `)`
+		} else {
+			partitionBy = ` PARTITION BY HASH (handler)`
+		}
+	}
+
+	if _, err := x.ExecContext(
 		ctx,
-		`CREATE TABLE IF NOT EXISTS projection.checkpoint (
+		`CREATE TABLE IF NOT EXISTS `+d.checkpointTable+` (
 			handler           UUID NOT NULL,
 			stream            UUID NOT NULL,
 			checkpoint_offset BIGINT NOT NULL,
 
-			PRIMARY KEY (handler, stream)
-		)`,
+			`+primaryKey+`
+		)`+partitionBy,
 	); err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	if partitionBy == "" {
+		return nil
+	}
+
+	for i := range d.partitions {
+		if _, err := x.ExecContext(
+			ctx,
+			fmt.Sprintf(
+				`CREATE TABLE IF NOT EXISTS %s
+				PARTITION OF %s
+				FOR VALUES WITH (MODULUS %d, REMAINDER %d)`,
+				d.partitionTable(i),
+				d.checkpointTable,
+				d.partitions,
+				i,
+			),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (postgresDriver) DropSchema(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(ctx, `DROP SCHEMA IF EXISTS projection CASCADE`)
-	return err
+// partitionTable returns the quoted, schema-qualified name of the i'th
+// partition of the checkpoint table.
+func (d *postgresDriver) partitionTable(i int) string {
+	return d.ident(d.table + "_p" + strconv.Itoa(i))
 }
 
-func (postgresDriver) QueryCheckpointOffset(
+func (d *postgresDriver) DropSchema(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`DROP TABLE IF EXISTS `+d.checkpointTable+`, `+d.ident(d.table+"_version"),
+	); err != nil {
+		return err
+	}
+
+	// Only drop the schema itself once it's no longer in use, as it may be
+	// shared by drivers that use different table names.
+	var inUse bool
+	if err := tx.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (
+			SELECT 1
+			FROM information_schema.tables
+			WHERE table_schema = $1
+		)`,
+		d.schema,
+	).Scan(&inUse); err != nil {
+		return err
+	}
+
+	if !inUse {
+		if _, err := tx.ExecContext(
+			ctx,
+			`DROP SCHEMA IF EXISTS `+quotePostgresIdentifier(d.schema)+` CASCADE`,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d *postgresDriver) QueryCheckpointOffset(
 	ctx context.Context,
 	db *sql.DB,
 	h, s []byte,
@@ -67,9 +353,9 @@ func (postgresDriver) QueryCheckpointOffset(
 	row := db.QueryRowContext(
 		ctx,
 		`SELECT checkpoint_offset
-		FROM projection.checkpoint
-		WHERE handler = projection.bytea_to_uuid($1)
-		AND stream = projection.bytea_to_uuid($2)`,
+		FROM `+d.checkpointTable+`
+		WHERE handler = `+d.uuid("$1")+`
+		AND stream = `+d.uuid("$2"),
 		h,
 		s,
 	)
@@ -84,29 +370,310 @@ func (postgresDriver) QueryCheckpointOffset(
 	return cp, err
 }
 
-func (postgresDriver) UpdateCheckpointOffset(
+func (d *postgresDriver) QueryCheckpoint(
+	ctx context.Context,
+	db *sql.DB,
+	h, s []byte,
+) (projectionkit.Checkpoint, error) {
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		FROM `+d.checkpointTable+`
+		WHERE handler = `+d.uuid("$1")+`
+		AND stream = `+d.uuid("$2"),
+		h,
+		s,
+	)
+
+	cp := projectionkit.Checkpoint{
+		StreamID: streamIDString(s),
+	}
+
+	var updatedAt, recordedAt sql.NullTime
+	err := row.Scan(&cp.Offset, &updatedAt, &recordedAt)
+
+	if err == sql.ErrNoRows {
+		return cp, nil
+	}
+
+	cp.UpdatedAt = updatedAt.Time
+	cp.EventRecordedAt = recordedAt.Time
+
+	return cp, err
+}
+
+func (d *postgresDriver) QueryCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	h, after []byte,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	query := `SELECT
+			stream::TEXT,
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		FROM ` + d.checkpointTable + `
+		WHERE handler = ` + d.uuid("$1")
+	args := []any{h, limit}
+
+	if after != nil {
+		query += ` AND stream > ` + d.uuid("$3")
+		args = append(args, after)
+	}
+
+	query += ` ORDER BY stream LIMIT $2`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []projectionkit.Checkpoint
+
+	for rows.Next() {
+		var (
+			cp                    projectionkit.Checkpoint
+			updatedAt, recordedAt sql.NullTime
+		)
+
+		if err := rows.Scan(
+			&cp.StreamID,
+			&cp.Offset,
+			&updatedAt,
+			&recordedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		cp.UpdatedAt = updatedAt.Time
+		cp.EventRecordedAt = recordedAt.Time
+		checkpoints = append(checkpoints, cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+func (d *postgresDriver) CountCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	h []byte,
+) (uint64, error) {
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*)
+		FROM `+d.checkpointTable+`
+		WHERE handler = `+d.uuid("$1"),
+		h,
+	)
+
+	var n uint64
+	err := row.Scan(&n)
+	return n, err
+}
+
+func (d *postgresDriver) QueryGroupCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	handlers [][]byte,
+	after []byte,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	args := make([]any, 0, len(handlers)+3)
+	for _, h := range handlers {
+		args = append(args, h)
+	}
+	args = append(args, len(handlers), limit)
+
+	query := `SELECT
+			stream::TEXT,
+			MIN(checkpoint_offset),
+			MIN(updated_at),
+			MIN(event_recorded_at)
+		FROM ` + d.checkpointTable + `
+		WHERE handler IN (` + parameterList(len(handlers), d.uuidParameter) + `)
+		AND checkpoint_offset <> 0`
+
+	if after != nil {
+		args = append(args, after)
+		query += ` AND stream > ` + d.uuidParameter(len(args))
+	}
+
+	query += ` GROUP BY stream
+		HAVING COUNT(*) = $` + strconv.Itoa(len(handlers)+1) + `
+		ORDER BY stream
+		LIMIT $` + strconv.Itoa(len(handlers)+2)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []projectionkit.Checkpoint
+
+	for rows.Next() {
+		var (
+			cp                    projectionkit.Checkpoint
+			updatedAt, recordedAt sql.NullTime
+		)
+
+		if err := rows.Scan(
+			&cp.StreamID,
+			&cp.Offset,
+			&updatedAt,
+			&recordedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		cp.UpdatedAt = updatedAt.Time
+		cp.EventRecordedAt = recordedAt.Time
+		checkpoints = append(checkpoints, cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+func (d *postgresDriver) CountGroupCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	handlers [][]byte,
+) (uint64, error) {
+	args := make([]any, 0, len(handlers)+1)
+	for _, h := range handlers {
+		args = append(args, h)
+	}
+	args = append(args, len(handlers))
+
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM (
+			SELECT stream
+			FROM `+d.checkpointTable+`
+			WHERE handler IN (`+parameterList(len(handlers), d.uuidParameter)+`)
+			AND checkpoint_offset <> 0
+			GROUP BY stream
+			HAVING COUNT(*) = $`+strconv.Itoa(len(args))+`
+		) AS g`,
+		args...,
+	)
+
+	var n uint64
+	err := row.Scan(&n)
+	return n, err
+}
+
+func (d *postgresDriver) QueryHandlers(
+	ctx context.Context,
+	db *sql.DB,
+) ([][]byte, error) {
+	rows, err := db.QueryContext(
+		ctx,
+		`SELECT DISTINCT `+d.uuidBytes("handler")+`
+		FROM `+d.checkpointTable+`
+		ORDER BY 1`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var handlers [][]byte
+
+	for rows.Next() {
+		var h []byte
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, h)
+	}
+
+	return handlers, rows.Err()
+}
+
+func (d *postgresDriver) StoreCheckpointOffset(
+	ctx context.Context,
+	tx *sql.Tx,
+	h, s []byte,
+	n uint64,
+) error {
+	if n == 0 {
+		// A stored offset of zero would prevent UpdateCheckpointOffset() from
+		// inserting the row when the stream's first event is handled.
+		_, err := tx.ExecContext(
+			ctx,
+			`DELETE FROM `+d.checkpointTable+`
+			WHERE handler = `+d.uuid("$1")+`
+			AND stream = `+d.uuid("$2")+``,
+			h,
+			s,
+		)
+		return err
+	}
+
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO `+d.checkpointTable+` (
+			handler,
+			stream,
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		) VALUES (
+			`+d.uuid("$1")+`,
+			`+d.uuid("$2")+`,
+			$3,
+			$4,
+			NULL
+		) ON CONFLICT (handler, stream) DO UPDATE SET
+			checkpoint_offset = EXCLUDED.checkpoint_offset,
+			updated_at = EXCLUDED.updated_at,
+			event_recorded_at = NULL`,
+		h,
+		s,
+		n,
+		time.Now(),
+	)
+	return err
+}
+
+func (d *postgresDriver) UpdateCheckpointOffset(
 	ctx context.Context,
 	tx *sql.Tx,
 	h, s []byte,
 	c, n uint64,
+	t time.Time,
 ) (bool, error) {
+	now := time.Now()
+
 	// If the "current" checkpoint offset is zero, we assumed it's correct and
 	// that there is no existing row for this handler/stream.
 	if c == 0 {
 		res, err := tx.ExecContext(
 			ctx,
-			`INSERT INTO projection.checkpoint (
+			`INSERT INTO `+d.checkpointTable+` (
 				handler,
 				stream,
-				checkpoint_offset
+				checkpoint_offset,
+				updated_at,
+				event_recorded_at
 			) VALUES (
-				projection.bytea_to_uuid($1),
-				projection.bytea_to_uuid($2),
-				$3
+				`+d.uuid("$1")+`,
+				`+d.uuid("$2")+`,
+				$3,
+				$4,
+				$5
 			) ON CONFLICT DO NOTHING`,
 			h,
 			s,
 			n,
+			now,
+			nullTime(t),
 		)
 		if err != nil {
 			return false, err
@@ -125,12 +692,16 @@ func (postgresDriver) UpdateCheckpointOffset(
 	// Otherwise we simply update the existing row.
 	res, err = tx.ExecContext(
 		ctx,
-		`UPDATE projection.checkpoint SET
-			checkpoint_offset = $1
-		WHERE handler = projection.bytea_to_uuid($2)
-		AND stream = projection.bytea_to_uuid($3)
-		AND checkpoint_offset = $4`,
+		`UPDATE `+d.checkpointTable+` SET
+			checkpoint_offset = $1,
+			updated_at = $2,
+			event_recorded_at = $3
+		WHERE handler = `+d.uuid("$4")+`
+		AND stream = `+d.uuid("$5")+`
+		AND checkpoint_offset = $6`,
 		n,
+		now,
+		nullTime(t),
 		h,
 		s,
 		c,
@@ -146,16 +717,58 @@ func (postgresDriver) UpdateCheckpointOffset(
 
 // DeleteCheckpointOffsets deletes all checkpoint offsets for a specific
 // handler.
-func (postgresDriver) DeleteCheckpointOffsets(
+func (d *postgresDriver) DeleteCheckpointOffsets(
 	ctx context.Context,
 	tx *sql.Tx,
 	h []byte,
 ) error {
 	_, err := tx.ExecContext(
 		ctx,
-		`DELETE FROM projection.checkpoint
-		WHERE handler = $1`,
+		`DELETE FROM `+d.checkpointTable+`
+		WHERE handler = `+d.uuid("$1"),
 		h,
 	)
 	return err
 }
+
+// TruncateTables removes all rows from the given tables within tx.
+func (d *postgresDriver) TruncateTables(
+	ctx context.Context,
+	tx *sql.Tx,
+	tables []string,
+) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`TRUNCATE TABLE `+strings.Join(tables, ", "),
+	)
+	return err
+}
+
+// IsRetryableError returns true if err is a "serialization failure" (SQLSTATE
+// 40001) or "deadlock detected" (SQLSTATE 40P01) error.
+//
+// It supports any underlying Go SQL driver that exposes the SQLSTATE via a
+// SQLState() method, as does pgx.
+func (d *postgresDriver) IsRetryableError(err error) bool {
+	var x interface{ SQLState() string }
+	if !errors.As(err, &x) {
+		return false
+	}
+
+	switch x.SQLState() {
+	case "40001", "40P01":
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *postgresDriver) Dialect() Dialect {
+	return postgresDialect{}
+}
+
+// quotePostgresIdentifier returns name quoted for use as an identifier in a
+// PostgreSQL query.
+func quotePostgresIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -2,13 +2,37 @@ package sqlprojection_test
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"testing"
 
 	. "github.com/dogmatiq/projectionkit/sqlprojection"
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 )
 
+// postgresBaselineSchema is the schema created by the original, unversioned
+// release of the PostgreSQL driver.
+var postgresBaselineSchema = []string{
+	`CREATE SCHEMA IF NOT EXISTS projection`,
+	`CREATE OR REPLACE FUNCTION projection.bytea_to_uuid (BYTEA) RETURNS UUID AS $$
+		SELECT ENCODE($1, 'hex')::UUID;
+	$$ LANGUAGE SQL IMMUTABLE`,
+	`CREATE TABLE IF NOT EXISTS projection.checkpoint (
+		handler           UUID NOT NULL,
+		stream            UUID NOT NULL,
+		checkpoint_offset BIGINT NOT NULL,
+
+		PRIMARY KEY (handler, stream)
+	)`,
+}
+
+// postgresBaselineInsert inserts a checkpoint into [postgresBaselineSchema].
+const postgresBaselineInsert = `INSERT INTO projection.checkpoint
+	(handler, stream, checkpoint_offset)
+	VALUES (projection.bytea_to_uuid($1), projection.bytea_to_uuid($2), $3)`
+
 func TestPostgresDriver(t *testing.T) {
 	t.Parallel()
 
@@ -36,5 +60,148 @@ func TestPostgresDriver(t *testing.T) {
 		t,
 		"pgx", dsn,
 		PostgresDriver,
+		`SHOW transaction_isolation`,
+	)
+
+	testBaselineMigration(
+		t,
+		"pgx", dsn,
+		PostgresDriver,
+		postgresBaselineSchema,
+		postgresBaselineInsert,
 	)
+
+	t.Run("with custom schema and table names", func(t *testing.T) {
+		runTests(
+			t,
+			"pgx", dsn,
+			NewPostgresDriver(
+				WithPostgresSchema("app-projection"),
+				WithPostgresTable(`app "checkpoint"`),
+			),
+			`SHOW transaction_isolation`,
+		)
+	})
+
+	t.Run("with partitioning", func(t *testing.T) {
+		driver := NewPostgresDriver(
+			WithPostgresTable("partitioned_checkpoint"),
+			WithPostgresPartitions(4),
+		)
+
+		runTests(
+			t,
+			"pgx", dsn,
+			driver,
+			`SHOW transaction_isolation`,
+		)
+
+		t.Run("it creates the partitions", func(t *testing.T) {
+			db, err := sql.Open("pgx", dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			if err := driver.CreateSchema(t.Context(), db); err != nil {
+				t.Fatal(err)
+			}
+			defer driver.DropSchema(context.Background(), db) // nolint:errcheck
+
+			var count int
+			if err := db.QueryRowContext(
+				t.Context(),
+				`SELECT COUNT(*)
+				FROM pg_inherits
+				WHERE inhparent = 'projection.partitioned_checkpoint'::regclass`,
+			).Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+
+			if count != 4 {
+				t.Fatalf("unexpected number of partitions: got %d, want 4", count)
+			}
+		})
+	})
+}
+
+func TestPostgresDriver_IsRetryableError(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Desc string
+		Err  error
+		Want bool
+	}{
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock detected", &pgconn.PgError{Code: "40P01"}, true},
+		{"wrapped serialization failure", fmt.Errorf("<wrapped>: %w", &pgconn.PgError{Code: "40001"}), true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"other error", fmt.Errorf("<error>"), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Desc, func(t *testing.T) {
+			for _, d := range []Driver{PostgresDriver, CockroachDriver} {
+				if got := d.IsRetryableError(c.Err); got != c.Want {
+					t.Fatalf("unexpected result: got %t, want %t", got, c.Want)
+				}
+			}
+		})
+	}
+}
+
+func TestPostgresDriver_Dialect(t *testing.T) {
+	t.Parallel()
+
+	dialect := PostgresDriver.Dialect()
+
+	t.Run("func Rebind()", func(t *testing.T) {
+		cases := []struct {
+			Desc  string
+			Query string
+			Want  string
+		}{
+			{
+				"quoted string",
+				`SELECT * FROM t WHERE x = ? AND y = '?'`,
+				`SELECT * FROM t WHERE x = $1 AND y = '?'`,
+			},
+			{
+				"dollar-quoted string",
+				`SELECT $$a?b$$, ? FROM t`,
+				`SELECT $$a?b$$, $1 FROM t`,
+			},
+			{
+				"tagged dollar-quoted string",
+				`SELECT $fn$a?$$?$fn$, ? FROM t`,
+				`SELECT $fn$a?$$?$fn$, $1 FROM t`,
+			},
+			{
+				"identifier containing a dollar sign",
+				`SELECT a$b$ FROM t WHERE x = ?`,
+				`SELECT a$b$ FROM t WHERE x = $1`,
+			},
+		}
+
+		for _, c := range cases {
+			t.Run(c.Desc, func(t *testing.T) {
+				if got := dialect.Rebind(c.Query); got != c.Want {
+					t.Fatalf("unexpected query: got %q, want %q", got, c.Want)
+				}
+			})
+		}
+	})
+
+	t.Run("func Upsert()", func(t *testing.T) {
+		t.Run("it panics if there are no key columns", func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+
+			dialect.Upsert("t", nil, "value")
+		})
+	})
 }
@@ -0,0 +1,168 @@
+package sqlprojection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/dogmatiq/dogma"
+)
+
+// TableOwner is an optional interface that may be implemented by a
+// [MessageHandler] to declare the tables that contain all of its projection
+// data.
+//
+// When a handler that implements TableOwner is reset, the adaptor truncates
+// its tables instead of calling its Reset method, which avoids deleting a
+// potentially large number of rows within a single statement. A handler that
+// implements TableOwner must not embed [NoResetBehavior], as it would have no
+// effect; [New] and [NewGroup] panic if it does.
+//
+// On PostgreSQL, CockroachDB, SQL Server and SQLite, the tables are truncated
+// within the same transaction that deletes the checkpoint offsets. MySQL
+// implicitly commits the transaction when a table is truncated, so the
+// checkpoint offsets are deleted and committed first, and the tables are
+// truncated afterwards. If the reset fails after the checkpoint offsets have
+// been deleted, the engine must retry the reset, which is safe to repeat. The
+// handler should not handle events while it's being reset.
+//
+// The tables must not be referenced by foreign keys in other tables.
+type TableOwner interface {
+	// Tables returns the names of the tables that contain the projection's
+	// data.
+	//
+	// Each name consists of one or more identifiers separated by dots, such as
+	// a table name qualified by its schema. Each identifier is either a plain
+	// identifier consisting of letters, digits, underscores and dollar signs,
+	// or is quoted by [Dialect.QuoteIdentifier]. The reset fails if any name
+	// is not in this form.
+	Tables() []string
+}
+
+// tableTruncater is an optional interface implemented by drivers that can
+// remove all rows from a table within a transaction more efficiently than by
+// deleting them.
+type tableTruncater interface {
+	// TruncateTables removes all rows from the given tables within tx.
+	TruncateTables(
+		ctx context.Context,
+		tx *sql.Tx,
+		tables []string,
+	) error
+}
+
+// nonTransactionalTableTruncater is an optional interface implemented by
+// drivers that can only remove all rows from a table outside of a
+// transaction.
+type nonTransactionalTableTruncater interface {
+	// TruncateTablesNonTransactionally removes all rows from the given tables
+	// using db.
+	TruncateTablesNonTransactionally(
+		ctx context.Context,
+		db *sql.DB,
+		tables []string,
+	) error
+}
+
+// resetData resets the projection data of h within tx.
+//
+// If the data can not be reset within tx, it returns a non-nil function that
+// resets the data, which must be called after tx has been committed.
+func resetData(
+	ctx context.Context,
+	db *sql.DB,
+	d Driver,
+	tx *sql.Tx,
+	h MessageHandler,
+	s dogma.ProjectionResetScope,
+) (func(context.Context) error, error) {
+	o, ok := h.(TableOwner)
+	if !ok {
+		return nil, h.Reset(ctx, tx, s)
+	}
+
+	tables := o.Tables()
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	for _, t := range tables {
+		if !isValidTableName(t) {
+			return nil, fmt.Errorf("invalid table name: %q", t)
+		}
+	}
+
+	switch t := d.(type) {
+	case tableTruncater:
+		return nil, t.TruncateTables(ctx, tx, tables)
+	case nonTransactionalTableTruncater:
+		return func(ctx context.Context) error {
+			return t.TruncateTablesNonTransactionally(ctx, db, tables)
+		}, nil
+	default:
+		return nil, deleteFromTables(ctx, tx, tables)
+	}
+}
+
+// deleteFromTables removes all rows from the given tables using unqualified
+// DELETE statements within tx.
+func deleteFromTables(ctx context.Context, tx *sql.Tx, tables []string) error {
+	for _, t := range tables {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableNamePattern matches a table name in the form described by
+// [TableOwner.Tables].
+var tableNamePattern = regexp.MustCompile(
+	`^` + identifierPattern + `(?:\.` + identifierPattern + `)*$`,
+)
+
+// identifierPattern matches a single identifier that is either unquoted, or
+// quoted using double quotes, backticks or square brackets.
+const identifierPattern = `(?:` +
+	`[A-Za-z_][A-Za-z0-9_$]*|` +
+	`"(?:[^"]|"")+"|` +
+	"`(?:[^`]|``)+`|" +
+	`\[(?:[^\]]|\]\])+\]` +
+	`)`
+
+// isValidTableName returns true if name is in the form described by
+// [TableOwner.Tables].
+func isValidTableName(name string) bool {
+	return tableNamePattern.MatchString(name)
+}
+
+// checkTableOwner panics if h implements [TableOwner] but embeds
+// [NoResetBehavior].
+func checkTableOwner(h MessageHandler) {
+	if _, ok := h.(TableOwner); !ok {
+		return
+	}
+
+	t := reflect.TypeOf(h)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	noReset := reflect.TypeFor[NoResetBehavior]()
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.Anonymous && (f.Type == noReset || f.Type == reflect.PointerTo(noReset)) {
+			panic(fmt.Sprintf(
+				"%s implements sqlprojection.TableOwner, which is incompatible with sqlprojection.NoResetBehavior",
+				reflect.TypeOf(h),
+			))
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package sqlprojection
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// WithRetry is an [Option] that sets the policy used to retry transactions
+// that fail with an error that the [Driver] considers retryable, such as a
+// serialization failure or deadlock.
+//
+// maxAttempts is the maximum number of times a transaction is attempted,
+// including the first attempt. Each retry is delayed by an exponentially
+// increasing, randomized duration, starting at minBackoff and limited to
+// maxBackoff.
+//
+// A transaction is never retried after the checkpoint offset provided by the
+// engine is found to be stale, as there is no way for it to succeed.
+//
+// By default, transactions are attempted up to 10 times, with a backoff of
+// between 10 milliseconds and 1 second. The policy also applies to the
+// transactions used to commit batches; see [WithBatching].
+func WithRetry(maxAttempts int, minBackoff, maxBackoff time.Duration) Option {
+	if maxAttempts <= 0 {
+		panic("maximum attempts must be positive")
+	}
+
+	if minBackoff < 0 {
+		panic("minimum backoff must not be negative")
+	}
+
+	if maxBackoff < minBackoff {
+		panic("maximum backoff must not be less than the minimum backoff")
+	}
+
+	return func(a *adaptor) {
+		a.Retry = retryPolicy{maxAttempts, minBackoff, maxBackoff}
+	}
+}
+
+// retryPolicy describes how transactions are retried.
+type retryPolicy struct {
+	MaxAttempts            int
+	MinBackoff, MaxBackoff time.Duration
+}
+
+// defaultRetryPolicy is the retry policy used when none is specified.
+var defaultRetryPolicy = retryPolicy{
+	MaxAttempts: 10,
+	MinBackoff:  10 * time.Millisecond,
+	MaxBackoff:  1 * time.Second,
+}
+
+// Do calls fn until it succeeds, fails with an error that d does not consider
+// retryable, or has been attempted p.MaxAttempts times.
+func (p retryPolicy) Do(
+	ctx context.Context,
+	d Driver,
+	fn func(ctx context.Context) error,
+) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+
+		if err == nil || attempt >= p.MaxAttempts || !d.IsRetryableError(err) {
+			return err
+		}
+
+		if err := sleep(ctx, p.backoff(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+// backoff returns the delay before the retry that follows the given attempt.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	for range attempt - 1 {
+		if d >= p.MaxBackoff/2 {
+			d = p.MaxBackoff
+			break
+		}
+		d *= 2
+	}
+
+	d = min(d, p.MaxBackoff)
+
+	// Randomize the delay between half and all of the computed value so that
+	// conflicting transactions are less likely to conflict again.
+	if half := d / 2; half > 0 {
+		d = half + rand.N(half+1)
+	}
+
+	return d
+}
+
+// sleep blocks until d has elapsed or ctx is canceled.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -3,36 +3,247 @@ package sqlprojection
 import (
 	"context"
 	"database/sql"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dogmatiq/projectionkit"
 )
 
 // SQLiteDriver is Driver for SQLite.
 //
 // This driver should work with any underlying Go SQL driver that supports
-// SQLite v3 compatible databases and $1-style placeholders.
-var SQLiteDriver Driver = sqliteDriver{}
+// SQLite v3 compatible databases and ?-style placeholders. It's tested with
+// both github.com/mattn/go-sqlite3, which requires cgo, and the pure-Go
+// modernc.org/sqlite.
+//
+// Unlike github.com/mattn/go-sqlite3, modernc.org/sqlite does not wait for
+// locks held by other connections to be released by default. Set a busy
+// timeout, for example by adding "_pragma=busy_timeout(5000)" to the DSN, to
+// avoid SQLITE_BUSY errors when events are handled concurrently.
+//
+// It stores checkpoint offsets in the "projection_checkpoint" table. Use
+// [NewSQLiteDriver] to use a different name.
+var SQLiteDriver Driver = NewSQLiteDriver()
 
-type sqliteDriver struct{}
+// NewSQLiteDriver returns a new Driver for SQLite.
+//
+// This driver should work with any underlying Go SQL driver that supports
+// SQLite v3 compatible databases and ?-style placeholders.
+func NewSQLiteDriver(options ...SQLiteOption) Driver {
+	d := &sqliteDriver{
+		table: "projection_checkpoint",
+	}
 
-func (sqliteDriver) CreateSchema(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(
-		ctx,
-		`CREATE TABLE IF NOT EXISTS projection_checkpoint (
-			handler           BINARY NOT NULL,
-			stream 	          BINARY NOT NULL,
-			checkpoint_offset INTEGER NULL NULL,
+	for _, opt := range options {
+		opt(d)
+	}
 
-			PRIMARY KEY (handler, stream)
+	d.checkpointTable = quoteSQLiteIdentifier(d.table)
+
+	d.versions = versionTable{
+		Exists: `SELECT EXISTS (
+			SELECT 1
+			FROM sqlite_master
+			WHERE type = 'table'
+			AND name = ?
 		)`,
-	)
-	return err
+		ExistsArgs: []any{d.table + "_version"},
+		Create: `CREATE TABLE IF NOT EXISTS ` + quoteSQLiteIdentifier(d.table+"_version") + ` (
+			version INTEGER NOT NULL PRIMARY KEY
+		)`,
+		Select: `SELECT COALESCE(MAX(version), 0) FROM ` + quoteSQLiteIdentifier(d.table+"_version"),
+		Insert: `INSERT INTO ` + quoteSQLiteIdentifier(d.table+"_version") + ` (version) VALUES (?)`,
+	}
+
+	return d
+}
+
+// SQLiteOption is a functional option that changes the behavior of
+// [NewSQLiteDriver].
+type SQLiteOption func(*sqliteDriver)
+
+// WithSQLiteTable is a [SQLiteOption] that sets the name of the table used to
+// store checkpoint offsets.
+func WithSQLiteTable(name string) SQLiteOption {
+	if name == "" {
+		panic("table name must not be empty")
+	}
+
+	return func(d *sqliteDriver) {
+		d.table = name
+	}
+}
+
+// WithSQLiteWAL is a [SQLiteOption] that enables SQLite's write-ahead log when
+// the schema is created or migrated.
+//
+// The journal mode is a persistent property of the database file, so it
+// remains in effect for all connections, including those opened by other
+// processes. In WAL mode, readers do not block writers and writers do not
+// block readers.
+func WithSQLiteWAL() SQLiteOption {
+	return func(d *sqliteDriver) {
+		d.wal = true
+	}
+}
+
+// WithSQLiteBusyTimeout is a [SQLiteOption] that sets the amount of time that
+// SQLite waits for another connection to release a lock before failing with
+// SQLITE_BUSY.
+//
+// The timeout is a property of each connection, so it's set when the schema is
+// created, migrated or dropped, and at the start of each transaction begun by
+// the adaptor.
+func WithSQLiteBusyTimeout(d time.Duration) SQLiteOption {
+	if d < 0 {
+		panic("busy timeout must not be negative")
+	}
+
+	return func(x *sqliteDriver) {
+		x.busyTimeout = d
+	}
+}
+
+// WithSQLiteSingleWriter is a [SQLiteOption] that serializes the transactions
+// begun by the adaptor within the current process, such that concurrent calls
+// to HandleEvent or Reset wait for each other instead of contending on
+// SQLite's write lock.
+//
+// Each transaction acquires the database's write lock as soon as it begins,
+// as per BEGIN IMMEDIATE, so it can not fail with SQLITE_BUSY part-way through.
+//
+// Transactions are serialized across all adaptors that use the same driver,
+// so a single driver should be shared by all of the adaptors that write to the
+// same database. Writers in other processes are not affected; use
+// [WithSQLiteBusyTimeout] to wait for them.
+//
+// When used with [WithBatching], each batch holds the lock until it's
+// committed, so events from other streams wait for up to the maximum batch
+// latency.
+func WithSQLiteSingleWriter() SQLiteOption {
+	return func(d *sqliteDriver) {
+		d.writer = make(chan struct{}, 1)
+	}
+}
+
+type sqliteDriver struct {
+	table string
+
+	// wal indicates that the write-ahead log is enabled when the schema is
+	// created or migrated.
+	wal bool
+
+	// busyTimeout is the amount of time to wait for locks held by other
+	// connections. Zero means the underlying driver's default is used.
+	busyTimeout time.Duration
+
+	// writer is a semaphore used to serialize the transactions begun by the
+	// adaptor. It's nil if transactions are not serialized.
+	writer chan struct{}
+
+	// checkpointTable is the quoted name of the checkpoint table.
+	checkpointTable string
+
+	// versions describes the table that records the applied migrations.
+	versions versionTable
 }
 
-func (sqliteDriver) DropSchema(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(ctx, `DROP TABLE IF EXISTS projection_checkpoint`)
+func (d *sqliteDriver) CreateSchema(ctx context.Context, db *sql.DB) error {
+	return d.MigrateSchema(ctx, db)
+}
+
+func (d *sqliteDriver) MigrateSchema(ctx context.Context, db *sql.DB) (err error) {
+	// We use an "immediate" transaction, which acquires the database's write
+	// lock up-front, to prevent concurrent migrations. The database/sql
+	// package provides no way to start such a transaction, so we issue the
+	// statements manually on a dedicated connection.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := d.setPragmas(ctx, conn); err != nil {
+		return err
+	}
+
+	if d.wal {
+		// The journal mode can not be changed within a transaction.
+		if _, err := conn.ExecContext(ctx, `PRAGMA journal_mode = WAL`); err != nil {
+			return err
+		}
+	}
+
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			conn.ExecContext(context.WithoutCancel(ctx), `ROLLBACK`) // nolint:errcheck
+		}
+	}()
+
+	if err := migrate(ctx, conn, d.versions, d.migrations()); err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `COMMIT`)
 	return err
 }
 
-func (sqliteDriver) QueryCheckpointOffset(
+func (d *sqliteDriver) SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	return schemaVersion(ctx, db, d.versions)
+}
+
+// migrations returns the migrations that produce the latest version of the
+// driver's schema.
+func (d *sqliteDriver) migrations() []migration {
+	return []migration{
+		exec(
+			`CREATE TABLE IF NOT EXISTS ` + d.checkpointTable + ` (
+				handler           BINARY NOT NULL,
+				stream 	          BINARY NOT NULL,
+				checkpoint_offset INTEGER NULL NULL,
+
+				PRIMARY KEY (handler, stream)
+			)`,
+		),
+		// The timestamps are stored as the number of nanoseconds since the
+		// Unix epoch. SQLite does not support adding multiple columns in a
+		// single statement.
+		exec(`ALTER TABLE ` + d.checkpointTable + ` ADD COLUMN updated_at INTEGER NULL`),
+		exec(`ALTER TABLE ` + d.checkpointTable + ` ADD COLUMN event_recorded_at INTEGER NULL`),
+	}
+}
+
+func (d *sqliteDriver) DropSchema(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := d.setPragmas(ctx, conn); err != nil {
+		return err
+	}
+
+	// SQLite does not support dropping multiple tables in a single statement.
+	for _, table := range []string{
+		d.checkpointTable,
+		quoteSQLiteIdentifier(d.table + "_version"),
+	} {
+		if _, err := conn.ExecContext(ctx, `DROP TABLE IF EXISTS `+table); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *sqliteDriver) QueryCheckpointOffset(
 	ctx context.Context,
 	db *sql.DB,
 	h, s []byte,
@@ -40,7 +251,7 @@ func (sqliteDriver) QueryCheckpointOffset(
 	row := db.QueryRowContext(
 		ctx,
 		`SELECT checkpoint_offset
-		FROM projection_checkpoint
+		FROM `+d.checkpointTable+`
 		WHERE handler = ?
 		AND stream = ?`,
 		h,
@@ -57,22 +268,303 @@ func (sqliteDriver) QueryCheckpointOffset(
 	return cp, err
 }
 
-func (sqliteDriver) UpdateCheckpointOffset(
+func (d *sqliteDriver) QueryCheckpoint(
+	ctx context.Context,
+	db *sql.DB,
+	h, s []byte,
+) (projectionkit.Checkpoint, error) {
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		FROM `+d.checkpointTable+`
+		WHERE handler = ?
+		AND stream = ?`,
+		h,
+		s,
+	)
+
+	cp := projectionkit.Checkpoint{
+		StreamID: streamIDString(s),
+	}
+
+	var updatedAt, recordedAt sql.NullInt64
+	err := row.Scan(&cp.Offset, &updatedAt, &recordedAt)
+
+	if err == sql.ErrNoRows {
+		return cp, nil
+	}
+
+	cp.UpdatedAt = fromNullUnixNano(updatedAt)
+	cp.EventRecordedAt = fromNullUnixNano(recordedAt)
+
+	return cp, err
+}
+
+func (d *sqliteDriver) QueryCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	h, after []byte,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	query := `SELECT
+			stream,
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		FROM ` + d.checkpointTable + `
+		WHERE handler = ?`
+	args := []any{h}
+
+	if after != nil {
+		query += ` AND stream > ?`
+		args = append(args, after)
+	}
+
+	query += ` ORDER BY stream LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []projectionkit.Checkpoint
+
+	for rows.Next() {
+		var (
+			cp                    projectionkit.Checkpoint
+			stream                []byte
+			updatedAt, recordedAt sql.NullInt64
+		)
+
+		if err := rows.Scan(
+			&stream,
+			&cp.Offset,
+			&updatedAt,
+			&recordedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		cp.StreamID = streamIDString(stream)
+		cp.UpdatedAt = fromNullUnixNano(updatedAt)
+		cp.EventRecordedAt = fromNullUnixNano(recordedAt)
+		checkpoints = append(checkpoints, cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+func (d *sqliteDriver) CountCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	h []byte,
+) (uint64, error) {
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*)
+		FROM `+d.checkpointTable+`
+		WHERE handler = ?`,
+		h,
+	)
+
+	var n uint64
+	err := row.Scan(&n)
+	return n, err
+}
+
+func (d *sqliteDriver) QueryGroupCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	handlers [][]byte,
+	after []byte,
+	limit int,
+) ([]projectionkit.Checkpoint, error) {
+	args := make([]any, 0, len(handlers)+3)
+	for _, h := range handlers {
+		args = append(args, h)
+	}
+
+	query := `SELECT
+			stream,
+			MIN(checkpoint_offset),
+			MIN(updated_at),
+			MIN(event_recorded_at)
+		FROM ` + d.checkpointTable + `
+		WHERE handler IN (` + parameterList(len(handlers), func(int) string { return "?" }) + `)
+		AND checkpoint_offset <> 0`
+
+	if after != nil {
+		query += ` AND stream > ?`
+		args = append(args, after)
+	}
+
+	query += ` GROUP BY stream HAVING COUNT(*) = ? ORDER BY stream LIMIT ?`
+	args = append(args, len(handlers), limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []projectionkit.Checkpoint
+
+	for rows.Next() {
+		var (
+			cp                    projectionkit.Checkpoint
+			stream                []byte
+			updatedAt, recordedAt sql.NullInt64
+		)
+
+		if err := rows.Scan(
+			&stream,
+			&cp.Offset,
+			&updatedAt,
+			&recordedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		cp.StreamID = streamIDString(stream)
+		cp.UpdatedAt = fromNullUnixNano(updatedAt)
+		cp.EventRecordedAt = fromNullUnixNano(recordedAt)
+		checkpoints = append(checkpoints, cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+func (d *sqliteDriver) CountGroupCheckpoints(
+	ctx context.Context,
+	db *sql.DB,
+	handlers [][]byte,
+) (uint64, error) {
+	args := make([]any, 0, len(handlers)+1)
+	for _, h := range handlers {
+		args = append(args, h)
+	}
+	args = append(args, len(handlers))
+
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM (
+			SELECT stream
+			FROM `+d.checkpointTable+`
+			WHERE handler IN (`+parameterList(len(handlers), func(int) string { return "?" })+`)
+			AND checkpoint_offset <> 0
+			GROUP BY stream
+			HAVING COUNT(*) = ?
+		) AS g`,
+		args...,
+	)
+
+	var n uint64
+	err := row.Scan(&n)
+	return n, err
+}
+
+func (d *sqliteDriver) QueryHandlers(
+	ctx context.Context,
+	db *sql.DB,
+) ([][]byte, error) {
+	rows, err := db.QueryContext(
+		ctx,
+		`SELECT DISTINCT handler
+		FROM `+d.checkpointTable+`
+		ORDER BY handler`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var handlers [][]byte
+
+	for rows.Next() {
+		var h []byte
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, h)
+	}
+
+	return handlers, rows.Err()
+}
+
+func (d *sqliteDriver) StoreCheckpointOffset(
+	ctx context.Context,
+	tx *sql.Tx,
+	h, s []byte,
+	n uint64,
+) error {
+	if n == 0 {
+		// A stored offset of zero would prevent UpdateCheckpointOffset() from
+		// inserting the row when the stream's first event is handled.
+		_, err := tx.ExecContext(
+			ctx,
+			`DELETE FROM `+d.checkpointTable+`
+			WHERE handler = ?
+			AND stream = ?`,
+			h,
+			s,
+		)
+		return err
+	}
+
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO `+d.checkpointTable+` (
+			handler,
+			stream,
+			checkpoint_offset,
+			updated_at,
+			event_recorded_at
+		) VALUES (
+			?,
+			?,
+			?,
+			?,
+			NULL
+		) ON CONFLICT (handler, stream) DO UPDATE SET
+			checkpoint_offset = excluded.checkpoint_offset,
+			updated_at = excluded.updated_at,
+			event_recorded_at = NULL`,
+		h,
+		s,
+		n,
+		nullUnixNano(time.Now()),
+	)
+	return err
+}
+
+func (d *sqliteDriver) UpdateCheckpointOffset(
 	ctx context.Context,
 	tx *sql.Tx,
 	h, s []byte,
 	c, n uint64,
+	t time.Time,
 ) (bool, error) {
+	now := time.Now()
+
 	// If the "current" checkpoint offset is zero, we assumed it's correct and
 	// that there is no existing row for this handler/stream.
 	if c == 0 {
 		res, err := tx.ExecContext(
 			ctx,
-			`INSERT INTO projection_checkpoint (
+			`INSERT INTO `+d.checkpointTable+` (
 				handler,
 				stream,
-				checkpoint_offset
+				checkpoint_offset,
+				updated_at,
+				event_recorded_at
 			) VALUES (
+				?,
+				?,
 				?,
 				?,
 				?
@@ -80,6 +572,8 @@ func (sqliteDriver) UpdateCheckpointOffset(
 			h,
 			s,
 			n,
+			nullUnixNano(now),
+			nullUnixNano(t),
 		)
 		if err != nil {
 			return false, err
@@ -98,12 +592,16 @@ func (sqliteDriver) UpdateCheckpointOffset(
 	// Otherwise we simply update the existing row.
 	res, err = tx.ExecContext(
 		ctx,
-		`UPDATE projection_checkpoint SET
-			checkpoint_offset = ?
+		`UPDATE `+d.checkpointTable+` SET
+			checkpoint_offset = ?,
+			updated_at = ?,
+			event_recorded_at = ?
 		WHERE handler = ?
 		AND stream = ?
 		AND checkpoint_offset = ?`,
 		n,
+		nullUnixNano(now),
+		nullUnixNano(t),
 		h,
 		s,
 		c,
@@ -117,16 +615,166 @@ func (sqliteDriver) UpdateCheckpointOffset(
 	return count != 0, err
 }
 
-func (sqliteDriver) DeleteCheckpointOffsets(
+func (d *sqliteDriver) DeleteCheckpointOffsets(
 	ctx context.Context,
 	tx *sql.Tx,
 	h []byte,
 ) error {
 	_, err := tx.ExecContext(
 		ctx,
-		`DELETE FROM projection_checkpoint
+		`DELETE FROM `+d.checkpointTable+`
 		WHERE handler = ?`,
 		h,
 	)
 	return err
 }
+
+// IsRetryableError returns true if err indicates that the database, or a table
+// within it, was locked by another connection.
+func (d *sqliteDriver) IsRetryableError(err error) bool {
+	code, ok := sqliteErrorCode(err)
+	if !ok {
+		return false
+	}
+
+	// Extended result codes, such as SQLITE_BUSY_SNAPSHOT, hold the primary
+	// result code in their least significant 8 bits.
+	switch code & 0xff {
+	case sqliteBusy, sqliteLocked:
+		return true
+	default:
+		return false
+	}
+}
+
+const (
+	// sqliteBusy is the SQLITE_BUSY result code, which indicates that the
+	// database file is locked by another connection.
+	sqliteBusy = 5
+
+	// sqliteLocked is the SQLITE_LOCKED result code, which indicates that a
+	// table is locked by another connection that shares the same cache.
+	sqliteLocked = 6
+)
+
+// sqliteErrorCode returns the SQLite result code of the first error in err's
+// tree that has one.
+//
+// The result code is read from a Code() method, as provided by
+// modernc.org/sqlite, or from an integer field named Code, as provided by
+// github.com/mattn/go-sqlite3. This avoids importing a specific driver package,
+// which would register the driver with database/sql for every user of this
+// package.
+func sqliteErrorCode(err error) (int64, bool) {
+	if err == nil {
+		return 0, false
+	}
+
+	if x, ok := err.(interface{ Code() int }); ok {
+		return int64(x.Code()), true
+	}
+
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct {
+		if f := v.FieldByName("Code"); f.IsValid() && f.CanInt() {
+			return f.Int(), true
+		}
+	}
+
+	switch x := err.(type) {
+	case interface{ Unwrap() error }:
+		return sqliteErrorCode(x.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, err := range x.Unwrap() {
+			if n, ok := sqliteErrorCode(err); ok {
+				return n, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// BeginTx begins a transaction on behalf of the adaptor.
+//
+// If the driver is configured as a single writer, it waits for any other
+// transaction begun by the driver to finish, then acquires the database's write
+// lock immediately.
+func (d *sqliteDriver) BeginTx(
+	ctx context.Context,
+	db *sql.DB,
+	opts *sql.TxOptions,
+) (_ *sql.Tx, release func(), err error) {
+	release = func() {}
+
+	if d.writer != nil {
+		select {
+		case d.writer <- struct{}{}:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+
+		release = func() { <-d.writer }
+
+		defer func() {
+			if err != nil {
+				release()
+			}
+		}()
+	}
+
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := d.setPragmas(ctx, tx); err != nil {
+		tx.Rollback() // nolint:errcheck
+		return nil, nil, err
+	}
+
+	if d.writer != nil {
+		// The database/sql package has no way to begin an IMMEDIATE
+		// transaction, so we acquire the write lock with a statement that
+		// writes to the checkpoint table without modifying it.
+		if _, err := tx.ExecContext(
+			ctx,
+			`UPDATE `+d.checkpointTable+`
+			SET checkpoint_offset = checkpoint_offset
+			WHERE 0`,
+		); err != nil {
+			tx.Rollback() // nolint:errcheck
+			return nil, nil, err
+		}
+	}
+
+	return tx, release, nil
+}
+
+// setPragmas sets the connection-specific pragmas configured by the driver's
+// options.
+func (d *sqliteDriver) setPragmas(ctx context.Context, x execer) error {
+	if d.busyTimeout == 0 {
+		return nil
+	}
+
+	_, err := x.ExecContext(
+		ctx,
+		`PRAGMA busy_timeout = `+strconv.FormatInt(d.busyTimeout.Milliseconds(), 10),
+	)
+	return err
+}
+
+func (d *sqliteDriver) Dialect() Dialect {
+	return sqliteDialect{}
+}
+
+// quoteSQLiteIdentifier returns name quoted for use as an identifier in an
+// SQLite query.
+func quoteSQLiteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
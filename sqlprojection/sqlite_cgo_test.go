@@ -0,0 +1,44 @@
+//go:build cgo
+
+package sqlprojection_test
+
+import (
+	"testing"
+
+	. "github.com/dogmatiq/projectionkit/sqlprojection"
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	sqliteImplementations = append(
+		sqliteImplementations,
+		sqliteImplementation{
+			DriverName: "sqlite3",
+			DSN: func(file string) string {
+				return "file:" + file + "?mode=rwc"
+			},
+		},
+	)
+}
+
+func TestSQLiteDriver_IsRetryableError_mattn(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Desc string
+		Err  error
+		Want bool
+	}{
+		{"busy", sqlite3.Error{Code: sqlite3.ErrBusy}, true},
+		{"locked", sqlite3.Error{Code: sqlite3.ErrLocked}, true},
+		{"constraint violation", sqlite3.Error{Code: sqlite3.ErrConstraint}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Desc, func(t *testing.T) {
+			if got := SQLiteDriver.IsRetryableError(c.Err); got != c.Want {
+				t.Fatalf("unexpected result: got %t, want %t", got, c.Want)
+			}
+		})
+	}
+}
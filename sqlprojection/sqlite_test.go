@@ -1,26 +1,335 @@
 package sqlprojection_test
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/dogmatiq/dogma"
+	. "github.com/dogmatiq/enginekit/enginetest/stubs"
+	"github.com/dogmatiq/enginekit/protobuf/uuidpb"
+	"github.com/dogmatiq/projectionkit/projectiontest"
 	. "github.com/dogmatiq/projectionkit/sqlprojection"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/dogmatiq/projectionkit/sqlprojection/internal/fixtures"
+	_ "modernc.org/sqlite"
 )
 
+// sqliteImplementation describes a Go SQL driver that the SQLite driver is
+// tested against.
+type sqliteImplementation struct {
+	// DriverName is the name under which the Go SQL driver is registered.
+	DriverName string
+
+	// DSN returns the data source name used to open the database file with
+	// the given name.
+	DSN func(file string) string
+}
+
+// sqliteImplementations is the list of Go SQL drivers that the SQLite driver is
+// tested against.
+//
+// The pure-Go modernc.org/sqlite driver is always tested. The cgo-based
+// github.com/mattn/go-sqlite3 driver is added when cgo is enabled.
+var sqliteImplementations = []sqliteImplementation{
+	{
+		DriverName: "sqlite",
+		DSN: func(file string) string {
+			// Unlike github.com/mattn/go-sqlite3, modernc.org/sqlite does not
+			// wait for locks to be released by default.
+			return "file:" + file + "?mode=rwc&_pragma=busy_timeout(5000)"
+		},
+	},
+}
+
+// sqliteBaselineSchema is the schema created by the original, unversioned
+// release of the SQLite driver.
+var sqliteBaselineSchema = []string{
+	`CREATE TABLE IF NOT EXISTS projection_checkpoint (
+		handler           BINARY NOT NULL,
+		stream 	          BINARY NOT NULL,
+		checkpoint_offset INTEGER NULL NULL,
+
+		PRIMARY KEY (handler, stream)
+	)`,
+}
+
+// sqliteBaselineInsert inserts a checkpoint into [sqliteBaselineSchema].
+const sqliteBaselineInsert = `INSERT INTO projection_checkpoint
+	(handler, stream, checkpoint_offset)
+	VALUES (?, ?, ?)`
+
 func TestSQLiteDriver(t *testing.T) {
 	t.Parallel()
 
-	file, err := os.CreateTemp("", "")
-	if err != nil {
-		t.Fatal(err)
+	for _, impl := range sqliteImplementations {
+		t.Run(impl.DriverName, func(t *testing.T) {
+			t.Parallel()
+
+			file, err := os.CreateTemp("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+			os.Remove(file.Name())
+
+			runTests(
+				t,
+				impl.DriverName, impl.DSN(file.Name()),
+				SQLiteDriver,
+				"",
+			)
+
+			testBaselineMigration(
+				t,
+				impl.DriverName, impl.DSN(file.Name()),
+				SQLiteDriver,
+				sqliteBaselineSchema,
+				sqliteBaselineInsert,
+			)
+
+			t.Run("with a custom table name", func(t *testing.T) {
+				runTests(
+					t,
+					impl.DriverName, impl.DSN(file.Name()),
+					NewSQLiteDriver(
+						WithSQLiteTable(`app "checkpoint"`),
+					),
+					"",
+				)
+			})
+
+			t.Run("in single-writer mode", func(t *testing.T) {
+				file, err := os.CreateTemp("", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				file.Close()
+				os.Remove(file.Name())
+
+				// The DSN does not set a busy timeout, so SQLITE_BUSY errors
+				// are only avoided by the driver's options.
+				dsn := "file:" + file.Name() + "?mode=rwc"
+
+				driver := NewSQLiteDriver(
+					WithSQLiteWAL(),
+					WithSQLiteBusyTimeout(5*time.Second),
+					WithSQLiteSingleWriter(),
+				)
+
+				runTests(t, impl.DriverName, dsn, driver, "")
+
+				t.Run("it serializes concurrent transactions", func(t *testing.T) {
+					db, err := sql.Open(impl.DriverName, dsn)
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer db.Close()
+
+					// Without a busy timeout, concurrent transactions only
+					// succeed if they are serialized by the driver.
+					driver := NewSQLiteDriver(WithSQLiteSingleWriter())
+
+					if err := driver.CreateSchema(t.Context(), db); err != nil {
+						t.Fatal(err)
+					}
+					defer driver.DropSchema(context.Background(), db) // nolint:errcheck
+
+					adaptor := New(
+						db,
+						driver,
+						&fixtures.MessageHandler{
+							ConfigureFunc: func(c dogma.ProjectionConfigurer) {
+								c.Identity("<projection>", projectiontest.IdentityKey)
+							},
+						},
+					)
+
+					var g sync.WaitGroup
+
+					for range 10 {
+						streamID := uuidpb.Generate().AsString()
+
+						g.Go(func() {
+							cp, err := adaptor.HandleEvent(
+								t.Context(),
+								&ProjectionEventScopeStub{
+									StreamIDFunc: func() string { return streamID },
+								},
+								EventA1,
+							)
+							if err != nil {
+								t.Error(err)
+							} else if cp != 1 {
+								t.Errorf("unexpected checkpoint offset: got %d, want 1", cp)
+							}
+						})
+					}
+
+					g.Wait()
+				})
+
+				t.Run("it enables the write-ahead log", func(t *testing.T) {
+					db, err := sql.Open(impl.DriverName, dsn)
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer db.Close()
+
+					if err := driver.CreateSchema(t.Context(), db); err != nil {
+						t.Fatal(err)
+					}
+					defer driver.DropSchema(t.Context(), db) // nolint:errcheck
+
+					var mode string
+					if err := db.QueryRowContext(
+						t.Context(),
+						`PRAGMA journal_mode`,
+					).Scan(&mode); err != nil {
+						t.Fatal(err)
+					}
+
+					if mode != "wal" {
+						t.Fatalf("unexpected journal mode: got %q, want %q", mode, "wal")
+					}
+				})
+			})
+
+			t.Run("it stores identifiers as blobs", func(t *testing.T) {
+				db, err := sql.Open(impl.DriverName, impl.DSN(file.Name()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer db.Close()
+
+				driver := NewSQLiteDriver(WithSQLiteTable("blob_checkpoint"))
+
+				if err := driver.CreateSchema(t.Context(), db); err != nil {
+					t.Fatal(err)
+				}
+				defer driver.DropSchema(t.Context(), db) // nolint:errcheck
+
+				tx, err := db.BeginTx(t.Context(), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer tx.Rollback() // nolint:errcheck
+
+				h := []byte("<handler-key-16>")
+				s := []byte("<stream-id-16-b>")
+
+				if err := driver.StoreCheckpointOffset(t.Context(), tx, h, s, 1); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+
+				var handlerType, streamType string
+				if err := db.QueryRowContext(
+					t.Context(),
+					`SELECT typeof(handler), typeof(stream) FROM blob_checkpoint`,
+				).Scan(&handlerType, &streamType); err != nil {
+					t.Fatal(err)
+				}
+
+				if handlerType != "blob" || streamType != "blob" {
+					t.Fatalf("unexpected column types: got %q and %q, want blob", handlerType, streamType)
+				}
+
+				n, err := driver.QueryCheckpointOffset(t.Context(), db, h, s)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if n != 1 {
+					t.Fatalf("unexpected checkpoint offset: got %d, want 1", n)
+				}
+			})
+		})
+	}
+}
+
+func TestSQLiteDriver_IsRetryableError(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Desc string
+		Err  error
+		Want bool
+	}{
+		{"busy", sqliteError{5}, true},
+		{"busy snapshot", sqliteError{517}, true},
+		{"locked", sqliteError{6}, true},
+		{"locked shared cache", sqliteError{262}, true},
+		{"wrapped busy", fmt.Errorf("<wrapped>: %w", sqliteError{5}), true},
+		{"joined busy", errors.Join(errors.New("<error>"), sqliteError{5}), true},
+		{"constraint violation", sqliteError{19}, false},
+		{"other error", errors.New("<error>"), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Desc, func(t *testing.T) {
+			if got := SQLiteDriver.IsRetryableError(c.Err); got != c.Want {
+				t.Fatalf("unexpected result: got %t, want %t", got, c.Want)
+			}
+		})
 	}
-	file.Close()
-	os.Remove(file.Name())
-
-	runTests(
-		t,
-		"sqlite3", "file:"+file.Name()+"?mode=rwc",
-		SQLiteDriver,
-	)
+
+	t.Run("it returns true for a busy error returned by the database", func(t *testing.T) {
+		file, err := os.CreateTemp("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		defer os.Remove(file.Name())
+
+		// The DSN does not set a busy timeout, so the second writer fails
+		// immediately.
+		db, err := sql.Open("sqlite", "file:"+file.Name()+"?mode=rwc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		writer, err := db.Conn(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer writer.Close()
+
+		if _, err := writer.ExecContext(t.Context(), `BEGIN IMMEDIATE`); err != nil {
+			t.Fatal(err)
+		}
+		defer writer.ExecContext(context.Background(), `ROLLBACK`) // nolint:errcheck
+
+		conn, err := db.Conn(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		_, err = conn.ExecContext(t.Context(), `BEGIN IMMEDIATE`)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		if !SQLiteDriver.IsRetryableError(err) {
+			t.Fatalf("expected %q to be retryable", err)
+		}
+	})
 }
+
+// sqliteError is an error with an SQLite result code, exposed in the same way
+// as by modernc.org/sqlite.
+type sqliteError struct {
+	code int
+}
+
+func (e sqliteError) Error() string { return fmt.Sprintf("sqlite error %d", e.code) }
+func (e sqliteError) Code() int     { return e.code }
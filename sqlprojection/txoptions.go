@@ -0,0 +1,59 @@
+package sqlprojection
+
+import (
+	"database/sql"
+
+	"github.com/dogmatiq/dogma"
+)
+
+// WithTxOptions is an [Option] that sets the options used to begin the
+// transactions in which events are handled and the projection is reset.
+//
+// It is typically used to choose a specific isolation level. The transaction
+// is used to update the checkpoint offset, so it must not be read-only.
+//
+// By default, transactions are started with the database's default options.
+func WithTxOptions(opts *sql.TxOptions) Option {
+	return func(a *adaptor) {
+		a.TxOptions = opts
+	}
+}
+
+// WithEventTxOptions is an [Option] that sets a function that returns the
+// options used to begin the transaction in which a specific event is handled.
+//
+// If fn returns nil, the options set by [WithTxOptions] are used instead.
+//
+// When used with [WithBatching], a batch is committed before applying an event
+// that requires different options to the events already in the batch.
+func WithEventTxOptions(fn func(dogma.Event) *sql.TxOptions) Option {
+	return func(a *adaptor) {
+		a.EventTxOptions = fn
+	}
+}
+
+// txOptions returns the options used to begin the transaction in which m is
+// handled.
+func (a *adaptor) txOptions(m dogma.Event) *sql.TxOptions {
+	if a.EventTxOptions != nil {
+		if opts := a.EventTxOptions(m); opts != nil {
+			return opts
+		}
+	}
+
+	return a.TxOptions
+}
+
+// sameTxOptions returns true if x and y describe the same transaction options.
+// A nil value is equivalent to the zero value.
+func sameTxOptions(x, y *sql.TxOptions) bool {
+	if x == nil {
+		x = &sql.TxOptions{}
+	}
+
+	if y == nil {
+		y = &sql.TxOptions{}
+	}
+
+	return *x == *y
+}